@@ -0,0 +1,395 @@
+// Package cassette records the requests sent to the blockchain node and to the NFT metadata servers,
+// and replays them without a node, to reproduce a synchronization of a block range locally.
+package cassette
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"ethernal/explorer/loger"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var logger = loger.Get(loger.Eth)
+
+// ReplayUrl is the blockchain node address used while replaying, when none is configured. It is never dialed.
+const ReplayUrl = "http://cassette.invalid"
+
+const (
+	version = 1
+
+	kindRpc  = "rpc"
+	kindHttp = "http"
+
+	// maxBodySize limits the size of a recorded response
+	maxBodySize = 64 << 20
+)
+
+var errNotRecorded = errors.New("request not recorded in the cassette")
+
+// header is the first line of a cassette
+type header struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+}
+
+// entry is a recorded JSON-RPC call or HTTP request, one per line of the cassette
+type entry struct {
+	Kind string `json:"kind"`
+
+	// JSON-RPC call
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  json.RawMessage `json:"error,omitempty"`
+
+	// HTTP request
+	Url         string `json:"url,omitempty"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+func (e *entry) key() string {
+	if e.Kind == kindRpc {
+		return kindRpc + " " + e.Method + " " + string(e.Params)
+	}
+	return kindHttp + " " + e.Url
+}
+
+// Cassette is an http.RoundTripper which either records the traffic going through it or replays it.
+// JSON-RPC calls are matched by method and parameters, so batches can be split differently while replaying,
+// other requests by URL. A request recorded several times is replayed in the recorded order, then the last response is repeated.
+type Cassette struct {
+	lock sync.Mutex
+
+	// recording
+	next    http.RoundTripper
+	file    *os.File
+	gzip    *gzip.Writer
+	encoder *json.Encoder
+
+	// replaying
+	entries map[string][]*entry
+	played  map[string]int
+}
+
+// Record creates the cassette file and records the traffic sent through next.
+func Record(path string, next http.RoundTripper) (*Cassette, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := gzip.NewWriter(file)
+	c := &Cassette{
+		next:    next,
+		file:    file,
+		gzip:    writer,
+		encoder: json.NewEncoder(writer),
+	}
+	if err := c.encoder.Encode(header{Version: version, Created: time.Now().UTC()}); err != nil {
+		file.Close()
+		return nil, err
+	}
+	logger.WithField("file", path).Info("Recording the blockchain node traffic")
+	return c, nil
+}
+
+// Replay loads the cassette file. A cassette whose recording was interrupted is replayed up to its last complete entry.
+func Replay(path string) (*Cassette, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(bufio.NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a cassette: %w", path, err)
+	}
+	decoder := json.NewDecoder(reader)
+
+	var h header
+	if err := decoder.Decode(&h); err != nil {
+		return nil, fmt.Errorf("%s is not a cassette: %w", path, err)
+	}
+	if h.Version != version {
+		return nil, fmt.Errorf("%s has version %d, only version %d is supported", path, h.Version, version)
+	}
+
+	c := &Cassette{
+		entries: map[string][]*entry{},
+		played:  map[string]int{},
+	}
+	count := 0
+	for {
+		e := &entry{}
+		err := decoder.Decode(e)
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %w", path, err)
+		}
+		c.entries[e.key()] = append(c.entries[e.key()], e)
+		count++
+	}
+	logger.WithFields(logrus.Fields{"file": path, "entries": count, "recorded": h.Created}).Info("Replaying the blockchain node traffic")
+	return c, nil
+}
+
+// Close finishes the recording.
+func (c *Cassette) Close() error {
+	if c.file == nil {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	err := c.gzip.Close()
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (c *Cassette) RoundTrip(request *http.Request) (*http.Response, error) {
+	if c.entries != nil {
+		return c.replay(request)
+	}
+	return c.record(request, c.next)
+}
+
+// Through returns the round tripper recording into the cassette the traffic sent through next, instead of the transport of the recording,
+// so that traffic which must not share its connections, e.g. the one to the NFT metadata servers, is recorded into the same file.
+// While replaying it returns the cassette.
+func (c *Cassette) Through(next http.RoundTripper) http.RoundTripper {
+	if c.entries != nil {
+		return c
+	}
+	return &recorder{cassette: c, next: next}
+}
+
+// recorder records into a cassette the traffic sent through its own transport
+type recorder struct {
+	cassette *Cassette
+	next     http.RoundTripper
+}
+
+func (r *recorder) RoundTrip(request *http.Request) (*http.Response, error) {
+	return r.cassette.record(request, r.next)
+}
+
+func (c *Cassette) record(request *http.Request, next http.RoundTripper) (*http.Response, error) {
+	var calls []rpcRequest
+	batch := false
+	if request.Method == http.MethodPost && request.Body != nil {
+		body, err := io.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		request.Body = io.NopCloser(bytes.NewReader(body))
+		calls, batch, _ = parseRequests(body)
+	}
+
+	response, err := next.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxBodySize))
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(body))
+
+	if calls != nil {
+		if response.StatusCode == http.StatusOK {
+			c.recordRpc(calls, batch, body)
+		}
+	} else if request.Method == http.MethodGet {
+		c.write(&entry{
+			Kind:        kindHttp,
+			Url:         request.URL.String(),
+			Status:      response.StatusCode,
+			ContentType: response.Header.Get("Content-Type"),
+			Body:        body,
+		})
+	}
+	return response, nil
+}
+
+func (c *Cassette) recordRpc(calls []rpcRequest, batch bool, body []byte) {
+	var responses []rpcResponse
+	if batch {
+		if err := json.Unmarshal(body, &responses); err != nil {
+			return
+		}
+	} else {
+		var response rpcResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			return
+		}
+		responses = []rpcResponse{response}
+	}
+
+	byId := map[string]*rpcResponse{}
+	for i := range responses {
+		byId[string(responses[i].Id)] = &responses[i]
+	}
+	for _, call := range calls {
+		response, ok := byId[string(call.Id)]
+		if !ok {
+			continue
+		}
+		c.write(&entry{
+			Kind:   kindRpc,
+			Method: call.Method,
+			Params: compact(call.Params),
+			Result: response.Result,
+			Error:  response.Error,
+		})
+	}
+}
+
+// write appends the entry, flushed so that the cassette is usable even if the application crashes
+func (c *Cassette) write(e *entry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.encoder.Encode(e); err != nil {
+		logger.WithError(err).Error("Cannot write to the cassette")
+		return
+	}
+	if err := c.gzip.Flush(); err != nil {
+		logger.WithError(err).Error("Cannot write to the cassette")
+	}
+}
+
+func (c *Cassette) replay(request *http.Request) (*http.Response, error) {
+	if request.Method == http.MethodGet {
+		e := c.play(&entry{Kind: kindHttp, Url: request.URL.String()})
+		if e == nil {
+			logger.WithField("url", request.URL.String()).Warn("Request not recorded in the cassette")
+			return nil, errNotRecorded
+		}
+		return newResponse(request, e.Status, e.ContentType, e.Body), nil
+	}
+
+	if request.Body == nil {
+		return nil, errNotRecorded
+	}
+	body, err := io.ReadAll(request.Body)
+	request.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	calls, batch, err := parseRequests(body)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]rpcResponse, 0, len(calls))
+	for _, call := range calls {
+		response := rpcResponse{Version: "2.0", Id: call.Id}
+		if e := c.play(&entry{Kind: kindRpc, Method: call.Method, Params: compact(call.Params)}); e != nil {
+			response.Result = e.Result
+			response.Error = e.Error
+		} else {
+			logger.WithField("rpc_method", call.Method).WithField("params", string(call.Params)).Warn("Call not recorded in the cassette")
+			response.Error = json.RawMessage(fmt.Sprintf(`{"code":-32000,"message":%q}`, errNotRecorded.Error()))
+		}
+		responses = append(responses, response)
+	}
+
+	var encoded []byte
+	if batch {
+		encoded, err = json.Marshal(responses)
+	} else {
+		encoded, err = json.Marshal(responses[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newResponse(request, http.StatusOK, "application/json", encoded), nil
+}
+
+// play returns the recorded entry with the key of e which is replayed now, nil if there is none
+func (c *Cassette) play(e *entry) *entry {
+	key := e.key()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	recorded := c.entries[key]
+	if len(recorded) == 0 {
+		return nil
+	}
+	i := c.played[key]
+	if i < len(recorded)-1 {
+		c.played[key] = i + 1
+	}
+	return recorded[i]
+}
+
+type rpcRequest struct {
+	Id     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	Version string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   json.RawMessage `json:"error,omitempty"`
+}
+
+// parseRequests parses a JSON-RPC request or batch
+func parseRequests(body []byte) ([]rpcRequest, bool, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var calls []rpcRequest
+		err := json.Unmarshal(trimmed, &calls)
+		return calls, true, err
+	}
+	var call rpcRequest
+	if err := json.Unmarshal(trimmed, &call); err != nil {
+		return nil, false, err
+	}
+	return []rpcRequest{call}, false, nil
+}
+
+func compact(params json.RawMessage) json.RawMessage {
+	var buffer bytes.Buffer
+	if err := json.Compact(&buffer, params); err != nil {
+		return params
+	}
+	return buffer.Bytes()
+}
+
+func newResponse(request *http.Request, status int, contentType string, body []byte) *http.Response {
+	response := &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}
+	if contentType != "" {
+		response.Header.Set("Content-Type", contentType)
+	}
+	return response
+}
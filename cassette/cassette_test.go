@@ -0,0 +1,117 @@
+package cassette
+
+import (
+	"context"
+	"ethernal/explorer/mocknode"
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func dial(t *testing.T, url string, transport http.RoundTripper) *rpc.Client {
+	t.Helper()
+	client, err := rpc.DialOptions(context.Background(), url, rpc.WithHTTPClient(&http.Client{Transport: transport}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// fetch gets the blocks 1-3 in a batch, the latest block number and a metadata document
+func fetch(t *testing.T, client *rpc.Client, transport http.RoundTripper, metadataUrl string) ([]string, uint64, string) {
+	t.Helper()
+	blocks := make([]map[string]interface{}, 3)
+	elems := []rpc.BatchElem{}
+	for i := range blocks {
+		elems = append(elems, rpc.BatchElem{Method: "eth_getBlockByNumber", Args: []interface{}{rpc.BlockNumber(i + 1), false}, Result: &blocks[i]})
+	}
+	if err := client.BatchCallContext(context.Background(), elems); err != nil {
+		t.Fatal(err)
+	}
+	hashes := []string{}
+	for i, elem := range elems {
+		if elem.Error != nil {
+			t.Fatal(elem.Error)
+		}
+		hashes = append(hashes, blocks[i]["hash"].(string))
+	}
+
+	var latest rpc.BlockNumber
+	if err := client.CallContext(context.Background(), &latest, "eth_blockNumber"); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := (&http.Client{Transport: transport}).Get(metadataUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	document, _ := io.ReadAll(response.Body)
+	return hashes, uint64(latest), string(document)
+}
+
+// countingTransport counts the requests sent through its own connections
+type countingTransport struct {
+	transport http.Transport
+	requests  int
+}
+
+func (c *countingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	c.requests++
+	return c.transport.RoundTrip(request)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cassette.gz")
+
+	chain := mocknode.NewChain()
+	chain.Mine(5)
+	node := mocknode.New(chain)
+	metadataUrl := node.ServeMetadata("token1", `{"name":"Token 1"}`)
+
+	recording, err := Record(path, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := dial(t, node.HTTPUrl(), recording)
+	// the metadata is fetched through another transport
+	metadataTransport := &countingTransport{}
+	recordedHashes, recordedLatest, recordedDocument := fetch(t, client, recording.Through(metadataTransport), metadataUrl)
+	client.Close()
+	if metadataTransport.requests != 1 {
+		t.Fatalf("%d requests sent through the metadata transport, expected 1", metadataTransport.requests)
+	}
+	if err := recording.Close(); err != nil {
+		t.Fatal(err)
+	}
+	node.Close()
+
+	replay, err := Replay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = dial(t, ReplayUrl, replay)
+	defer client.Close()
+	hashes, latest, document := fetch(t, client, replay.Through(http.DefaultTransport), metadataUrl)
+
+	for i := range recordedHashes {
+		if hashes[i] != recordedHashes[i] {
+			t.Fatalf("replayed block hash %s, recorded %s", hashes[i], recordedHashes[i])
+		}
+	}
+	if latest != recordedLatest || latest != 5 {
+		t.Fatalf("replayed latest block %d, recorded %d", latest, recordedLatest)
+	}
+	if document != recordedDocument || document != `{"name":"Token 1"}` {
+		t.Fatalf("replayed document %q, recorded %q", document, recordedDocument)
+	}
+
+	// a call which was not recorded fails
+	var block map[string]interface{}
+	if err := client.CallContext(context.Background(), &block, "eth_getBlockByNumber", rpc.BlockNumber(4), false); err == nil || err.Error() != errNotRecorded.Error() {
+		t.Fatalf("unexpected error %v for a call not recorded", err)
+	}
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"ethernal/explorer/cassette"
+	"ethernal/explorer/config"
+	"ethernal/explorer/eth"
+
+	"github.com/sirupsen/logrus"
+)
+
+// setupCassette records the requests sent to the blockchain node into the --rpc.record cassette,
+// or serves them from the --rpc.replay cassette. The returned function finishes the recording.
+func setupCassette(cfg *config.Config) (func(), error) {
+	switch {
+	case cfg.RpcRecord != "":
+		recording, err := cassette.Record(cfg.RpcRecord, eth.NewTransport())
+		if err != nil {
+			return nil, err
+		}
+		// the metadata requests are recorded into the same cassette through their own connections
+		eth.SetTransport(recording, recording.Through(eth.NewTransport()))
+		return func() {
+			if err := recording.Close(); err != nil {
+				logrus.Error("Error while closing the cassette, err: ", err)
+			}
+		}, nil
+	case cfg.RpcReplay != "":
+		replay, err := cassette.Replay(cfg.RpcReplay)
+		if err != nil {
+			return nil, err
+		}
+		eth.SetTransport(replay, replay)
+		if cfg.HTTPUrl == "" {
+			cfg.HTTPUrl = cassette.ReplayUrl
+		}
+		return func() {}, nil
+	}
+	return func() {}, nil
+}
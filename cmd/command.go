@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"ethernal/explorer/common"
+	"ethernal/explorer/config"
+	"ethernal/explorer/loger"
+	"ethernal/explorer/tracing"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+const program = "explorer"
+
+// Command is a subcommand of the explorer, with its own flags next to the shared configuration flags.
+type Command struct {
+	// Name of the command as typed on the command line, words are separated by a space
+	Name        string
+	Usage       string
+	Description string
+	// Mode overrides the configured mode, so the syncer behaves as in the matching mode
+	Mode string
+	// Node is set for the commands which dial the blockchain node, whose address is then validated
+	Node bool
+	// SkipValidation is set for the commands which report the configuration problems themselves
+	SkipValidation bool
+	// Reload is set for the long running commands which apply the tunable settings when the configuration changes
+	Reload bool
+	Flags  func(flags *flag.FlagSet)
+	Run    func(ctx context.Context, config *config.Config) error
+}
+
+var commands = []*Command{
+	syncCommand(),
+	followCommand(),
+	verifyCommand(),
+	reindexCommand(),
+	metadataRefreshCommand(),
+	migrateCommand(),
+	exportCommand(),
+	serveCommand(),
+	configPrintCommand(),
+}
+
+// Execute runs the command selected by the arguments and returns the exit code.
+// Without a command the MODE from the configuration selects sync (manual) or follow (automatic).
+func Execute(args []string) int {
+	loger.Setup()
+
+	if len(args) > 0 && isHelp(args[0]) {
+		if len(args) == 1 {
+			printUsage(os.Stdout)
+			return 0
+		}
+		// help <command> prints the usage of the command with the shared flags
+		args = append(args[1:], "-h")
+	}
+
+	var command *Command
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		var rest []string
+		if command, rest = lookup(args); command == nil {
+			fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", strings.Join(args, " "))
+			printUsage(os.Stderr)
+			return 2
+		}
+		args = rest
+	}
+
+	flags := newFlagSet(command)
+	cfg, err := config.LoadConfig(flags, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to load config, err:", err)
+		return 2
+	}
+
+	if command == nil {
+		if command = commandForMode(cfg.Mode); command == nil {
+			fmt.Fprintf(os.Stderr, "Mode %q is not provided\n\n", cfg.Mode)
+			printUsage(os.Stderr)
+			return 2
+		}
+	}
+	if command.Mode != "" {
+		cfg.Mode = command.Mode
+	}
+	if !command.SkipValidation {
+		if err := cfg.Validate(command.Node); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	if err := loger.Configure(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to configure logging, err:", err)
+		return 2
+	}
+
+	// cancelled on SIGINT or SIGTERM, after which no new jobs are started
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if command.Reload {
+		if err := config.Watch(ctx, cfg, reloadConfig(command, args)); err != nil {
+			logrus.Error("Configuration changes are not watched, err: ", err)
+		}
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to set up tracing, err:", err)
+		return 2
+	}
+
+	closeCassette := func() {}
+	if command.Node {
+		if closeCassette, err = setupCassette(cfg); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to open the cassette, err:", err)
+			return 2
+		}
+	}
+
+	exitCode := 0
+	if err := command.Run(ctx, cfg); err != nil {
+		logrus.WithField("command", command.Name).Error("Command failed, err: ", err)
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		exitCode = 1
+	}
+	closeCassette()
+
+	if err := shutdownTracing(context.Background()); err != nil {
+		logrus.Error("Error while flushing spans, err: ", err)
+	}
+	logrus.Info("Stopped")
+	return exitCode
+}
+
+// reloadConfig returns the function loading the configuration again with the same command and arguments.
+func reloadConfig(command *Command, args []string) func() (*config.Config, error) {
+	return func() (*config.Config, error) {
+		reloaded, err := config.LoadConfig(newFlagSet(command), args)
+		if err != nil {
+			return nil, err
+		}
+		if command.Mode != "" {
+			reloaded.Mode = command.Mode
+		}
+		return reloaded, reloaded.Validate(command.Node)
+	}
+}
+
+// lookup finds the command named by the leading arguments and returns it with the remaining arguments.
+func lookup(args []string) (*Command, []string) {
+	for _, command := range commands {
+		words := strings.Fields(command.Name)
+		if len(args) < len(words) {
+			continue
+		}
+		if strings.Join(args[:len(words)], " ") == command.Name {
+			return command, args[len(words):]
+		}
+	}
+	return nil, args
+}
+
+func commandForMode(mode string) *Command {
+	switch mode {
+	case common.Manual:
+		command, _ := lookup([]string{"sync"})
+		return command
+	case common.Automatic:
+		command, _ := lookup([]string{"follow"})
+		return command
+	}
+	return nil
+}
+
+// newFlagSet creates the flag set of the command; the shared configuration flags are registered by config.LoadConfig.
+func newFlagSet(command *Command) *flag.FlagSet {
+	if command == nil {
+		flags := flag.NewFlagSet(program, flag.ContinueOnError)
+		flags.Usage = func() {
+			printUsage(flags.Output())
+			fmt.Fprintln(flags.Output(), "\nFlags:")
+			flags.PrintDefaults()
+		}
+		return flags
+	}
+
+	flags := flag.NewFlagSet(program+" "+command.Name, flag.ContinueOnError)
+	if command.Flags != nil {
+		command.Flags(flags)
+	}
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s\n\n%s\n\nFlags:\n", program, command.Usage, command.Description)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", program)
+	for _, command := range commands {
+		fmt.Fprintf(w, "  %-18s %s\n", command.Name, firstSentence(command.Description))
+	}
+	fmt.Fprintf(w, "\nWithout a command, MODE selects sync (manual) or follow (automatic).\n")
+	fmt.Fprintf(w, "Run '%s help <command>' for the flags of a command.\n", program)
+}
+
+func firstSentence(description string) string {
+	if i := strings.Index(description, "."); i >= 0 {
+		return description[:i+1]
+	}
+	return description
+}
+
+func isHelp(arg string) bool {
+	return arg == "help" || arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+// blockFlag is a block number flag which records whether it has been set, as block 0 is a valid value.
+type blockFlag struct {
+	value uint64
+	set   bool
+}
+
+func (b *blockFlag) String() string {
+	if b == nil || !b.set {
+		return ""
+	}
+	return strconv.FormatUint(b.value, 10)
+}
+
+func (b *blockFlag) Set(value string) error {
+	number, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return err
+	}
+	b.value = number
+	b.set = true
+	return nil
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"ethernal/explorer/common"
+	"ethernal/explorer/config"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// inEmptyDir runs the test from a directory with an empty .env file, so that only the environment and the flags configure it
+func inEmptyDir(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+		viper.Reset()
+	})
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		args    []string
+		command string
+		rest    []string
+	}{
+		{[]string{"sync"}, "sync", []string{}},
+		{[]string{"sync", "--from", "5"}, "sync", []string{"--from", "5"}},
+		{[]string{"metadata", "refresh", "--contract", "0x1"}, "metadata refresh", []string{"--contract", "0x1"}},
+		{[]string{"metadata"}, "", nil},
+		{[]string{"metadata", "fetch"}, "", nil},
+		{[]string{"refresh", "metadata"}, "", nil},
+		{[]string{"synchronize"}, "", nil},
+	}
+	for _, test := range tests {
+		command, rest := lookup(test.args)
+		if test.command == "" {
+			if command != nil {
+				t.Errorf("%q resolved to %q, expected no command", test.args, command.Name)
+			}
+			continue
+		}
+		if command == nil || command.Name != test.command || !reflect.DeepEqual(rest, test.rest) {
+			t.Errorf("%q resolved to %v with %q, expected %q with %q", test.args, command, rest, test.command, test.rest)
+		}
+	}
+}
+
+func TestCommandForMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		command string
+	}{
+		{common.Manual, "sync"},
+		{common.Automatic, "follow"},
+		{"", ""},
+		{"fast", ""},
+	}
+	for _, test := range tests {
+		command := commandForMode(test.mode)
+		if test.command == "" {
+			if command != nil {
+				t.Errorf("mode %q resolved to %q, expected no command", test.mode, command.Name)
+			}
+			continue
+		}
+		if command == nil || command.Name != test.command {
+			t.Fatalf("mode %q resolved to %v, expected %q", test.mode, command, test.command)
+		}
+		// the command keeps the mode which selected it
+		if command.Mode != test.mode {
+			t.Errorf("mode %q resolved to %q which runs in mode %q", test.mode, command.Name, command.Mode)
+		}
+	}
+}
+
+func TestCommandFlags(t *testing.T) {
+	inEmptyDir(t)
+	load := func(args ...string) error {
+		viper.Reset()
+		command, rest := lookup(args)
+		flags := newFlagSet(command)
+		flags.SetOutput(io.Discard)
+		_, err := config.LoadConfig(flags, rest)
+		return err
+	}
+
+	if err := load("metadata", "refresh", "--contract", "0x1", "--token", "7", "--db.host", "localhost"); err != nil {
+		t.Fatalf("metadata refresh flags rejected with %v", err)
+	}
+	if err := load("sync", "--contract", "0x1"); err == nil {
+		t.Fatal("sync accepted the flags of metadata refresh")
+	}
+}
+
+func TestExecuteUnknown(t *testing.T) {
+	inEmptyDir(t)
+	if code := Execute([]string{"metadata", "fetch"}); code != 2 {
+		t.Fatalf("unknown command exited with %d, expected 2", code)
+	}
+
+	// without a command the MODE selects it
+	t.Setenv("EXPLORER_MODE", "fast")
+	if code := Execute([]string{"--db.host", "localhost"}); code != 2 {
+		t.Fatalf("unknown mode exited with %d, expected 2", code)
+	}
+}
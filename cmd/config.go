@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"context"
+	"ethernal/explorer/config"
+	"os"
+)
+
+func configPrintCommand() *Command {
+	return &Command{
+		Name:  "config print",
+		Usage: "config print [flags]",
+		Description: "Prints the effective configuration as YAML, with the passwords and the URL paths redacted, " +
+			"and fails if the configuration is not valid.",
+		SkipValidation: true,
+		Run: func(ctx context.Context, config *config.Config) error {
+			config.Print(os.Stdout)
+			return config.Validate(true)
+		},
+	}
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"ethernal/explorer/config"
+	"ethernal/explorer/db"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	formatCsv   = "csv"
+	formatJsonl = "jsonl"
+)
+
+// exportTables maps the tables which can be exported to their block number column
+var exportTables = map[string]string{
+	"blocks":        "number",
+	"transactions":  "block_number",
+	"logs":          "block_number",
+	"nft_transfers": "block_number",
+}
+
+func exportCommand() *Command {
+	var from, to blockFlag
+	var table, format, out string
+	return &Command{
+		Name:  "export",
+		Usage: "export [--table <name>] [--from <block>] [--to <block>] [--format csv|jsonl] [--out <file>] [flags]",
+		Description: "Exports the rows of a table, ordered by block number, as CSV or JSON lines. " +
+			"The supported tables are " + strings.Join(exportTableNames(), ", ") + ".",
+		Flags: func(flags *flag.FlagSet) {
+			flags.StringVar(&table, "table", "blocks", "Table to export: "+strings.Join(exportTableNames(), ", "))
+			flags.Var(&from, "from", "First block of the exported rows")
+			flags.Var(&to, "to", "Last block of the exported rows")
+			flags.StringVar(&format, "format", formatCsv, "Output format: csv or jsonl")
+			flags.StringVar(&out, "out", "-", "Output file, - for the standard output")
+		},
+		Run: func(ctx context.Context, config *config.Config) error {
+			numberColumn, ok := exportTables[table]
+			if !ok {
+				return fmt.Errorf("table %s cannot be exported, use one of %s", table, strings.Join(exportTableNames(), ", "))
+			}
+			if format != formatCsv && format != formatJsonl {
+				return fmt.Errorf("unknown export format %s, use csv or jsonl", format)
+			}
+
+			database := db.InitDb(config)
+			defer closeDb(database)
+
+			query := database.NewSelect().Table(table).OrderExpr("? ASC", bun.Ident(numberColumn))
+			if from.set {
+				query = query.Where("? >= ?", bun.Ident(numberColumn), from.value)
+			}
+			if to.set {
+				query = query.Where("? <= ?", bun.Ident(numberColumn), to.value)
+			}
+			rows, err := query.Rows(ctx)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+
+			var output io.Writer = os.Stdout
+			if out != "-" {
+				file, err := os.Create(out)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				output = file
+			}
+			writer := bufio.NewWriter(output)
+			defer writer.Flush()
+
+			columns, err := rows.Columns()
+			if err != nil {
+				return err
+			}
+			write := newRowWriter(writer, format, columns)
+
+			values := make([]interface{}, len(columns))
+			pointers := make([]interface{}, len(columns))
+			for i := range values {
+				pointers[i] = &values[i]
+			}
+			for rows.Next() {
+				if err := rows.Scan(pointers...); err != nil {
+					return err
+				}
+				if err := write(values); err != nil {
+					return err
+				}
+			}
+			return rows.Err()
+		},
+	}
+}
+
+// newRowWriter returns the function writing one row in the format; the CSV header is written right away.
+func newRowWriter(w io.Writer, format string, columns []string) func(values []interface{}) error {
+	if format == formatJsonl {
+		encoder := json.NewEncoder(w)
+		return func(values []interface{}) error {
+			row := make(map[string]interface{}, len(columns))
+			for i, column := range columns {
+				row[column] = exportValue(values[i])
+			}
+			return encoder.Encode(row)
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Write(columns)
+	record := make([]string, len(columns))
+	return func(values []interface{}) error {
+		for i, value := range values {
+			if value == nil {
+				record[i] = ""
+			} else {
+				record[i] = fmt.Sprint(exportValue(value))
+			}
+		}
+		writer.Write(record)
+		writer.Flush()
+		return writer.Error()
+	}
+}
+
+// exportValue converts the scanned value to its exported form, binary columns are hex encoded
+func exportValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return "0x" + hex.EncodeToString(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	}
+	return value
+}
+
+func exportTableNames() []string {
+	names := make([]string, 0, len(exportTables))
+	for name := range exportTables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"ethernal/explorer/config"
+	"ethernal/explorer/db"
+	"ethernal/explorer/eth"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+func metadataRefreshCommand() *Command {
+	var contract, token string
+	return &Command{
+		Name:        "metadata refresh",
+		Node:        true,
+		Usage:       "metadata refresh --contract <address> [--token <id>] [flags]",
+		Description: "Fetches the NFT metadata of the contract, or of one of its tokens, again and replaces the stored metadata.",
+		Flags: func(flags *flag.FlagSet) {
+			flags.StringVar(&contract, "contract", "", "Address of the NFT contract (required)")
+			flags.StringVar(&token, "token", "", "Decimal id of the token, all minted tokens of the contract if empty")
+		},
+		Run: func(ctx context.Context, config *config.Config) error {
+			if contract == "" {
+				return errors.New("--contract is required")
+			}
+			if _, ok := new(big.Int).SetString(token, 10); token != "" && !ok {
+				return errors.New("--token must be a decimal token id")
+			}
+
+			database := db.InitDb(config)
+			defer closeDb(database)
+			stopNftMetadata := syncNftMetadata(database, eth.GetClient(config.HTTPUrl), config)
+			defer stopNftMetadata()
+
+			count, err := eth.RefreshNftMetadata(ctx, database, contract, token, config.NftConsecutiveMaxTokens)
+			if err != nil {
+				return err
+			}
+			statuses, err := eth.WaitNftMetadataJobs(ctx, database, contract, token)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stdout, "Refreshed the metadata of %d tokens, %d are done, %d will be retried and %d have failed\n",
+				count, statuses[db.NftMetadataJobDone], statuses[db.NftMetadataJobPending], statuses[db.NftMetadataJobFailed])
+			return nil
+		},
+	}
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"context"
+	"ethernal/explorer/config"
+	"ethernal/explorer/db"
+	"fmt"
+	"os"
+)
+
+func migrateCommand() *Command {
+	return &Command{
+		Name:        "migrate",
+		Usage:       "migrate [flags]",
+		Description: "Creates the missing tables and indexes and exits.",
+		Run: func(ctx context.Context, config *config.Config) error {
+			// the tables are created when the database is initialized
+			database := db.InitDb(config)
+			closeDb(database)
+			fmt.Fprintln(os.Stdout, "Database schema is up to date")
+			return nil
+		},
+	}
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"ethernal/explorer/config"
+	"ethernal/explorer/db"
+	"ethernal/explorer/eth"
+	"ethernal/explorer/server"
+)
+
+func serveCommand() *Command {
+	return &Command{
+		Name:        "serve",
+		Node:        true,
+		Usage:       "serve [flags]",
+		Description: "Serves the metrics, health and admin endpoints on SERVER_ADDR without synchronizing, until it is stopped.",
+		Run: func(ctx context.Context, config *config.Config) error {
+			if config.ServerAddr == "" {
+				return errors.New("the server address is not configured, set SERVER_ADDR or --server.addr")
+			}
+
+			database := db.InitDb(config)
+			defer closeDb(database)
+
+			connection := eth.BlockchainNodeConnection{
+				HTTP: eth.GetClient(config.HTTPUrl),
+			}
+			server.Start(ctx, config, database, &connection)
+			return nil
+		},
+	}
+}
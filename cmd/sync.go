@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"ethernal/explorer/common"
+	"ethernal/explorer/config"
+	"ethernal/explorer/db"
+	"ethernal/explorer/eth"
+	"ethernal/explorer/listener"
+	"ethernal/explorer/server"
+	"ethernal/explorer/syncer"
+	"ethernal/explorer/webhooks"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/sirupsen/logrus"
+	"github.com/uptrace/bun"
+)
+
+func syncCommand() *Command {
+	var from, to blockFlag
+	return &Command{
+		Name:  "sync",
+		Node:  true,
+		Usage: "sync [--from <block>] [--to <block>] [flags]",
+		Description: "Synchronizes the missing blocks once and exits. " +
+			"Without --from and --to every block from the checkpoint up to the latest block is synchronized, " +
+			"otherwise only the given range; --to defaults to the latest block on the blockchain.",
+		Mode: common.Manual,
+		Flags: func(flags *flag.FlagSet) {
+			flags.Var(&from, "from", "First block of the range to synchronize")
+			flags.Var(&to, "to", "Last block of the range to synchronize")
+		},
+		Run: func(ctx context.Context, config *config.Config) error {
+			if from.set && to.set && from.value > to.value {
+				return fmt.Errorf("--from %d is greater than --to %d", from.value, to.value)
+			}
+
+			database := db.InitDb(config)
+			defer closeDb(database)
+			stopWebhooks := startWebhooks(database, config)
+			defer stopWebhooks()
+
+			// HTTP connection to blockchain
+			connection := eth.BlockchainNodeConnection{
+				HTTP: eth.GetClient(config.HTTPUrl),
+			}
+			startServer(ctx, config, database, &connection)
+			stopNftMetadata := syncNftMetadata(database, connection.HTTP, config)
+			defer stopNftMetadata()
+
+			if !from.set && !to.set {
+				syncer.SyncMissingBlocks(ctx, connection.HTTP, database, config)
+				return nil
+			}
+
+			first := config.Checkpoint
+			if from.set {
+				first = from.value
+			}
+			last := to.value
+			if !to.set {
+				last = syncer.LatestBlockFromChain(ctx, connection.HTTP, config.CallTimeoutInSeconds)
+			}
+			if first > last {
+				return fmt.Errorf("the range %d-%d is empty", first, last)
+			}
+			return syncer.SyncBlockRange(ctx, connection.HTTP, database, config, first, last)
+		},
+	}
+}
+
+func followCommand() *Command {
+	return &Command{
+		Name:        "follow",
+		Node:        true,
+		Usage:       "follow [flags]",
+		Description: "Synchronizes the missing blocks and keeps following the new blocks over WebSocket, until it is stopped.",
+		Mode:        common.Automatic,
+		Reload:      true,
+		Run: func(ctx context.Context, config *config.Config) error {
+			database := db.InitDb(config)
+			defer closeDb(database)
+			stopWebhooks := startWebhooks(database, config)
+			defer stopWebhooks()
+
+			// both HTTP and WebSocket connection to blockchain
+			connection := eth.BlockchainNodeConnection{
+				HTTP:      eth.GetClient(config.HTTPUrl),
+				WebSocket: eth.GetClient(config.WebSocketUrl),
+			}
+			startServer(ctx, config, database, &connection)
+			stopNftMetadata := syncNftMetadata(database, connection.HTTP, config)
+			defer stopNftMetadata()
+
+			listener.ListenForNewBlocks(ctx, &connection, database, config)
+			return nil
+		},
+	}
+}
+
+func closeDb(database *bun.DB) {
+	if err := database.Close(); err != nil {
+		logrus.Error("Error while closing the database, err: ", err)
+	}
+}
+
+// startWebhooks starts delivering webhooks, if they are enabled. The returned function stops it,
+// after the deliveries in progress have finished or the shutdown timeout has elapsed.
+func startWebhooks(database *bun.DB, config *config.Config) func() {
+	if !config.Webhooks {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	dispatcher := webhooks.NewDispatcher(database, config)
+	go func() {
+		dispatcher.Run(ctx, time.Duration(config.ShutdownTimeout)*time.Second)
+		close(done)
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// startServer starts the monitoring server, if its address is configured.
+func startServer(ctx context.Context, config *config.Config, database *bun.DB, connection *eth.BlockchainNodeConnection) {
+	if config.ServerAddr != "" {
+		go server.Start(ctx, config, database, connection)
+	}
+}
+
+// syncNftMetadata starts fetching the queued nft metadata. The returned function stops it,
+// after the jobs in progress have finished or the shutdown timeout has elapsed.
+func syncNftMetadata(database *bun.DB, client *rpc.Client, config *config.Config) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	queue := eth.NewNftMetadataQueue(database, client, config)
+	go func() {
+		queue.Run(ctx, time.Duration(config.ShutdownTimeout)*time.Second)
+		close(done)
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
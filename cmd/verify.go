@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"ethernal/explorer/config"
+	"ethernal/explorer/db"
+	"ethernal/explorer/eth"
+	"ethernal/explorer/syncer"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/uptrace/bun"
+)
+
+func verifyCommand() *Command {
+	var from, to blockFlag
+	var fix bool
+	return &Command{
+		Name:  "verify",
+		Node:  true,
+		Usage: "verify [--from <block>] [--to <block>] [--fix] [flags]",
+		Description: "Re-checks the hashes of the stored blocks against the blockchain. " +
+			"--from defaults to the checkpoint and --to to the highest stored block. " +
+			"Mismatched blocks are reported and the command fails, unless --fix deletes and fetches them again.",
+		Flags: func(flags *flag.FlagSet) {
+			flags.Var(&from, "from", "First block to verify")
+			flags.Var(&to, "to", "Last block to verify")
+			flags.BoolVar(&fix, "fix", false, "Delete the mismatched blocks and fetch them again")
+		},
+		Run: func(ctx context.Context, config *config.Config) error {
+			database := db.InitDb(config)
+			defer closeDb(database)
+
+			first := config.Checkpoint
+			if from.set {
+				first = from.value
+			}
+			last := to.value
+			if !to.set {
+				var err error
+				if last, err = highestBlock(ctx, database); err != nil {
+					return err
+				}
+			}
+			if first > last {
+				return fmt.Errorf("the range %d-%d is empty", first, last)
+			}
+
+			client := eth.GetClient(config.HTTPUrl)
+			mismatched, err := syncer.VerifyBlocks(ctx, client, database, config, first, last)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stdout, "Verified blocks %d-%d, %d do not match the blockchain\n", first, last, len(mismatched))
+			for _, block := range mismatched {
+				fmt.Fprintf(os.Stdout, "  %d %s\n", block.Number, block.Hash)
+			}
+			if len(mismatched) == 0 {
+				return nil
+			}
+			if !fix {
+				return fmt.Errorf("%d blocks do not match the blockchain, run with --fix to fetch them again", len(mismatched))
+			}
+
+			stopWebhooks := startWebhooks(database, config)
+			defer stopWebhooks()
+			stopNftMetadata := syncNftMetadata(database, client, config)
+			defer stopNftMetadata()
+
+			blockHashes := make([]string, len(mismatched))
+			for i, block := range mismatched {
+				blockHashes[i] = block.Hash
+			}
+			if err := syncer.DeleteBlocks(ctx, database, blockHashes); err != nil {
+				return err
+			}
+			return syncer.SyncBlockRange(ctx, client, database, config, mismatched[0].Number, mismatched[len(mismatched)-1].Number)
+		},
+	}
+}
+
+func reindexCommand() *Command {
+	var from, to blockFlag
+	return &Command{
+		Name:        "reindex",
+		Node:        true,
+		Usage:       "reindex --from <block> --to <block> [flags]",
+		Description: "Deletes the stored blocks of the range with their transactions, logs and NFT transfers and fetches them again.",
+		Flags: func(flags *flag.FlagSet) {
+			flags.Var(&from, "from", "First block to reindex (required)")
+			flags.Var(&to, "to", "Last block to reindex (required)")
+		},
+		Run: func(ctx context.Context, config *config.Config) error {
+			if !from.set || !to.set {
+				return errors.New("--from and --to are required")
+			}
+			if from.value > to.value {
+				return fmt.Errorf("--from %d is greater than --to %d", from.value, to.value)
+			}
+
+			database := db.InitDb(config)
+			defer closeDb(database)
+			stopWebhooks := startWebhooks(database, config)
+			defer stopWebhooks()
+			client := eth.GetClient(config.HTTPUrl)
+			stopNftMetadata := syncNftMetadata(database, client, config)
+			defer stopNftMetadata()
+
+			return syncer.ReindexBlocks(ctx, client, database, config, from.value, to.value)
+		},
+	}
+}
+
+// highestBlock returns the number of the highest block in the database.
+func highestBlock(ctx context.Context, database *bun.DB) (uint64, error) {
+	var number uint64
+	err := database.NewSelect().Table("blocks").ColumnExpr("COALESCE(MAX(number), 0)").Scan(ctx, &number)
+	return number, err
+}
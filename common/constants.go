@@ -11,6 +11,9 @@ const (
 	ERC1155Type
 )
 
+// ZeroAddress is the sender of the minted tokens and the recipient of the burned ones
+const ZeroAddress = "0x0000000000000000000000000000000000000000"
+
 var Erc721TransferEvent = struct {
 	Name      string
 	Signature string
@@ -41,6 +44,88 @@ var Erc1155TransferBatchEvent = struct {
 	Abi:       "{\"anonymous\":false,\"inputs\":[{\"indexed\":true,\"internalType\":\"address\",\"name\":\"operator\",\"type\":\"address\"},{\"indexed\":true,\"internalType\":\"address\",\"name\":\"from\",\"type\":\"address\"},{\"indexed\":true,\"internalType\":\"address\",\"name\":\"to\",\"type\":\"address\"},{\"indexed\":false,\"internalType\":\"uint256[]\",\"name\":\"ids\",\"type\":\"uint256[]\"},{\"indexed\":false,\"internalType\":\"uint256[]\",\"name\":\"values\",\"type\":\"uint256[]\"}],\"name\":\"TransferBatch\",\"type\":\"event\"}",
 }
 
+var Erc4906MetadataUpdateEvent = struct {
+	Name      string
+	Signature string
+	Abi       string
+}{
+	Name:      "MetadataUpdate",
+	Signature: "0xf8e1a15aba9398e019f0b49df1a4fde98ee17ae345cb5f6b5e2c27f5033e8ce7",
+	Abi:       "{\"anonymous\":false,\"inputs\":[{\"indexed\":false,\"internalType\":\"uint256\",\"name\":\"_tokenId\",\"type\":\"uint256\"}],\"name\":\"MetadataUpdate\",\"type\":\"event\"}",
+}
+
+var Erc4906BatchMetadataUpdateEvent = struct {
+	Name      string
+	Signature string
+	Abi       string
+}{
+	Name:      "BatchMetadataUpdate",
+	Signature: "0x6bd5c950a8d8df17f772f5af37cb3655737899cbf903264b9795592da439661c",
+	Abi:       "{\"anonymous\":false,\"inputs\":[{\"indexed\":false,\"internalType\":\"uint256\",\"name\":\"_fromTokenId\",\"type\":\"uint256\"},{\"indexed\":false,\"internalType\":\"uint256\",\"name\":\"_toTokenId\",\"type\":\"uint256\"}],\"name\":\"BatchMetadataUpdate\",\"type\":\"event\"}",
+}
+
+var Erc1155UriEvent = struct {
+	Name      string
+	Signature string
+	Abi       string
+}{
+	Name:      "URI",
+	Signature: "0x6bb7ff708619ba0610cba295a58592e0451dee2622938c8755667688daf3529b",
+	Abi:       "{\"anonymous\":false,\"inputs\":[{\"indexed\":false,\"internalType\":\"string\",\"name\":\"value\",\"type\":\"string\"},{\"indexed\":true,\"internalType\":\"uint256\",\"name\":\"id\",\"type\":\"uint256\"}],\"name\":\"URI\",\"type\":\"event\"}",
+}
+
+var Erc2309ConsecutiveTransferEvent = struct {
+	Name      string
+	Signature string
+	Abi       string
+}{
+	Name:      "ConsecutiveTransfer",
+	Signature: "0xdeaa91b6123d068f5821d0fb0678463d1a8a6079fe8af5de3ce5e896dcf9133d",
+	Abi:       "{\"anonymous\":false,\"inputs\":[{\"indexed\":true,\"internalType\":\"uint256\",\"name\":\"fromTokenId\",\"type\":\"uint256\"},{\"indexed\":false,\"internalType\":\"uint256\",\"name\":\"toTokenId\",\"type\":\"uint256\"},{\"indexed\":true,\"internalType\":\"address\",\"name\":\"fromAddress\",\"type\":\"address\"},{\"indexed\":true,\"internalType\":\"address\",\"name\":\"toAddress\",\"type\":\"address\"}],\"name\":\"ConsecutiveTransfer\",\"type\":\"event\"}",
+}
+
+var Erc5192LockedEvent = struct {
+	Name      string
+	Signature string
+	Abi       string
+}{
+	Name:      "Locked",
+	Signature: "0x032bc66be43dbccb7487781d168eb7bda224628a3b2c3388bdf69b532a3a1611",
+	Abi:       "{\"anonymous\":false,\"inputs\":[{\"indexed\":false,\"internalType\":\"uint256\",\"name\":\"tokenId\",\"type\":\"uint256\"}],\"name\":\"Locked\",\"type\":\"event\"}",
+}
+
+var Erc5192UnlockedEvent = struct {
+	Name      string
+	Signature string
+	Abi       string
+}{
+	Name:      "Unlocked",
+	Signature: "0xf27b6ce5b2f5e68ddb2fd95a8a909d4ecf1daaac270935fff052feacb24f1842",
+	Abi:       "{\"anonymous\":false,\"inputs\":[{\"indexed\":false,\"internalType\":\"uint256\",\"name\":\"tokenId\",\"type\":\"uint256\"}],\"name\":\"Unlocked\",\"type\":\"event\"}",
+}
+
+// Erc6551AccountCreatedEvent is emitted by the ERC-6551 registry from version 0.3
+var Erc6551AccountCreatedEvent = struct {
+	Name      string
+	Signature string
+	Abi       string
+}{
+	Name:      "ERC6551AccountCreated",
+	Signature: "0x79f19b3655ee38b1ce526556b7731a20c8f218fbda4a3990b6cc4172fdf88722",
+	Abi:       "{\"anonymous\":false,\"inputs\":[{\"indexed\":false,\"internalType\":\"address\",\"name\":\"account\",\"type\":\"address\"},{\"indexed\":true,\"internalType\":\"address\",\"name\":\"implementation\",\"type\":\"address\"},{\"indexed\":false,\"internalType\":\"bytes32\",\"name\":\"salt\",\"type\":\"bytes32\"},{\"indexed\":false,\"internalType\":\"uint256\",\"name\":\"chainId\",\"type\":\"uint256\"},{\"indexed\":true,\"internalType\":\"address\",\"name\":\"tokenContract\",\"type\":\"address\"},{\"indexed\":true,\"internalType\":\"uint256\",\"name\":\"tokenId\",\"type\":\"uint256\"}],\"name\":\"ERC6551AccountCreated\",\"type\":\"event\"}",
+}
+
+// Erc6551LegacyAccountCreatedEvent is emitted by the ERC-6551 registry up to version 0.2
+var Erc6551LegacyAccountCreatedEvent = struct {
+	Name      string
+	Signature string
+	Abi       string
+}{
+	Name:      "AccountCreated",
+	Signature: "0x07fba7bba1191da7ee1155dcfa0030701c9c9a9cc34a93b991fc6fd0c9268d8f",
+	Abi:       "{\"anonymous\":false,\"inputs\":[{\"indexed\":false,\"internalType\":\"address\",\"name\":\"account\",\"type\":\"address\"},{\"indexed\":false,\"internalType\":\"address\",\"name\":\"implementation\",\"type\":\"address\"},{\"indexed\":false,\"internalType\":\"uint256\",\"name\":\"chainId\",\"type\":\"uint256\"},{\"indexed\":false,\"internalType\":\"address\",\"name\":\"tokenContract\",\"type\":\"address\"},{\"indexed\":false,\"internalType\":\"uint256\",\"name\":\"tokenId\",\"type\":\"uint256\"},{\"indexed\":false,\"internalType\":\"uint256\",\"name\":\"salt\",\"type\":\"uint256\"}],\"name\":\"AccountCreated\",\"type\":\"event\"}",
+}
+
 var TokenUriMethod = struct {
 	Name string
 	Abi  string
@@ -56,3 +141,27 @@ var UriMethod = struct {
 	Name: "uri",
 	Abi:  "{\"inputs\":[{\"internalType\":\"uint256\",\"name\":\"id\",\"type\":\"uint256\"}],\"name\":\"uri\",\"outputs\":[{\"internalType\":\"string\",\"name\":\"\",\"type\":\"string\"}],\"stateMutability\":\"view\",\"type\":\"function\"}",
 }
+
+var NameMethod = struct {
+	Name string
+	Abi  string
+}{
+	Name: "name",
+	Abi:  "{\"inputs\":[],\"name\":\"name\",\"outputs\":[{\"internalType\":\"string\",\"name\":\"\",\"type\":\"string\"}],\"stateMutability\":\"view\",\"type\":\"function\"}",
+}
+
+var SymbolMethod = struct {
+	Name string
+	Abi  string
+}{
+	Name: "symbol",
+	Abi:  "{\"inputs\":[],\"name\":\"symbol\",\"outputs\":[{\"internalType\":\"string\",\"name\":\"\",\"type\":\"string\"}],\"stateMutability\":\"view\",\"type\":\"function\"}",
+}
+
+var ContractUriMethod = struct {
+	Name string
+	Abi  string
+}{
+	Name: "contractURI",
+	Abi:  "{\"inputs\":[],\"name\":\"contractURI\",\"outputs\":[{\"internalType\":\"string\",\"name\":\"\",\"type\":\"string\"}],\"stateMutability\":\"view\",\"type\":\"function\"}",
+}
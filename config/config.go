@@ -2,78 +2,279 @@ package config
 
 import (
 	"flag"
+	"fmt"
+	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	HTTPUrl              string
-	WebSocketUrl         string
-	DbUser               string
-	DbPassword           string
-	DbHost               string
-	DbPort               string
-	DbName               string
-	DbSSL                string
-	WorkersCount         uint
-	Step                 uint
-	CallTimeoutInSeconds uint
-	Mode                 string
-	Checkpoint           uint64
-	CheckpointWindow     uint
-	CheckpointDistance   uint
-	EthLogs              bool
-	NFTs                 bool
-	IPFSGatewayUrl       string
+	HTTPUrl                 string `key:"HTTPUrl" secret:"url"`
+	WebSocketUrl            string `key:"WebSocketUrl" secret:"url"`
+	DbUser                  string `key:"DB_USER"`
+	DbPassword              string `key:"DB_PASSWORD" secret:"true"`
+	DbHost                  string `key:"DB_HOST"`
+	DbPort                  string `key:"DB_PORT"`
+	DbName                  string `key:"DB_NAME"`
+	DbSSL                   string `key:"DB_SSL"`
+	WorkersCount            uint   `key:"WORKERS_COUNT"`
+	DecodeWorkersCount      uint   `key:"DECODE_WORKERS_COUNT"`
+	PersistWorkersCount     uint   `key:"PERSIST_WORKERS_COUNT"`
+	PipelineBuffer          uint   `key:"PIPELINE_BUFFER"`
+	OrderedCommits          bool   `key:"ORDERED_COMMITS"`
+	Step                    uint   `key:"STEP"`
+	CallTimeoutInSeconds    uint   `key:"CALL_TIMEOUT_IN_SECONDS"`
+	Mode                    string `key:"MODE"`
+	Checkpoint              uint64 `key:"CHECKPOINT"`
+	CheckpointWindow        uint   `key:"CHECKPOINT_WINDOW"`
+	CheckpointDistance      uint   `key:"CHECKPOINT_DISTANCE"`
+	EthLogs                 bool   `key:"INCLUDE_ETH_LOGS"`
+	NFTs                    bool   `key:"INCLUDE_NFTS"`
+	IPFSGatewayUrl          string `key:"IPFS_GATEWAY_URL" secret:"urls"`
+	IPFSApiUrl              string `key:"IPFS_API_URL" secret:"url"`
+	IPFSStrategy            string `key:"IPFS_STRATEGY"`
+	IPFSRateLimit           uint   `key:"IPFS_RATE_LIMIT"`
+	IPFSVerify              bool   `key:"IPFS_VERIFY"`
+	NftMetadataWorkersCount uint   `key:"NFT_METADATA_WORKERS_COUNT"`
+	NftMetadataMaxAttempts  uint   `key:"NFT_METADATA_MAX_ATTEMPTS"`
+	NftMetadataMaxSizeInKB  uint   `key:"NFT_METADATA_MAX_SIZE_IN_KB"`
+	NftMetadataRedirects    uint   `key:"NFT_METADATA_MAX_REDIRECTS"`
+	NftMetadataHostRequests uint   `key:"NFT_METADATA_HOST_CONCURRENCY"`
+	NftMetadataUserAgent    string `key:"NFT_METADATA_USER_AGENT"`
+	NftMetadataAllowPrivate bool   `key:"NFT_METADATA_ALLOW_PRIVATE"`
+	NftConsecutiveMaxTokens uint64 `key:"NFT_CONSECUTIVE_MAX_TOKENS"`
+	MediaStore              string `key:"MEDIA_STORE"`
+	MediaDir                string `key:"MEDIA_DIR"`
+	MediaMaxSizeInMB        uint   `key:"MEDIA_MAX_SIZE_IN_MB"`
+	MediaThumbnailSize      uint   `key:"MEDIA_THUMBNAIL_SIZE"`
+	MediaS3Endpoint         string `key:"MEDIA_S3_ENDPOINT" secret:"url"`
+	MediaS3Bucket           string `key:"MEDIA_S3_BUCKET"`
+	MediaS3Region           string `key:"MEDIA_S3_REGION"`
+	MediaS3AccessKey        string `key:"MEDIA_S3_ACCESS_KEY"`
+	MediaS3SecretKey        string `key:"MEDIA_S3_SECRET_KEY" secret:"true"`
+	Webhooks                bool   `key:"WEBHOOKS_ENABLED"`
+	WebhookMaxAttempts      uint   `key:"WEBHOOK_MAX_ATTEMPTS"`
+	WebhookTimeout          uint   `key:"WEBHOOK_TIMEOUT_IN_SECONDS"`
+	ServerAddr              string `key:"SERVER_ADDR"`
+	AdminToken              string `key:"ADMIN_TOKEN" secret:"true"`
+	HealthLagThreshold      uint   `key:"HEALTH_LAG_THRESHOLD"`
+	HealthStallTimeout      uint   `key:"HEALTH_STALL_TIMEOUT_IN_SECONDS"`
+	ShutdownTimeout         uint   `key:"SHUTDOWN_TIMEOUT_IN_SECONDS"`
+	RpcRecord               string `key:"RPC_RECORD"`
+	RpcReplay               string `key:"RPC_REPLAY"`
+	TracingExporter         string `key:"TRACING_EXPORTER"`
+	TracingEndpoint         string `key:"TRACING_ENDPOINT"`
+	LogLevel                string `key:"LOG_LEVEL"`
+	LogLevels               string `key:"LOG_LEVELS"`
+	LogFormat               string `key:"LOG_FORMAT"`
+	LogOutput               string `key:"LOG_OUTPUT"`
+	LogFile                 string `key:"LOG_FILE"`
+	LogRotationHours        uint   `key:"LOG_ROTATION_HOURS"`
+	LogRotationCount        uint   `key:"LOG_ROTATION_COUNT"`
 }
 
-func LoadConfig() (*Config, error) {
-	configFile, err := filepath.Abs(".env")
+const (
+	// EnvPrefix is the prefix of the environment variables which override the configuration files, e.g. EXPLORER_DB_HOST
+	EnvPrefix = "EXPLORER"
+	// FileSuffix marks a key whose value is read from the file it points to, e.g. DB_PASSWORD_FILE=/run/secrets/db_password
+	FileSuffix = "_FILE"
 
-	if err != nil {
-		return &Config{}, err
-	}
+	defaultConfigFile = ".env"
+	configFlag        = "config"
+)
 
-	err = read(configFile)
+// LoadConfig reads the configuration and parses the arguments with the flag set, which may already hold the flags of a command.
+// The values are taken, from the lowest to the highest priority, from the .env file, the file given with --config
+// (.env, .yaml, .yml or .toml), the environment variables prefixed with EXPLORER_ and the flags.
+func LoadConfig(flags *flag.FlagSet, args []string) (*Config, error) {
+	configFile := configFileArg(args)
+	if configFile == "" {
+		configFile = os.Getenv(EnvPrefix + "_CONFIG")
+	}
 
-	if err != nil {
+	if err := read(configFile); err != nil {
 		return &Config{}, err
 	}
 
 	config := &Config{}
-	config.fillConfigurations()
+	src := &source{}
+	flags.String(configFlag, configFile, "Configuration file (.env, .yaml, .yml or .toml) read on top of .env, also set by EXPLORER_CONFIG")
+	config.fillConfigurations(flags, src)
+	if err := flags.Parse(args); err != nil {
+		return &Config{}, err
+	}
+	if len(src.errs) != 0 {
+		return &Config{}, &ValidationError{Problems: src.errs}
+	}
 	config.fillDefaults()
 
 	return config, nil
 }
 
-// Read - Reading .env file content, during application start up
-func read(file string) error {
-	viper.SetConfigFile(file)
-	return viper.ReadInConfig()
+// files are the configuration files read by the last call to LoadConfig
+var files []string
+
+// read loads the .env file, if it exists, and merges the configuration file on top of it.
+func read(configFile string) error {
+	files = nil
+	viper.SetEnvPrefix(EnvPrefix)
+	viper.AutomaticEnv()
+
+	envFile, err := filepath.Abs(defaultConfigFile)
+	if err != nil {
+		return err
+	}
+	// the .env file is optional, the configuration can come from the environment only
+	if _, err := os.Stat(envFile); err == nil {
+		viper.SetConfigFile(envFile)
+		if err := viper.ReadInConfig(); err != nil {
+			return fmt.Errorf("cannot read %s: %w", envFile, err)
+		}
+		files = append(files, envFile)
+	}
+
+	if configFile != "" {
+		viper.SetConfigFile(configFile)
+		if err := viper.MergeInConfig(); err != nil {
+			return fmt.Errorf("cannot read %s: %w", configFile, err)
+		}
+		files = append(files, configFile)
+	}
+	return nil
+}
+
+// configFileArg returns the value of the --config flag, which is needed before the other flags get their defaults.
+func configFileArg(args []string) string {
+	for i, arg := range args {
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == configFlag && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(name, configFlag+"=") {
+			return strings.TrimPrefix(name, configFlag+"=")
+		}
+	}
+	return ""
+}
+
+// source reads the values of the configuration and collects the problems found while parsing them.
+// A *_FILE reference takes precedence over the value of the key itself.
+type source struct {
+	errs []string
+}
+
+func (s *source) getString(key string) string {
+	file := viper.GetString(key + FileSuffix)
+	if file == "" {
+		return viper.GetString(key)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Sprintf("%s%s: cannot read the secret file: %v", key, FileSuffix, err))
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+func (s *source) getUint(key string) uint {
+	return uint(s.getUint64(key))
+}
+
+func (s *source) getUint64(key string) uint64 {
+	value := strings.TrimSpace(viper.GetString(key))
+	if value == "" {
+		return 0
+	}
+	number, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Sprintf("%s: %q is not a non-negative integer", key, value))
+	}
+	return number
+}
+
+func (s *source) getBool(key string) bool {
+	value := strings.TrimSpace(viper.GetString(key))
+	if value == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Sprintf("%s: %q is not a boolean, use true or false", key, value))
+	}
+	return b
 }
 
-func (cfg *Config) fillConfigurations() {
-	flag.StringVar(&cfg.HTTPUrl, "http.addr", viper.GetString("HTTPUrl"), "Blockchain node HTTP address")
-	flag.StringVar(&cfg.WebSocketUrl, "ws.addr", viper.GetString("WebSocketUrl"), "Blockchain node WebSocket address")
-	flag.StringVar(&cfg.DbUser, "db.user", viper.GetString("DB_USER"), "Database user")
-	flag.StringVar(&cfg.DbPassword, "db.password", viper.GetString("DB_PASSWORD"), "Database user password")
-	flag.StringVar(&cfg.DbHost, "db.host", viper.GetString("DB_HOST"), "Database server host")
-	flag.StringVar(&cfg.DbPort, "db.port", viper.GetString("DB_PORT"), "Database server port")
-	flag.StringVar(&cfg.DbName, "db.name", viper.GetString("DB_NAME"), "Database name")
-	flag.StringVar(&cfg.DbSSL, "db.ssl", viper.GetString("DB_SSL"), "Enable (verify-full) or disable TLS")
-	flag.StringVar(&cfg.Mode, "mode", viper.GetString("MODE"), "Manual or automatic mode of application")
-	flag.UintVar(&cfg.WorkersCount, "workers", viper.GetUint("WORKERS_COUNT"), "Number of goroutines to use for fetching data from blockchain")
-	flag.UintVar(&cfg.Step, "step", viper.GetUint("STEP"), "Number of requests in one batch sent to the blockchain")
-	flag.UintVar(&cfg.CallTimeoutInSeconds, "timeout", viper.GetUint("CALL_TIMEOUT_IN_SECONDS"), "Sets a timeout used for requests sent to the blockchain")
-	flag.Uint64Var(&cfg.Checkpoint, "checkpoint", viper.GetUint64("CHECKPOINT"), "Sets the number of the starting block for synchronization and validation")
-	flag.UintVar(&cfg.CheckpointWindow, "checkpoint.window", viper.GetUint("CHECKPOINT_WINDOW"), "Sets after how many created blocks the checkpoint is determined")
-	flag.UintVar(&cfg.CheckpointDistance, "checkpoint.distance", viper.GetUint("CHECKPOINT_DISTANCE"), "Sets the checkpoint distance from the latest block on the blockchain")
-	flag.BoolVar(&cfg.EthLogs, "eth.logs", viper.GetBool("INCLUDE_ETH_LOGS"), "Include Ethereum Logs")
-	flag.BoolVar(&cfg.NFTs, "nfts", viper.GetBool("INCLUDE_NFTS"), "Include NFTs (to be included, logs must be included as well)")
-	flag.StringVar(&cfg.IPFSGatewayUrl, "ipfs.gateway", viper.GetString("IPFS_GATEWAY_URL"), "IPFS Gateway address")
-	flag.Parse()
+func (cfg *Config) fillConfigurations(flags *flag.FlagSet, src *source) {
+	flags.StringVar(&cfg.HTTPUrl, "http.addr", src.getString("HTTPUrl"), "Blockchain node HTTP address")
+	flags.StringVar(&cfg.WebSocketUrl, "ws.addr", src.getString("WebSocketUrl"), "Blockchain node WebSocket address")
+	flags.StringVar(&cfg.DbUser, "db.user", src.getString("DB_USER"), "Database user")
+	flags.StringVar(&cfg.DbPassword, "db.password", src.getString("DB_PASSWORD"), "Database user password")
+	flags.StringVar(&cfg.DbHost, "db.host", src.getString("DB_HOST"), "Database server host")
+	flags.StringVar(&cfg.DbPort, "db.port", src.getString("DB_PORT"), "Database server port")
+	flags.StringVar(&cfg.DbName, "db.name", src.getString("DB_NAME"), "Database name")
+	flags.StringVar(&cfg.DbSSL, "db.ssl", src.getString("DB_SSL"), "Enable (verify-full) or disable TLS")
+	flags.StringVar(&cfg.Mode, "mode", src.getString("MODE"), "Manual or automatic mode of application, used when no command is given")
+	flags.UintVar(&cfg.WorkersCount, "workers", src.getUint("WORKERS_COUNT"), "Number of goroutines to use for fetching data from blockchain")
+	flags.UintVar(&cfg.DecodeWorkersCount, "workers.decode", src.getUint("DECODE_WORKERS_COUNT"), "Number of goroutines converting the fetched blocks into database rows, defaults to the number of CPUs")
+	flags.UintVar(&cfg.PersistWorkersCount, "workers.persist", src.getUint("PERSIST_WORKERS_COUNT"), "Number of goroutines inserting the rows into the database")
+	flags.UintVar(&cfg.PipelineBuffer, "pipeline.buffer", src.getUint("PIPELINE_BUFFER"), "Number of batches each synchronization stage can get ahead of the next one, defaults to the number of workers")
+	flags.BoolVar(&cfg.OrderedCommits, "commits.ordered", src.getBool("ORDERED_COMMITS"), "Commits the blocks in block order, maintaining the contiguous watermark which lets the syncer skip scanning for gaps")
+	flags.UintVar(&cfg.Step, "step", src.getUint("STEP"), "Number of requests in one batch sent to the blockchain")
+	flags.UintVar(&cfg.CallTimeoutInSeconds, "timeout", src.getUint("CALL_TIMEOUT_IN_SECONDS"), "Sets a timeout used for requests sent to the blockchain")
+	flags.Uint64Var(&cfg.Checkpoint, "checkpoint", src.getUint64("CHECKPOINT"), "Sets the number of the starting block for synchronization and validation")
+	flags.UintVar(&cfg.CheckpointWindow, "checkpoint.window", src.getUint("CHECKPOINT_WINDOW"), "Sets after how many created blocks the checkpoint is determined")
+	flags.UintVar(&cfg.CheckpointDistance, "checkpoint.distance", src.getUint("CHECKPOINT_DISTANCE"), "Sets the checkpoint distance from the latest block on the blockchain")
+	flags.BoolVar(&cfg.EthLogs, "eth.logs", src.getBool("INCLUDE_ETH_LOGS"), "Include Ethereum Logs")
+	flags.BoolVar(&cfg.NFTs, "nfts", src.getBool("INCLUDE_NFTS"), "Include NFTs (to be included, logs must be included as well)")
+	flags.StringVar(&cfg.IPFSGatewayUrl, "ipfs.gateway", src.getString("IPFS_GATEWAY_URL"), "Comma separated list of IPFS gateway addresses")
+	flags.StringVar(&cfg.IPFSApiUrl, "ipfs.api", src.getString("IPFS_API_URL"), "Address of the HTTP API of an IPFS node, used along with the gateways")
+	flags.StringVar(&cfg.IPFSStrategy, "ipfs.strategy", src.getString("IPFS_STRATEGY"), "How IPFS requests are sent to the gateways: round-robin or race")
+	flags.UintVar(&cfg.IPFSRateLimit, "ipfs.rate", src.getUint("IPFS_RATE_LIMIT"), "Number of requests per second sent to every IPFS gateway (unlimited if 0)")
+	flags.BoolVar(&cfg.IPFSVerify, "ipfs.verify", src.getBool("IPFS_VERIFY"), "Reads IPFS files block by block and checks every block against its CID")
+	flags.UintVar(&cfg.NftMetadataWorkersCount, "nfts.workers", src.getUint("NFT_METADATA_WORKERS_COUNT"), "Number of goroutines fetching the queued NFT metadata")
+	flags.UintVar(&cfg.NftMetadataMaxAttempts, "nfts.attempts", src.getUint("NFT_METADATA_MAX_ATTEMPTS"), "Number of attempts to fetch the metadata of a token before its job is marked as failed")
+	flags.UintVar(&cfg.NftMetadataMaxSizeInKB, "nfts.size", src.getUint("NFT_METADATA_MAX_SIZE_IN_KB"), "Size in kilobytes of the largest NFT metadata document which is read")
+	flags.UintVar(&cfg.NftMetadataRedirects, "nfts.redirects", src.getUint("NFT_METADATA_MAX_REDIRECTS"), "Number of redirects followed when fetching NFT metadata and images")
+	flags.UintVar(&cfg.NftMetadataHostRequests, "nfts.concurrency", src.getUint("NFT_METADATA_HOST_CONCURRENCY"), "Number of concurrent requests sent to every NFT metadata host")
+	flags.StringVar(&cfg.NftMetadataUserAgent, "nfts.agent", src.getString("NFT_METADATA_USER_AGENT"), "User-Agent of the requests fetching NFT metadata and images")
+	flags.BoolVar(&cfg.NftMetadataAllowPrivate, "nfts.private", src.getBool("NFT_METADATA_ALLOW_PRIVATE"), "Allows fetching NFT metadata and images from private, loopback and link-local addresses")
+	flags.Uint64Var(&cfg.NftConsecutiveMaxTokens, "nfts.consecutive", src.getUint64("NFT_CONSECUTIVE_MAX_TOKENS"), "Number of tokens of the largest ERC-2309 ConsecutiveTransfer range which is stored as transfers, the larger ranges are stored as ranges")
+	flags.StringVar(&cfg.MediaStore, "media.store", src.getString("MEDIA_STORE"), "Store of the NFT images cache: local or s3 (disabled if empty)")
+	flags.StringVar(&cfg.MediaDir, "media.dir", src.getString("MEDIA_DIR"), "Directory of the local NFT images cache")
+	flags.UintVar(&cfg.MediaMaxSizeInMB, "media.size", src.getUint("MEDIA_MAX_SIZE_IN_MB"), "Size in megabytes of the largest NFT image which is cached")
+	flags.UintVar(&cfg.MediaThumbnailSize, "media.thumbnail", src.getUint("MEDIA_THUMBNAIL_SIZE"), "Size in pixels of the square the thumbnails of the NFT images fit in")
+	flags.StringVar(&cfg.MediaS3Endpoint, "media.s3.endpoint", src.getString("MEDIA_S3_ENDPOINT"), "Address of the S3-compatible object storage of the NFT images cache")
+	flags.StringVar(&cfg.MediaS3Bucket, "media.s3.bucket", src.getString("MEDIA_S3_BUCKET"), "Bucket of the NFT images cache")
+	flags.StringVar(&cfg.MediaS3Region, "media.s3.region", src.getString("MEDIA_S3_REGION"), "Region of the object storage")
+	flags.StringVar(&cfg.MediaS3AccessKey, "media.s3.key", src.getString("MEDIA_S3_ACCESS_KEY"), "Access key of the object storage")
+	flags.StringVar(&cfg.MediaS3SecretKey, "media.s3.secret", src.getString("MEDIA_S3_SECRET_KEY"), "Secret key of the object storage")
+	flags.BoolVar(&cfg.Webhooks, "webhooks", src.getBool("WEBHOOKS_ENABLED"), "Deliver matching transactions, logs and NFT transfers to the registered watches")
+	flags.UintVar(&cfg.WebhookMaxAttempts, "webhooks.attempts", src.getUint("WEBHOOK_MAX_ATTEMPTS"), "Number of delivery attempts before a webhook is moved to the dead letter table")
+	flags.UintVar(&cfg.WebhookTimeout, "webhooks.timeout", src.getUint("WEBHOOK_TIMEOUT_IN_SECONDS"), "Sets a timeout used for webhook requests")
+	flags.StringVar(&cfg.ServerAddr, "server.addr", src.getString("SERVER_ADDR"), "Address of the monitoring server exposing /metrics, /healthz and /readyz (disabled if empty)")
+	flags.StringVar(&cfg.AdminToken, "server.token", src.getString("ADMIN_TOKEN"), "Bearer token required by the admin endpoints of the monitoring server (disabled if empty)")
+	flags.UintVar(&cfg.HealthLagThreshold, "health.lag", src.getUint("HEALTH_LAG_THRESHOLD"), "Number of blocks the database can lag behind the blockchain before it is reported as not ready")
+	flags.UintVar(&cfg.HealthStallTimeout, "health.stall", src.getUint("HEALTH_STALL_TIMEOUT_IN_SECONDS"), "Sets after how many seconds without progress the application is reported as not alive")
+	flags.UintVar(&cfg.ShutdownTimeout, "shutdown.timeout", src.getUint("SHUTDOWN_TIMEOUT_IN_SECONDS"), "Sets how many seconds the jobs in progress have to finish after a shutdown signal")
+	flags.StringVar(&cfg.RpcRecord, "rpc.record", src.getString("RPC_RECORD"), "Records the requests sent to the blockchain node and the NFT metadata servers into this cassette file")
+	flags.StringVar(&cfg.RpcReplay, "rpc.replay", src.getString("RPC_REPLAY"), "Serves the requests from this cassette file instead of the blockchain node")
+	flags.StringVar(&cfg.TracingExporter, "tracing.exporter", src.getString("TRACING_EXPORTER"), "Exporter of OpenTelemetry spans: none, stdout or otlp")
+	flags.StringVar(&cfg.TracingEndpoint, "tracing.endpoint", src.getString("TRACING_ENDPOINT"), "OTLP HTTP endpoint receiving the spans, a host:port or URL reached over TLS unless it is an http:// URL, defaults to OTEL_EXPORTER_OTLP_ENDPOINT")
+	flags.StringVar(&cfg.LogLevel, "log.level", src.getString("LOG_LEVEL"), "Default log level: panic, fatal, error, warn, info, debug or trace")
+	flags.StringVar(&cfg.LogLevels, "log.levels", src.getString("LOG_LEVELS"), "Log levels of components (syncer, listener, eth, db, workers, webhooks) as a list of component=level pairs")
+	flags.StringVar(&cfg.LogFormat, "log.format", src.getString("LOG_FORMAT"), "Log format: text or json")
+	flags.StringVar(&cfg.LogOutput, "log.output", src.getString("LOG_OUTPUT"), "Log output: file or stdout")
+	flags.StringVar(&cfg.LogFile, "log.file", src.getString("LOG_FILE"), "Log file name pattern, with strftime placeholders for rotation")
+	flags.UintVar(&cfg.LogRotationHours, "log.rotation.hours", src.getUint("LOG_ROTATION_HOURS"), "Sets after how many hours the log file is rotated")
+	flags.UintVar(&cfg.LogRotationCount, "log.rotation.count", src.getUint("LOG_ROTATION_COUNT"), "Number of rotated log files to keep")
 }
 
 func (cfg *Config) fillDefaults() {
@@ -85,7 +286,110 @@ func (cfg *Config) fillDefaults() {
 		cfg.WorkersCount = 32
 	}
 
+	if cfg.DecodeWorkersCount == 0 {
+		cfg.DecodeWorkersCount = uint(runtime.NumCPU())
+	}
+
+	if cfg.PersistWorkersCount == 0 {
+		cfg.PersistWorkersCount = 4
+	}
+
+	if cfg.PipelineBuffer == 0 {
+		cfg.PipelineBuffer = cfg.WorkersCount
+	}
+
 	if cfg.Checkpoint == 0 {
 		cfg.Checkpoint = 1
 	}
+
+	if cfg.NftMetadataWorkersCount == 0 {
+		cfg.NftMetadataWorkersCount = 4
+	}
+
+	if cfg.NftMetadataMaxAttempts == 0 {
+		cfg.NftMetadataMaxAttempts = 5
+	}
+
+	if cfg.NftMetadataMaxSizeInKB == 0 {
+		cfg.NftMetadataMaxSizeInKB = 1024
+	}
+
+	if cfg.NftMetadataRedirects == 0 {
+		cfg.NftMetadataRedirects = 5
+	}
+
+	if cfg.NftMetadataHostRequests == 0 {
+		cfg.NftMetadataHostRequests = 4
+	}
+
+	if cfg.NftMetadataUserAgent == "" {
+		cfg.NftMetadataUserAgent = "ethernal-explorer"
+	}
+
+	if cfg.NftConsecutiveMaxTokens == 0 {
+		cfg.NftConsecutiveMaxTokens = 10000
+	}
+
+	if cfg.IPFSStrategy == "" {
+		cfg.IPFSStrategy = "round-robin"
+	}
+
+	if cfg.MediaDir == "" {
+		cfg.MediaDir = "media"
+	}
+
+	if cfg.MediaMaxSizeInMB == 0 {
+		cfg.MediaMaxSizeInMB = 20
+	}
+
+	if cfg.MediaThumbnailSize == 0 {
+		cfg.MediaThumbnailSize = 256
+	}
+
+	if cfg.MediaS3Region == "" {
+		cfg.MediaS3Region = "us-east-1"
+	}
+
+	if cfg.WebhookMaxAttempts == 0 {
+		cfg.WebhookMaxAttempts = 5
+	}
+
+	if cfg.WebhookTimeout == 0 {
+		cfg.WebhookTimeout = 10
+	}
+
+	if cfg.HealthLagThreshold == 0 {
+		cfg.HealthLagThreshold = 100
+	}
+
+	if cfg.HealthStallTimeout == 0 {
+		cfg.HealthStallTimeout = 600
+	}
+
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = 30
+	}
+
+	if cfg.LogFile == "" {
+		cfg.LogFile = "logs/logfile.%Y.%m.%d"
+	}
+
+	if cfg.LogRotationHours == 0 {
+		cfg.LogRotationHours = 7 * 24
+	}
+
+	if cfg.LogRotationCount == 0 {
+		cfg.LogRotationCount = 4
+	}
+}
+
+// IPFSGateways returns the addresses of the IPFS gateways, listed in IPFSGatewayUrl
+func (cfg *Config) IPFSGateways() []string {
+	gateways := []string{}
+	for _, gateway := range strings.Split(cfg.IPFSGatewayUrl, ",") {
+		if gateway = strings.TrimSpace(gateway); gateway != "" {
+			gateways = append(gateways, gateway)
+		}
+	}
+	return gateways
 }
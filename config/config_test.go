@@ -0,0 +1,75 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// load reads the configuration with the arguments from a clean state, there is no .env file in the package directory
+func load(t *testing.T, args ...string) (*Config, error) {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(&strings.Builder{})
+	return LoadConfig(flags, args)
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	file := writeFile(t, "explorer.yaml", "DB_HOST: file\nDB_NAME: file\nDB_USER: file\nSTEP: 10\n")
+	t.Setenv("EXPLORER_DB_HOST", "env")
+	t.Setenv("EXPLORER_DB_NAME", "env")
+
+	cfg, err := load(t, "--config", file, "--db.host", "flag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		key, value, expected string
+	}{
+		{"DB_HOST", cfg.DbHost, "flag"},
+		{"DB_NAME", cfg.DbName, "env"},
+		{"DB_USER", cfg.DbUser, "file"},
+	}
+	for _, test := range tests {
+		if test.value != test.expected {
+			t.Errorf("%s is %q, expected the %s value", test.key, test.value, test.expected)
+		}
+	}
+	if cfg.Step != 10 || cfg.WorkersCount != 32 {
+		t.Errorf("STEP is %d and WORKERS_COUNT %d, expected the file value 10 and the default 32", cfg.Step, cfg.WorkersCount)
+	}
+}
+
+func TestLoadConfigSecretFile(t *testing.T) {
+	t.Setenv("EXPLORER_DB_PASSWORD", "ignored")
+	t.Setenv("EXPLORER_DB_PASSWORD_FILE", writeFile(t, "db_password", "  s3cret\n"))
+	cfg, err := load(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DbPassword != "s3cret" {
+		t.Fatalf("DB_PASSWORD is %q, expected the trimmed content of the secret file", cfg.DbPassword)
+	}
+
+	t.Setenv("EXPLORER_DB_PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+	var validationErr *ValidationError
+	if _, err := load(t); !errors.As(err, &validationErr) || !strings.Contains(err.Error(), "DB_PASSWORD_FILE") {
+		t.Fatalf("loaded a missing secret file with %v, expected a ValidationError", err)
+	}
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const redacted = "****"
+
+// Print writes the effective configuration as YAML, which can be used as a configuration file.
+// Passwords are replaced and URLs, also the ones of a comma separated list, keep only their scheme and host, as API keys are often part of their path.
+func (cfg *Config) Print(w io.Writer) {
+	value := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		key := field.Tag.Get("key")
+		if key == "" {
+			continue
+		}
+
+		fmt.Fprintf(w, "%s: %s\n", key, printedValue(field, value.Field(i)))
+	}
+}
+
+// printedValue returns the value of the field with the secrets redacted, strings are quoted
+func printedValue(field reflect.StructField, value reflect.Value) string {
+	v, ok := value.Interface().(string)
+	if !ok {
+		return fmt.Sprint(value.Interface())
+	}
+
+	switch field.Tag.Get("secret") {
+	case "true":
+		if v != "" {
+			v = redacted
+		}
+	case "url":
+		v = redactUrl(v)
+	case "urls":
+		addresses := strings.Split(v, ",")
+		for i, address := range addresses {
+			addresses[i] = redactUrl(strings.TrimSpace(address))
+		}
+		v = strings.Join(addresses, ",")
+	}
+	return strconv.Quote(v)
+}
+
+// redactUrl removes the credentials, the path and the query of the URL
+func redactUrl(address string) string {
+	parsed, err := url.Parse(address)
+	if err != nil || parsed.Host == "" {
+		if address == "" {
+			return ""
+		}
+		return redacted
+	}
+
+	result := parsed.Scheme + "://" + parsed.Host
+	if parsed.User != nil || (parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" {
+		result += "/" + redacted
+	}
+	return result
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	cfg := &Config{}
+	value := reflect.ValueOf(cfg).Elem()
+	secrets := []string{}
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		secret := fmt.Sprintf("secret%d", i)
+		switch field.Tag.Get("secret") {
+		case "true":
+			value.Field(i).SetString(secret)
+		case "url":
+			value.Field(i).SetString("https://user:" + secret + "@host.example/" + secret + "?key=" + secret)
+		case "urls":
+			value.Field(i).SetString("https://first.example/" + secret + "a, https://second.example/ipfs?key=" + secret + "b")
+		default:
+			continue
+		}
+		secrets = append(secrets, secret)
+	}
+	if len(secrets) == 0 {
+		t.Fatal("no secret field")
+	}
+
+	output := &strings.Builder{}
+	cfg.Print(output)
+	for _, secret := range secrets {
+		if strings.Contains(output.String(), secret) {
+			t.Fatalf("printed configuration contains %s:\n%s", secret, output.String())
+		}
+	}
+	if !strings.Contains(output.String(), `"https://host.example/****"`) {
+		t.Fatalf("printed configuration does not keep the host of the URLs:\n%s", output.String())
+	}
+}
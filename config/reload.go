@@ -0,0 +1,180 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// tunableKeys are the settings which can be changed without a restart, they are applied to the next synchronization run
+var tunableKeys = map[string]bool{
+	"WORKERS_COUNT":                 true,
+	"DECODE_WORKERS_COUNT":          true,
+	"PERSIST_WORKERS_COUNT":         true,
+	"PIPELINE_BUFFER":               true,
+	"STEP":                          true,
+	"CALL_TIMEOUT_IN_SECONDS":       true,
+	"IPFS_GATEWAY_URL":              true,
+	"IPFS_API_URL":                  true,
+	"IPFS_STRATEGY":                 true,
+	"IPFS_RATE_LIMIT":               true,
+	"IPFS_VERIFY":                   true,
+	"NFT_METADATA_MAX_SIZE_IN_KB":   true,
+	"NFT_METADATA_MAX_REDIRECTS":    true,
+	"NFT_METADATA_HOST_CONCURRENCY": true,
+	"NFT_METADATA_USER_AGENT":       true,
+	"NFT_METADATA_ALLOW_PRIVATE":    true,
+	"NFT_CONSECUTIVE_MAX_TOKENS":    true,
+}
+
+// tunableKeyNames returns the sorted keys of the settings which can be changed without a restart
+func tunableKeyNames() []string {
+	keys := make([]string, 0, len(tunableKeys))
+	for key := range tunableKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// editors write a file in several steps, the reload waits until the events stop
+const reloadDelay = 500 * time.Millisecond
+
+type reloader struct {
+	load    func() (*Config, error)
+	initial Config
+	lock    sync.Mutex
+	// pending is the reloaded configuration whose tunables are not applied yet
+	pending *Config
+}
+
+var reloaderInstance *reloader
+
+// Watch reloads the configuration with load when one of the configuration files changes or on SIGHUP, until ctx is cancelled.
+// The tunable settings are applied by ApplyReloaded, changes of the other settings are logged and ignored until a restart.
+func Watch(ctx context.Context, config *Config, load func() (*Config, error)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	// the directories are watched, as editors often replace the file instead of writing it
+	watched := map[string]bool{}
+	for _, file := range files {
+		watched[filepath.Clean(file)] = true
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			watcher.Close()
+			return err
+		}
+	}
+
+	r := &reloader{load: load, initial: *config}
+	reloaderInstance = r
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	go func() {
+		defer watcher.Close()
+		defer signal.Stop(hangup)
+
+		var changed <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				r.reload("SIGHUP")
+			case event := <-watcher.Events:
+				if watched[filepath.Clean(event.Name)] && event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+					changed = time.After(reloadDelay)
+				}
+			case <-changed:
+				changed = nil
+				r.reload("file changed")
+			case err := <-watcher.Errors:
+				logrus.Error("Error while watching the configuration files, err: ", err)
+			}
+		}
+	}()
+
+	logrus.WithField("files", files).Info("Watching the configuration for changes")
+	return nil
+}
+
+func (r *reloader) reload(reason string) {
+	next, err := r.load()
+	if err != nil {
+		logrus.WithField("reason", reason).Error("Configuration not reloaded, err: ", err)
+		return
+	}
+
+	for _, key := range changedKeys(&r.initial, next) {
+		if !tunableKeys[key] {
+			logrus.WithField("key", key).Warn("Change of ", key, " ignored until a restart, only ", strings.Join(tunableKeyNames(), ", "), " are applied while running")
+		}
+	}
+
+	r.lock.Lock()
+	r.pending = next
+	r.lock.Unlock()
+	logrus.WithField("reason", reason).Info("Configuration reloaded, the tunable settings are applied to the next synchronization")
+}
+
+// ApplyReloaded copies the tunable settings of the last reloaded configuration.
+// It is called at the start of every synchronization run, when no job uses them.
+func (cfg *Config) ApplyReloaded() {
+	r := reloaderInstance
+	if r == nil {
+		return
+	}
+
+	r.lock.Lock()
+	next := r.pending
+	r.pending = nil
+	r.lock.Unlock()
+	if next == nil {
+		return
+	}
+
+	current := reflect.ValueOf(cfg).Elem()
+	reloaded := reflect.ValueOf(next).Elem()
+	for i := 0; i < current.NumField(); i++ {
+		field := current.Type().Field(i)
+		key := field.Tag.Get("key")
+		if !tunableKeys[key] || reflect.DeepEqual(current.Field(i).Interface(), reloaded.Field(i).Interface()) {
+			continue
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"key":  key,
+			"from": printedValue(field, current.Field(i)),
+			"to":   printedValue(field, reloaded.Field(i)),
+		}).Info("Setting changed")
+		current.Field(i).Set(reloaded.Field(i))
+	}
+}
+
+// changedKeys returns the keys of the settings whose values differ
+func changedKeys(a *Config, b *Config) []string {
+	keys := []string{}
+	first := reflect.ValueOf(a).Elem()
+	second := reflect.ValueOf(b).Elem()
+	for i := 0; i < first.NumField(); i++ {
+		key := first.Type().Field(i).Tag.Get("key")
+		if key != "" && !reflect.DeepEqual(first.Field(i).Interface(), second.Field(i).Interface()) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
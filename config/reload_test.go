@@ -0,0 +1,98 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// watch installs a reloader of cfg as Watch does, without watching the files
+func watch(t *testing.T, cfg *Config, load func() (*Config, error)) *reloader {
+	t.Helper()
+	r := &reloader{load: load, initial: *cfg}
+	reloaderInstance = r
+	t.Cleanup(func() { reloaderInstance = nil })
+	return r
+}
+
+func TestReloadAppliesTunables(t *testing.T) {
+	cfg := validConfig()
+	next := *cfg
+	next.WorkersCount = 8
+	r := watch(t, cfg, func() (*Config, error) { return &next, nil })
+
+	r.reload("test")
+	if cfg.WorkersCount != 4 {
+		t.Fatalf("WORKERS_COUNT changed to %d before ApplyReloaded", cfg.WorkersCount)
+	}
+	cfg.ApplyReloaded()
+	if cfg.WorkersCount != 8 {
+		t.Fatalf("WORKERS_COUNT is %d after ApplyReloaded, expected the reloaded 8", cfg.WorkersCount)
+	}
+
+	// the reloaded configuration is applied once
+	cfg.WorkersCount = 2
+	cfg.ApplyReloaded()
+	if cfg.WorkersCount != 2 {
+		t.Fatalf("WORKERS_COUNT is %d after a second ApplyReloaded, expected 2", cfg.WorkersCount)
+	}
+}
+
+func TestReloadIgnoresOtherSettings(t *testing.T) {
+	hook := test.NewGlobal()
+	t.Cleanup(hook.Reset)
+
+	cfg := validConfig()
+	next := *cfg
+	next.DbHost = "other"
+	r := watch(t, cfg, func() (*Config, error) { return &next, nil })
+
+	r.reload("test")
+	cfg.ApplyReloaded()
+	if cfg.DbHost != "localhost" {
+		t.Fatalf("DB_HOST changed to %q while running", cfg.DbHost)
+	}
+	warned := false
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel && entry.Data["key"] == "DB_HOST" {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Fatal("ignored change of DB_HOST not logged as a warning")
+	}
+}
+
+func TestReloadFailureKeepsConfig(t *testing.T) {
+	hook := test.NewGlobal()
+	t.Cleanup(hook.Reset)
+
+	cfg := validConfig()
+	initial := *cfg
+	r := watch(t, cfg, func() (*Config, error) { return nil, errors.New("invalid configuration") })
+
+	r.reload("test")
+	cfg.ApplyReloaded()
+	if !reflect.DeepEqual(*cfg, initial) {
+		t.Fatalf("configuration changed by a failed reload: %+v", *cfg)
+	}
+	if entry := hook.LastEntry(); entry == nil || entry.Level != logrus.ErrorLevel {
+		t.Fatal("failed reload not logged as an error")
+	}
+}
+
+func TestTunableKeysExist(t *testing.T) {
+	keys := map[string]bool{}
+	fields := reflect.TypeOf(Config{})
+	for i := 0; i < fields.NumField(); i++ {
+		keys[fields.Field(i).Tag.Get("key")] = true
+	}
+	for _, key := range tunableKeyNames() {
+		if !keys[key] {
+			t.Errorf("tunable %s is not the key of a setting", key)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"errors"
+	"ethernal/explorer/common"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ValidationError lists every problem found in the configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// Validate checks the whole configuration and reports all problems at once, before anything is dialed.
+// The blockchain node addresses are required only if node is set, for commands which do not need them.
+func (cfg *Config) Validate(node bool) error {
+	problems := []string{}
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if cfg.DbHost == "" {
+		problem("DB_HOST (--db.host) is required")
+	}
+	if cfg.DbName == "" {
+		problem("DB_NAME (--db.name) is required")
+	}
+	if cfg.DbUser == "" {
+		problem("DB_USER (--db.user) is required")
+	}
+	if port, err := strconv.ParseUint(cfg.DbPort, 10, 16); cfg.DbPort != "" && (err != nil || port == 0) {
+		problem("DB_PORT (--db.port) %q is not a valid port", cfg.DbPort)
+	}
+	if cfg.DbSSL != "" && !contains(sslModes, cfg.DbSSL) {
+		problem("DB_SSL (--db.ssl) %q is not one of %s", cfg.DbSSL, strings.Join(sslModes, ", "))
+	}
+
+	if cfg.Mode != "" && cfg.Mode != common.Manual && cfg.Mode != common.Automatic {
+		problem("MODE (--mode) %q is not %s or %s", cfg.Mode, common.Manual, common.Automatic)
+	}
+	if cfg.RpcRecord != "" && cfg.RpcReplay != "" {
+		problem("RPC_RECORD (--rpc.record) and RPC_REPLAY (--rpc.replay) cannot be used together")
+	}
+	if cfg.RpcReplay != "" && cfg.Mode == common.Automatic {
+		problem("RPC_REPLAY (--rpc.replay) cannot follow new blocks (automatic mode), replay the range with the sync command")
+	}
+	if node {
+		if cfg.HTTPUrl == "" {
+			if cfg.RpcReplay == "" {
+				problem("HTTPUrl (--http.addr) is required")
+			}
+		} else if err := checkUrl(cfg.HTTPUrl, "http", "https"); err != nil {
+			problem("HTTPUrl (--http.addr) %v", err)
+		}
+		if cfg.Mode == common.Automatic && cfg.WebSocketUrl == "" {
+			problem("WebSocketUrl (--ws.addr) is required to follow new blocks (automatic mode)")
+		}
+	}
+	if cfg.WebSocketUrl != "" {
+		if err := checkUrl(cfg.WebSocketUrl, "ws", "wss"); err != nil {
+			problem("WebSocketUrl (--ws.addr) %v", err)
+		}
+	}
+
+	if cfg.WorkersCount == 0 {
+		problem("WORKERS_COUNT (--workers) must be greater than 0")
+	}
+	if cfg.Step == 0 {
+		problem("STEP (--step) must be greater than 0")
+	}
+	if cfg.CallTimeoutInSeconds == 0 {
+		problem("CALL_TIMEOUT_IN_SECONDS (--timeout) must be greater than 0")
+	}
+	if cfg.Mode == common.Automatic && cfg.CheckpointWindow == 0 {
+		problem("CHECKPOINT_WINDOW (--checkpoint.window) must be greater than 0 in automatic mode")
+	}
+	if cfg.Mode == common.Automatic && cfg.CheckpointDistance >= cfg.CheckpointWindow {
+		problem("CHECKPOINT_DISTANCE (--checkpoint.distance) %d must be lower than CHECKPOINT_WINDOW (--checkpoint.window) %d", cfg.CheckpointDistance, cfg.CheckpointWindow)
+	}
+
+	if cfg.NFTs && !cfg.EthLogs {
+		problem("INCLUDE_NFTS (--nfts) requires INCLUDE_ETH_LOGS (--eth.logs), NFT transfers are parsed from the logs")
+	}
+	if cfg.NFTs && len(cfg.IPFSGateways()) == 0 && cfg.IPFSApiUrl == "" {
+		problem("IPFS_GATEWAY_URL (--ipfs.gateway) or IPFS_API_URL (--ipfs.api) is required to fetch NFT metadata")
+	}
+	for _, gateway := range cfg.IPFSGateways() {
+		if err := checkUrl(gateway, "http", "https"); err != nil {
+			problem("IPFS_GATEWAY_URL (--ipfs.gateway) %v", err)
+		}
+	}
+	if cfg.IPFSApiUrl != "" {
+		if err := checkUrl(cfg.IPFSApiUrl, "http", "https"); err != nil {
+			problem("IPFS_API_URL (--ipfs.api) %v", err)
+		}
+	}
+	switch cfg.IPFSStrategy {
+	case "", "round-robin", "race":
+	default:
+		problem("IPFS_STRATEGY (--ipfs.strategy) %q is not round-robin or race", cfg.IPFSStrategy)
+	}
+
+	switch cfg.MediaStore {
+	case "", "local":
+	case "s3":
+		if cfg.MediaS3Endpoint == "" {
+			problem("MEDIA_S3_ENDPOINT (--media.s3.endpoint) is required by the s3 media store")
+		} else if err := checkUrl(cfg.MediaS3Endpoint, "http", "https"); err != nil {
+			problem("MEDIA_S3_ENDPOINT (--media.s3.endpoint) %v", err)
+		}
+		if cfg.MediaS3Bucket == "" {
+			problem("MEDIA_S3_BUCKET (--media.s3.bucket) is required by the s3 media store")
+		}
+	default:
+		problem("MEDIA_STORE (--media.store) %q is not local or s3", cfg.MediaStore)
+	}
+
+	if cfg.ServerAddr != "" {
+		if _, _, err := net.SplitHostPort(cfg.ServerAddr); err != nil {
+			problem("SERVER_ADDR (--server.addr) %q is not a host:port address", cfg.ServerAddr)
+		}
+	}
+	switch cfg.TracingExporter {
+	case "", "none", "stdout", "otlp":
+	default:
+		problem("TRACING_EXPORTER (--tracing.exporter) %q is not none, stdout or otlp", cfg.TracingExporter)
+	}
+
+	if cfg.LogLevel != "" {
+		if _, err := logrus.ParseLevel(cfg.LogLevel); err != nil {
+			problem("LOG_LEVEL (--log.level) %q is not a log level", cfg.LogLevel)
+		}
+	}
+	switch cfg.LogFormat {
+	case "", "text", "json":
+	default:
+		problem("LOG_FORMAT (--log.format) %q is not text or json", cfg.LogFormat)
+	}
+	switch cfg.LogOutput {
+	case "", "file", "stdout":
+	default:
+		problem("LOG_OUTPUT (--log.output) %q is not file or stdout", cfg.LogOutput)
+	}
+
+	if len(problems) != 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// checkUrl checks that the address is an absolute URL with one of the schemes
+func checkUrl(address string, schemes ...string) error {
+	// the parse error is not reported, as it contains the address with its credentials
+	parsed, err := url.Parse(address)
+	if err != nil {
+		return errors.New("is not a valid URL")
+	}
+	if !contains(schemes, parsed.Scheme) || parsed.Host == "" {
+		return fmt.Errorf("must be an absolute %s URL, e.g. %s://host:port", strings.Join(schemes, " or "), schemes[0])
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
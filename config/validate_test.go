@@ -0,0 +1,81 @@
+package config
+
+import (
+	"errors"
+	"ethernal/explorer/common"
+	"strings"
+	"testing"
+)
+
+func validConfig() *Config {
+	return &Config{
+		HTTPUrl:              "http://localhost:8545",
+		DbUser:               "explorer",
+		DbHost:               "localhost",
+		DbPort:               "5432",
+		DbName:               "explorer",
+		WorkersCount:         4,
+		Step:                 10,
+		CallTimeoutInSeconds: 5,
+		Mode:                 common.Manual,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := validConfig().Validate(true); err != nil {
+		t.Fatalf("valid configuration rejected with %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		change  func(cfg *Config)
+		node    bool
+		problem string
+	}{
+		{"missing database host", func(cfg *Config) { cfg.DbHost = "" }, false, "DB_HOST (--db.host) is required"},
+		{"invalid database port", func(cfg *Config) { cfg.DbPort = "70000" }, false, "DB_PORT (--db.port) \"70000\" is not a valid port"},
+		{"invalid ssl mode", func(cfg *Config) { cfg.DbSSL = "on" }, false, "DB_SSL (--db.ssl) \"on\" is not one of"},
+		{"unknown mode", func(cfg *Config) { cfg.Mode = "fast" }, false, "MODE (--mode) \"fast\" is not"},
+		{"missing node", func(cfg *Config) { cfg.HTTPUrl = "" }, true, "HTTPUrl (--http.addr) is required"},
+		{"node not needed", func(cfg *Config) { cfg.HTTPUrl = "" }, false, ""},
+		{"node url scheme", func(cfg *Config) { cfg.HTTPUrl = "ws://localhost:8546" }, true, "HTTPUrl (--http.addr) must be an absolute http or https URL"},
+		{"automatic mode without websocket", func(cfg *Config) { cfg.Mode = common.Automatic; cfg.CheckpointWindow = 10 }, true, "WebSocketUrl (--ws.addr) is required"},
+		{"websocket url scheme", func(cfg *Config) { cfg.WebSocketUrl = "http://localhost:8546" }, false, "WebSocketUrl (--ws.addr) must be an absolute ws or wss URL"},
+		{"no workers", func(cfg *Config) { cfg.WorkersCount = 0 }, false, "WORKERS_COUNT (--workers) must be greater than 0"},
+		{"checkpoint distance", func(cfg *Config) {
+			cfg.Mode, cfg.WebSocketUrl, cfg.CheckpointWindow, cfg.CheckpointDistance = common.Automatic, "ws://localhost:8546", 10, 10
+		}, false, "CHECKPOINT_DISTANCE (--checkpoint.distance) 10 must be lower than CHECKPOINT_WINDOW"},
+		{"nfts without logs", func(cfg *Config) { cfg.NFTs, cfg.IPFSGatewayUrl = true, "https://ipfs.io" }, false, "INCLUDE_NFTS (--nfts) requires INCLUDE_ETH_LOGS"},
+		{"server address", func(cfg *Config) { cfg.ServerAddr = "9090" }, false, "SERVER_ADDR (--server.addr) \"9090\" is not a host:port address"},
+		{"tracing exporter", func(cfg *Config) { cfg.TracingExporter = "jaeger" }, false, "TRACING_EXPORTER (--tracing.exporter) \"jaeger\""},
+		{"log level", func(cfg *Config) { cfg.LogLevel = "verbose" }, false, "LOG_LEVEL (--log.level) \"verbose\" is not a log level"},
+		{"log format", func(cfg *Config) { cfg.LogFormat = "xml" }, false, "LOG_FORMAT (--log.format) \"xml\" is not text or json"},
+		{"log output", func(cfg *Config) { cfg.LogOutput = "syslog" }, false, "LOG_OUTPUT (--log.output) \"syslog\" is not file or stdout"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := validConfig()
+			test.change(cfg)
+			err := cfg.Validate(test.node)
+			if test.problem == "" {
+				if err != nil {
+					t.Fatalf("rejected with %v", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || len(validationErr.Problems) != 1 || !strings.Contains(validationErr.Problems[0], test.problem) {
+				t.Fatalf("rejected with %v, expected the problem %q", err, test.problem)
+			}
+		})
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	cfg := validConfig()
+	cfg.DbHost, cfg.Step, cfg.LogFormat = "", 0, "xml"
+	var validationErr *ValidationError
+	if err := cfg.Validate(false); !errors.As(err, &validationErr) || len(validationErr.Problems) != 3 {
+		t.Fatalf("rejected with %v, expected 3 problems", err)
+	}
+}
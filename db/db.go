@@ -3,7 +3,11 @@ package db
 import (
 	"context"
 	"database/sql"
+	"ethernal/explorer/common"
 	"ethernal/explorer/config"
+	"ethernal/explorer/loger"
+	"ethernal/explorer/metrics"
+	"ethernal/explorer/tracing"
 	"fmt"
 	"time"
 
@@ -14,6 +18,8 @@ import (
 	"github.com/uptrace/bun/driver/pgdriver"
 )
 
+var logger = loger.Get(loger.Db)
+
 func InitDb(config *config.Config) *bun.DB {
 
 	connString := fmt.Sprintf("postgresql://%s:%s@%s:%s/%s?sslmode=%s",
@@ -23,61 +29,117 @@ func InitDb(config *config.Config) *bun.DB {
 
 	err := sqldb.Ping()
 	if err != nil {
-		logrus.Panic("Cannot connect to DB, err: ", err)
+		logger.Panic("Cannot connect to DB, err: ", err)
 	}
 
 	db := bun.NewDB(sqldb, pgdialect.New())
 
 	db.AddQueryHook(logrusbun.NewQueryHook(logrusbun.QueryHookOptions{
-		Logger:     logrus.StandardLogger(),
+		Logger:     loger.Logger(loger.Db),
 		QueryLevel: logrus.DebugLevel,
 		ErrorLevel: logrus.ErrorLevel,
 		SlowLevel:  logrus.WarnLevel,
 	}))
+	db.AddQueryHook(metrics.QueryHook{})
+	db.AddQueryHook(tracing.QueryHook{})
 
 	ctx := context.Background()
 	if _, err := db.NewCreateTable().Model((*Block)(nil)).IfNotExists().Exec(ctx); err != nil {
-		logrus.Panic("Error while creating the table Block, err: ", err)
+		logger.Panic("Error while creating the table Block, err: ", err)
 	}
 
 	if _, err := db.NewCreateTable().Model((*Transaction)(nil)).IfNotExists().Exec(ctx); err != nil {
-		logrus.Panic("Error while creating the table Transaction, err: ", err)
+		logger.Panic("Error while creating the table Transaction, err: ", err)
 	}
 
 	if _, err := db.NewCreateTable().Model((*Contract)(nil)).IfNotExists().Exec(ctx); err != nil {
-		logrus.Panic("Error while creating the table Contract, err: ", err)
+		logger.Panic("Error while creating the table Contract, err: ", err)
 	}
 
 	if _, err := db.NewCreateTable().Model((*Log)(nil)).IfNotExists().Exec(ctx); err != nil {
-		logrus.Panic("Error while creating the table Log, err: ", err)
+		logger.Panic("Error while creating the table Log, err: ", err)
 	}
 
 	if _, err := db.NewCreateTable().Model((*AbiType)(nil)).IfNotExists().Exec(ctx); err != nil {
-		logrus.Panic("Error while creating the table AbiType, err: ", err)
+		logger.Panic("Error while creating the table AbiType, err: ", err)
 	}
 
 	if _, err := db.NewCreateTable().Model((*Abi)(nil)).IfNotExists().Exec(ctx); err != nil {
-		logrus.Panic("Error while creating the table Abi, err: ", err)
+		logger.Panic("Error while creating the table Abi, err: ", err)
 	}
 
 	if _, err := db.NewCreateTable().Model((*TokenType)(nil)).IfNotExists().Exec(ctx); err != nil {
-		logrus.Panic("Error while creating the table TokenType, err: ", err)
+		logger.Panic("Error while creating the table TokenType, err: ", err)
 	}
 
 	if _, err := db.NewCreateTable().Model((*NftMetadata)(nil)).IfNotExists().Exec(ctx); err != nil {
-		logrus.Panic("Error while creating the table NftMetadata, err: ", err)
+		logger.Panic("Error while creating the table NftMetadata, err: ", err)
 	}
 
 	if _, err := db.NewCreateTable().Model((*NftTransfer)(nil)).IfNotExists().Exec(ctx); err != nil {
-		logrus.Panic("Error while creating the table NftTransfer, err: ", err)
+		logger.Panic("Error while creating the table NftTransfer, err: ", err)
+	}
+
+	if _, err := db.NewCreateTable().Model((*NftTransferRange)(nil)).IfNotExists().Exec(ctx); err != nil {
+		logger.Panic("Error while creating the table NftTransferRange, err: ", err)
+	}
+
+	if _, err := db.NewCreateTable().Model((*NftLock)(nil)).IfNotExists().Exec(ctx); err != nil {
+		logger.Panic("Error while creating the table NftLock, err: ", err)
+	}
+
+	if _, err := db.NewCreateTable().Model((*TokenBoundAccount)(nil)).IfNotExists().Exec(ctx); err != nil {
+		logger.Panic("Error while creating the table TokenBoundAccount, err: ", err)
 	}
 
 	if _, err := db.NewCreateTable().Model((*NftMetadataAttribute)(nil)).IfNotExists().Exec(ctx); err != nil {
-		logrus.Panic("Error while creating the table NftMetadataAttribute, err: ", err)
+		logger.Panic("Error while creating the table NftMetadataAttribute, err: ", err)
+	}
+
+	if _, err := db.NewCreateTable().Model((*NftMetadataVersion)(nil)).IfNotExists().Exec(ctx); err != nil {
+		logger.Panic("Error while creating the table NftMetadataVersion, err: ", err)
+	}
+
+	if _, err := db.NewCreateTable().Model((*NftMetadataJob)(nil)).IfNotExists().Exec(ctx); err != nil {
+		logger.Panic("Error while creating the table NftMetadataJob, err: ", err)
+	}
+
+	if _, err := db.NewCreateTable().Model((*NftHolder)(nil)).IfNotExists().Exec(ctx); err != nil {
+		logger.Panic("Error while creating the table NftHolder, err: ", err)
+	}
+
+	if _, err := db.NewCreateTable().Model((*NftCollection)(nil)).IfNotExists().Exec(ctx); err != nil {
+		logger.Panic("Error while creating the table NftCollection, err: ", err)
+	}
+
+	if _, err := db.NewCreateTable().Model((*Watch)(nil)).IfNotExists().Exec(ctx); err != nil {
+		logger.Panic("Error while creating the table Watch, err: ", err)
+	}
+
+	if _, err := db.NewCreateTable().Model((*WebhookDelivery)(nil)).IfNotExists().Exec(ctx); err != nil {
+		logger.Panic("Error while creating the table WebhookDelivery, err: ", err)
+	}
+
+	if _, err := db.NewCreateTable().Model((*WebhookDeadLetter)(nil)).IfNotExists().Exec(ctx); err != nil {
+		logger.Panic("Error while creating the table WebhookDeadLetter, err: ", err)
+	}
+
+	if _, err := db.NewCreateTable().Model((*SyncState)(nil)).IfNotExists().Exec(ctx); err != nil {
+		logger.Panic("Error while creating the table SyncState, err: ", err)
 	}
 	return db
 }
 
+// addColumns adds the columns, given as "<name> <type>", which are missing in a table created by an older version
+func addColumns(ctx context.Context, idb bun.IDB, table string, columns ...string) error {
+	for _, column := range columns {
+		if _, err := idb.ExecContext(ctx, "ALTER TABLE "+table+" ADD COLUMN IF NOT EXISTS "+column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ---------------Contract Table---------------------------------
 var _ bun.BeforeCreateTableHook = (*Contract)(nil)
 
@@ -113,7 +175,7 @@ func (*AbiType) AfterCreateTable(ctx context.Context, query *bun.CreateTableQuer
 	count, err := query.DB().NewSelect().Model(&AbiType{}).Count(ctx)
 	if count == 0 {
 		if err != nil {
-			logrus.Panic("Error while checking count of rows in the AbiType table, err: ", err)
+			logger.Panic("Error while checking count of rows in the AbiType table, err: ", err)
 			return err
 		}
 		abiTypes := []*AbiType{
@@ -122,7 +184,7 @@ func (*AbiType) AfterCreateTable(ctx context.Context, query *bun.CreateTableQuer
 			{Id: 3, Name: "Function"},
 		}
 		if _, err := query.DB().NewInsert().Model(&abiTypes).Exec(ctx); err != nil {
-			logrus.Panic("Error while inserting data into the AbiType table, err: ", err)
+			logger.Panic("Error while inserting data into the AbiType table, err: ", err)
 			return err
 		}
 	}
@@ -295,7 +357,7 @@ func (*TokenType) AfterCreateTable(ctx context.Context, query *bun.CreateTableQu
 	count, err := query.DB().NewSelect().Model(&TokenType{}).Count(ctx)
 	if count == 0 {
 		if err != nil {
-			logrus.Panic("Error while checking count of rows in the TokenType table, err: ", err)
+			logger.Panic("Error while checking count of rows in the TokenType table, err: ", err)
 			return err
 		}
 		tokenTypes := []*TokenType{
@@ -304,7 +366,7 @@ func (*TokenType) AfterCreateTable(ctx context.Context, query *bun.CreateTableQu
 			{Id: 3, Name: "ERC-1155"},
 		}
 		if _, err := query.DB().NewInsert().Model(&tokenTypes).Exec(ctx); err != nil {
-			logrus.Panic("Error while inserting data into the TokenType table, err: ", err)
+			logger.Panic("Error while inserting data into the TokenType table, err: ", err)
 			return err
 		}
 	}
@@ -315,7 +377,20 @@ func (*TokenType) AfterCreateTable(ctx context.Context, query *bun.CreateTableQu
 var _ bun.AfterCreateTableHook = (*NftMetadata)(nil)
 
 func (*NftMetadata) AfterCreateTable(ctx context.Context, query *bun.CreateTableQuery) error {
-	var err error
+	err := addColumns(ctx, query.DB(), "nft_metadata",
+		"animation_url varchar",
+		"external_url varchar",
+		"background_color varchar",
+		"raw jsonb",
+		"content_hash char(64)",
+		"source_uri varchar",
+		"image_cache_path varchar",
+		"image_mime_type varchar",
+		"thumbnail_cache_path varchar",
+	)
+	if err != nil {
+		return err
+	}
 
 	_, err = query.DB().NewCreateIndex().
 		Model((*NftMetadata)(nil)).
@@ -356,6 +431,137 @@ func (*NftTransfer) AfterCreateTable(ctx context.Context, query *bun.CreateTable
 		return err
 	}
 
+	_, err = query.DB().NewCreateIndex().
+		Model((*NftTransfer)(nil)).
+		Index("nfts_address_token_id_idx").
+		Column("address", "token_id").
+		IfNotExists().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ---------------NftTransferRange Table---------------------------------
+var _ bun.BeforeCreateTableHook = (*NftTransferRange)(nil)
+
+func (*NftTransferRange) BeforeCreateTable(ctx context.Context, query *bun.CreateTableQuery) error {
+	query.ForeignKey(`("block_hash", "index") REFERENCES "logs" ("block_hash", "index")`)
+	query.ForeignKey(`("transaction_hash") REFERENCES "transactions" (hash)`)
+	return nil
+}
+
+var _ bun.AfterCreateTableHook = (*NftTransferRange)(nil)
+
+func (*NftTransferRange) AfterCreateTable(ctx context.Context, query *bun.CreateTableQuery) error {
+	var err error
+
+	_, err = query.DB().NewCreateIndex().
+		Model((*NftTransferRange)(nil)).
+		Index("nft_transfer_ranges_address_idx").
+		Column("address").
+		IfNotExists().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = query.DB().NewCreateIndex().
+		Model((*NftTransferRange)(nil)).
+		Index("nft_transfer_ranges_block_hash_idx").
+		Column("block_hash").
+		IfNotExists().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ---------------NftLock Table---------------------------------
+var _ bun.BeforeCreateTableHook = (*NftLock)(nil)
+
+func (*NftLock) BeforeCreateTable(ctx context.Context, query *bun.CreateTableQuery) error {
+	query.ForeignKey(`("block_hash", "index") REFERENCES "logs" ("block_hash", "index")`)
+	query.ForeignKey(`("transaction_hash") REFERENCES "transactions" (hash)`)
+	return nil
+}
+
+var _ bun.AfterCreateTableHook = (*NftLock)(nil)
+
+func (*NftLock) AfterCreateTable(ctx context.Context, query *bun.CreateTableQuery) error {
+	var err error
+
+	_, err = query.DB().NewCreateIndex().
+		Model((*NftLock)(nil)).
+		Index("nft_locks_address_token_id_idx").
+		Column("address", "token_id").
+		IfNotExists().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = query.DB().NewCreateIndex().
+		Model((*NftLock)(nil)).
+		Index("nft_locks_block_hash_idx").
+		Column("block_hash").
+		IfNotExists().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ---------------TokenBoundAccount Table---------------------------------
+var _ bun.BeforeCreateTableHook = (*TokenBoundAccount)(nil)
+
+func (*TokenBoundAccount) BeforeCreateTable(ctx context.Context, query *bun.CreateTableQuery) error {
+	query.ForeignKey(`("block_hash", "index") REFERENCES "logs" ("block_hash", "index")`)
+	query.ForeignKey(`("transaction_hash") REFERENCES "transactions" (hash)`)
+	return nil
+}
+
+var _ bun.AfterCreateTableHook = (*TokenBoundAccount)(nil)
+
+func (*TokenBoundAccount) AfterCreateTable(ctx context.Context, query *bun.CreateTableQuery) error {
+	var err error
+
+	_, err = query.DB().NewCreateIndex().
+		Model((*TokenBoundAccount)(nil)).
+		Index("token_bound_accounts_token_idx").
+		Column("token_contract", "token_id").
+		IfNotExists().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = query.DB().NewCreateIndex().
+		Model((*TokenBoundAccount)(nil)).
+		Index("token_bound_accounts_account_idx").
+		Column("account").
+		IfNotExists().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = query.DB().NewCreateIndex().
+		Model((*TokenBoundAccount)(nil)).
+		Index("token_bound_accounts_block_hash_idx").
+		Column("block_hash").
+		IfNotExists().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -370,7 +576,15 @@ func (*NftMetadataAttribute) BeforeCreateTable(ctx context.Context, query *bun.C
 var _ bun.AfterCreateTableHook = (*NftMetadataAttribute)(nil)
 
 func (*NftMetadataAttribute) AfterCreateTable(ctx context.Context, query *bun.CreateTableQuery) error {
-	var err error
+	err := addColumns(ctx, query.DB(), "nft_metadata_attributes",
+		"value_type varchar(16)",
+		"numeric_value double precision",
+		"display_type varchar",
+		"max_value double precision",
+	)
+	if err != nil {
+		return err
+	}
 
 	_, err = query.DB().NewCreateIndex().
 		Model((*NftMetadataAttribute)(nil)).
@@ -384,3 +598,183 @@ func (*NftMetadataAttribute) AfterCreateTable(ctx context.Context, query *bun.Cr
 
 	return nil
 }
+
+// ---------------Nft Metadata Version Table---------------------------------
+var _ bun.AfterCreateTableHook = (*NftMetadataVersion)(nil)
+
+func (*NftMetadataVersion) AfterCreateTable(ctx context.Context, query *bun.CreateTableQuery) error {
+	var err error
+
+	_, err = query.DB().NewCreateIndex().
+		Model((*NftMetadataVersion)(nil)).
+		Index("nft_metadata_versions_address_token_idx").
+		Column("address", "token_id").
+		IfNotExists().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ---------------Nft Metadata Job Table---------------------------------
+var _ bun.BeforeCreateTableHook = (*NftMetadataJob)(nil)
+
+func (*NftMetadataJob) BeforeCreateTable(ctx context.Context, query *bun.CreateTableQuery) error {
+	query.ForeignKey(`("token_type_id") REFERENCES "token_types" (id)`)
+	return nil
+}
+
+var _ bun.AfterCreateTableHook = (*NftMetadataJob)(nil)
+
+func (*NftMetadataJob) AfterCreateTable(ctx context.Context, query *bun.CreateTableQuery) error {
+	err := addColumns(ctx, query.DB(), "nft_metadata_jobs",
+		"claim_token varchar(32)",
+		"claimed_until timestamptz",
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = query.DB().NewCreateIndex().
+		Model((*NftMetadataJob)(nil)).
+		Index("nft_metadata_jobs_token_address_idx").
+		Column("token_id", "address").
+		Unique().
+		IfNotExists().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = query.DB().NewCreateIndex().
+		Model((*NftMetadataJob)(nil)).
+		Index("nft_metadata_jobs_status_next_attempt_at_idx").
+		Column("status", "next_attempt_at").
+		IfNotExists().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ---------------Webhook Delivery Table---------------------------------
+var _ bun.BeforeCreateTableHook = (*WebhookDelivery)(nil)
+
+func (*WebhookDelivery) BeforeCreateTable(ctx context.Context, query *bun.CreateTableQuery) error {
+	// the pending deliveries of a deleted watch are dropped with it
+	query.ForeignKey(`("watch_id") REFERENCES "watches" (id) ON DELETE CASCADE`)
+	return nil
+}
+
+var _ bun.AfterCreateTableHook = (*WebhookDelivery)(nil)
+
+func (*WebhookDelivery) AfterCreateTable(ctx context.Context, query *bun.CreateTableQuery) error {
+	var err error
+
+	_, err = query.DB().NewCreateIndex().
+		Model((*WebhookDelivery)(nil)).
+		Index("webhook_deliveries_watch_id_id_idx").
+		Column("watch_id", "id").
+		IfNotExists().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ---------------Webhook Dead Letter Table---------------------------------
+var _ bun.BeforeCreateTableHook = (*WebhookDeadLetter)(nil)
+
+func (*WebhookDeadLetter) BeforeCreateTable(ctx context.Context, query *bun.CreateTableQuery) error {
+	query.ForeignKey(`("watch_id") REFERENCES "watches" (id)`)
+	return nil
+}
+
+var _ bun.AfterCreateTableHook = (*WebhookDeadLetter)(nil)
+
+func (*WebhookDeadLetter) AfterCreateTable(ctx context.Context, query *bun.CreateTableQuery) error {
+	var err error
+
+	_, err = query.DB().NewCreateIndex().
+		Model((*WebhookDeadLetter)(nil)).
+		Index("webhook_dead_letters_watch_id_idx").
+		Column("watch_id").
+		IfNotExists().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ---------------Nft Collection Table---------------------------------
+var _ bun.BeforeCreateTableHook = (*NftCollection)(nil)
+
+func (*NftCollection) BeforeCreateTable(ctx context.Context, query *bun.CreateTableQuery) error {
+	query.ForeignKey(`("token_type_id") REFERENCES "token_types" (id)`)
+	return nil
+}
+
+var _ bun.AfterCreateTableHook = (*NftCollection)(nil)
+
+func (*NftCollection) AfterCreateTable(ctx context.Context, query *bun.CreateTableQuery) error {
+	var err error
+
+	_, err = query.DB().NewCreateIndex().
+		Model((*NftCollection)(nil)).
+		Index("nft_collections_metadata_status_next_attempt_at_idx").
+		Column("metadata_status", "next_attempt_at").
+		IfNotExists().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return backfillNftCollections(ctx, query.DB())
+}
+
+// backfillNftCollections fills the nft_collections and nft_holders tables from the nft transfers stored by an older version,
+// which did not maintain them. It does nothing once the collections are filled.
+func backfillNftCollections(ctx context.Context, bunDb *bun.DB) error {
+	exists, err := bunDb.NewSelect().Model((*NftCollection)(nil)).Exists(ctx)
+	if err != nil || exists {
+		return err
+	}
+	exists, err = bunDb.NewSelect().Model((*NftTransfer)(nil)).Exists(ctx)
+	if err != nil || !exists {
+		return err
+	}
+
+	logger.Info("Filling the NFT collections from the stored transfers")
+	return bunDb.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		// the transfers of ERC-721 tokens have no value, they transfer one token
+		_, err := tx.ExecContext(ctx, `INSERT INTO nft_holders (address, owner, balance)
+			SELECT address, owner, SUM(units) FROM (
+				SELECT address, "to" AS owner, COALESCE(NULLIF(value, ''), '1')::numeric AS units FROM nft_transfers WHERE "to" != ?0
+				UNION ALL
+				SELECT address, "from" AS owner, -COALESCE(NULLIF(value, ''), '1')::numeric AS units FROM nft_transfers WHERE "from" != ?0
+			) AS balances
+			GROUP BY address, owner
+			HAVING SUM(units) != 0`, common.ZeroAddress)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO nft_collections (address, token_type_id, minted, burned, holder_count, transfer_count, first_block_number, last_block_number, metadata_status)
+			SELECT address, MIN(token_type_id),
+				COALESCE(SUM(COALESCE(NULLIF(value, ''), '1')::numeric) FILTER (WHERE "from" = ?0), 0),
+				COALESCE(SUM(COALESCE(NULLIF(value, ''), '1')::numeric) FILTER (WHERE "to" = ?0), 0),
+				(SELECT COUNT(*) FROM nft_holders WHERE nft_holders.address = nft_transfers.address AND balance > 0),
+				COUNT(*), MIN(block_number), MAX(block_number), ?1
+			FROM nft_transfers
+			GROUP BY address`, common.ZeroAddress, NftMetadataJobPending)
+		return err
+	})
+}
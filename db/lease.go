@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// releaseTimeout bounds the release of claims, which does not use the context of the queue
+const releaseTimeout = 5 * time.Second
+
+// Lease claims the rows of a queue table for a worker. The claimed rows hold the token of their claim and the end of their lease
+// in their claim_token and claimed_until columns: the other workers skip them until the lease expires, and the outcome of a row
+// is only stored by the worker whose token it still holds. The table also counts the attempts of its rows.
+type Lease struct {
+	Db       *bun.DB
+	Model    interface{} // nil pointer to the model of the table
+	Key      string      // primary key column of the table
+	Duration time.Duration
+}
+
+// Claim reserves the due rows selected by due, which are not claimed or whose lease has expired, and counts their attempt.
+// The rows locked by another claim in progress are skipped. The update also applies the set expressions, and the claimed rows
+// are scanned into dest.
+func (l *Lease) Claim(ctx context.Context, due *bun.SelectQuery, dest interface{}, set ...string) error {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+
+	due = due.
+		Column(l.Key).
+		Where("claimed_until IS NULL OR claimed_until < current_timestamp").
+		For("UPDATE SKIP LOCKED")
+	update := l.Db.NewUpdate().Model(l.Model).
+		Set("attempts = attempts + 1").
+		Set("claim_token = ?", hex.EncodeToString(token)).
+		Set("claimed_until = current_timestamp + ? * interval '1 second'", int64(l.Duration/time.Second))
+	for _, expression := range set {
+		update = update.Set(expression)
+	}
+	_, err := update.Where("? IN (?)", bun.Ident(l.Key), due).Returning("*").Exec(ctx, dest)
+	return err
+}
+
+// Release gives up the claim of the rows with the given keys, if it is still held by token, so that they can be claimed again
+// without waiting for their lease to expire. It is also called on shutdown, so it does not use the context of the queue.
+func (l *Lease) Release(keys interface{}, token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	_, err := l.Db.NewUpdate().Model(l.Model).
+		Set("claim_token = NULL").
+		Set("claimed_until = NULL").
+		Where("? IN (?)", bun.Ident(l.Key), bun.In(keys)).
+		Where("claim_token = ?", token).
+		Exec(ctx)
+	return err
+}
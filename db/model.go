@@ -1,5 +1,7 @@
 package db
 
+import "time"
+
 // Blocks - Mined block info holder table model
 type Block struct {
 	Hash              string `bun:",pk,type:char(66)"`
@@ -90,18 +92,198 @@ type NftTransfer struct {
 	TokenTypeId     int    `bun:"type:integer,notnull"`
 }
 
+// NftTransferRanges - ERC-2309 ConsecutiveTransfer events with a range of tokens too large to be stored as one transfer per token
+type NftTransferRange struct {
+	Id              uint64 `bun:",pk,type:bigserial,nullzero"`
+	BlockHash       string `bun:"type:char(66),notnull"`
+	Index           uint32 `bun:"type:integer,notnull"`
+	BlockNumber     uint64 `bun:"type:bigint,notnull"`
+	TransactionHash string `bun:"type:char(66),notnull"`
+	Address         string `bun:"type:char(42),notnull"`
+	From            string `bun:"type:char(42),notnull"`
+	To              string `bun:"type:char(42),notnull"`
+	FromTokenId     string `bun:"type:varchar(78),notnull"`
+	ToTokenId       string `bun:"type:varchar(78),notnull"`
+	TokenCount      string `bun:"type:numeric,notnull"` // tokens of the range, from the first to the last one
+}
+
+// NftLocks - ERC-5192 Locked and Unlocked events, the latest event of a token gives whether it is soulbound
+type NftLock struct {
+	Id              uint64 `bun:",pk,type:bigserial,nullzero"`
+	BlockHash       string `bun:"type:char(66),notnull"`
+	Index           uint32 `bun:"type:integer,notnull"`
+	BlockNumber     uint64 `bun:"type:bigint,notnull"`
+	TransactionHash string `bun:"type:char(66),notnull"`
+	Address         string `bun:"type:char(42),notnull"`
+	TokenId         string `bun:"type:varchar(78),notnull"`
+	Locked          bool   `bun:",notnull"`
+}
+
+// TokenBoundAccounts - ERC-6551 accounts created by a registry for a token
+type TokenBoundAccount struct {
+	Id              uint64 `bun:",pk,type:bigserial,nullzero"`
+	BlockHash       string `bun:"type:char(66),notnull"`
+	Index           uint32 `bun:"type:integer,notnull"`
+	BlockNumber     uint64 `bun:"type:bigint,notnull"`
+	TransactionHash string `bun:"type:char(66),notnull"`
+	Registry        string `bun:"type:char(42),notnull"` // contract which emitted the event
+	Account         string `bun:"type:char(42),notnull"`
+	Implementation  string `bun:"type:char(42),notnull"`
+	Salt            string `bun:"type:char(66),notnull"` // hex encoded, as a 32 bytes word
+	ChainId         string `bun:"type:varchar(78),notnull"`
+	TokenContract   string `bun:"type:char(42),notnull"`
+	TokenId         string `bun:"type:varchar(78),notnull"`
+}
+
 type NftMetadata struct {
-	Id          uint64 `bun:",pk,type:bigserial,nullzero"`
-	TokenId     string `bun:"type:varchar(78),notnull"`
-	Address     string `bun:"type:char(42),notnull"`
-	Name        string `bun:"type:varchar"`
-	Image       string `bun:"type:varchar"`
-	Description string `bun:"type:varchar"`
+	Id                 uint64 `bun:",pk,type:bigserial,nullzero"`
+	TokenId            string `bun:"type:varchar(78),notnull"`
+	Address            string `bun:"type:char(42),notnull"`
+	Name               string `bun:"type:varchar"`
+	Image              string `bun:"type:varchar"`
+	Description        string `bun:"type:varchar"`
+	AnimationUrl       string `bun:"type:varchar"`
+	ExternalUrl        string `bun:"type:varchar"`
+	BackgroundColor    string `bun:"type:varchar"`
+	Raw                string `bun:"type:jsonb,nullzero"` // the metadata document as it was fetched
+	ContentHash        string `bun:"type:char(64)"`       // hex encoded SHA-256 of the document
+	SourceUri          string `bun:"type:varchar"`        // the URI returned by tokenURI or uri
+	ImageCachePath     string `bun:"type:varchar"`        // path of the image in the media cache
+	ImageMimeType      string `bun:"type:varchar"`        // media type detected from the cached image
+	ThumbnailCachePath string `bun:"type:varchar"`        // path of the thumbnail in the media cache
+}
+
+// NftMetadataVersions - Previous metadata of the tokens, saved when their metadata is replaced by a different document
+type NftMetadataVersion struct {
+	Id              uint64    `bun:",pk,type:bigserial,nullzero"`
+	TokenId         string    `bun:"type:varchar(78),notnull"`
+	Address         string    `bun:"type:char(42),notnull"`
+	Name            string    `bun:"type:varchar"`
+	Image           string    `bun:"type:varchar"`
+	Description     string    `bun:"type:varchar"`
+	AnimationUrl    string    `bun:"type:varchar"`
+	ExternalUrl     string    `bun:"type:varchar"`
+	BackgroundColor string    `bun:"type:varchar"`
+	Raw             string    `bun:"type:jsonb,nullzero"`
+	ContentHash     string    `bun:"type:char(64)"`
+	SourceUri       string    `bun:"type:varchar"`
+	ReplacedAt      time.Time `bun:",nullzero,notnull,default:current_timestamp"`
 }
 
 type NftMetadataAttribute struct {
-	Id            uint64  `bun:",pk,type:bigserial,nullzero"`
-	NftMetadataId *uint64 `bun:"type:bigint,notnull"`
-	TraitType     string  `bun:"type:varchar"`
-	Value         string  `bun:"type:varchar"`
+	Id            uint64   `bun:",pk,type:bigserial,nullzero"`
+	NftMetadataId *uint64  `bun:"type:bigint,notnull"`
+	TraitType     string   `bun:"type:varchar"`
+	Value         string   `bun:"type:varchar"`
+	ValueType     string   `bun:"type:varchar(16)"`      // string, number, boolean or json
+	NumericValue  *float64 `bun:"type:double precision"` // set for numbers
+	DisplayType   string   `bun:"type:varchar"`
+	MaxValue      *float64 `bun:"type:double precision"`
+}
+
+// NftMetadataJobs - Queue of the NFT metadata to fetch, the jobs which are done or have failed permanently are kept
+type NftMetadataJob struct {
+	Id            uint64    `bun:",pk,type:bigserial,nullzero"`
+	TokenId       string    `bun:"type:varchar(78),notnull"`
+	Address       string    `bun:"type:char(42),notnull"`
+	TokenTypeId   int       `bun:"type:integer,notnull"`
+	Status        string    `bun:"type:varchar(16),notnull"`
+	Attempts      int       `bun:"type:integer,notnull,default:0"`
+	NextAttemptAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+	LastError     string    `bun:"type:varchar"`
+	ClaimToken    string    `bun:"type:varchar(32),nullzero"` // worker holding the job until claimed_until, null when none does
+	ClaimedUntil  time.Time `bun:",nullzero"`
+	CreatedAt     time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+	UpdatedAt     time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// NFT metadata job statuses
+const (
+	NftMetadataJobPending = "pending"
+	NftMetadataJobDone    = "done"
+	NftMetadataJobFailed  = "failed"
+)
+
+// NftCollections - ERC-721 and ERC-1155 contracts which have transferred tokens. The counters are updated in the transactions
+// inserting and deleting their transfers, the metadata is fetched like the metadata of the tokens, with the statuses of the jobs.
+type NftCollection struct {
+	Address          string    `bun:",pk,type:char(42)"`
+	TokenTypeId      int       `bun:"type:integer,notnull"`
+	Name             string    `bun:"type:varchar"` // returned by name()
+	Symbol           string    `bun:"type:varchar"` // returned by symbol()
+	ContractUri      string    `bun:"type:varchar"` // returned by contractURI()
+	Description      string    `bun:"type:varchar"`
+	Image            string    `bun:"type:varchar"`
+	ExternalLink     string    `bun:"type:varchar"`
+	Raw              string    `bun:"type:jsonb,nullzero"` // the contract metadata document as it was fetched
+	ContentHash      string    `bun:"type:char(64)"`
+	Minted           string    `bun:"type:numeric,notnull,default:0"` // tokens minted, units of the tokens for ERC-1155
+	Burned           string    `bun:"type:numeric,notnull,default:0"` // tokens burned, units of the tokens for ERC-1155
+	HolderCount      int64     `bun:"type:bigint,notnull,default:0"`
+	TransferCount    int64     `bun:"type:bigint,notnull,default:0"`
+	FirstBlockNumber uint64    `bun:"type:bigint,notnull"`
+	LastBlockNumber  uint64    `bun:"type:bigint,notnull"`
+	MetadataStatus   string    `bun:"type:varchar(16),notnull"` // pending, done or failed, as the jobs of nft_metadata_jobs
+	Attempts         int       `bun:"type:integer,notnull,default:0"`
+	NextAttemptAt    time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+	LastError        string    `bun:"type:varchar"`
+	ClaimToken       string    `bun:"type:varchar(32),nullzero"`
+	ClaimedUntil     time.Time `bun:",nullzero"`
+	UpdatedAt        time.Time `bun:",nullzero,notnull,default:current_timestamp"`
 }
+
+// NftHolders - Tokens of a collection held by an address, units of the tokens for ERC-1155. The balance can be negative
+// while the blocks are committed out of order, an address is a holder when its balance is positive.
+type NftHolder struct {
+	Address string `bun:",pk,type:char(42)"`
+	Owner   string `bun:",pk,type:char(42)"`
+	Balance string `bun:"type:numeric,notnull"`
+}
+
+// Watches - Webhook subscriptions for addresses and events, empty filter columns match anything
+type Watch struct {
+	Id        uint64    `bun:",pk,type:bigserial,nullzero"`
+	Url       string    `bun:"type:varchar,notnull"`
+	Secret    string    `bun:"type:varchar,notnull"`
+	Address   string    `bun:"type:varchar(42)"`
+	Topic0    string    `bun:"type:varchar(66)"`
+	Contract  string    `bun:"type:varchar(42)"`
+	MinValue  string    `bun:"type:varchar(78)"` // decimal, compared with the transaction value
+	Active    bool      `bun:",notnull,default:true"`
+	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// WebhookDeliveries - Queue of the webhook payloads to post, a delivery is deleted once it is posted or moved to the dead letters
+type WebhookDelivery struct {
+	Id            uint64    `bun:",pk,type:bigserial,nullzero"`
+	WatchId       uint64    `bun:"type:bigint,notnull"`
+	Payload       string    `bun:"type:jsonb,notnull"`
+	Attempts      int       `bun:"type:integer,notnull,default:0"`
+	NextAttemptAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+	LastError     string    `bun:"type:varchar"`
+	ClaimToken    string    `bun:"type:varchar(32),nullzero"` // dispatcher posting the delivery until claimed_until, null when none does
+	ClaimedUntil  time.Time `bun:",nullzero"`
+	CreatedAt     time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// WebhookDeadLetters - Webhook deliveries that failed after all attempts
+type WebhookDeadLetter struct {
+	Id        uint64    `bun:",pk,type:bigserial,nullzero"`
+	WatchId   uint64    `bun:"type:bigint,notnull"`
+	Url       string    `bun:"type:varchar,notnull"`
+	Payload   string    `bun:"type:jsonb,notnull"`
+	Attempts  int       `bun:"type:integer,notnull"`
+	LastError string    `bun:"type:varchar"`
+	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// SyncStates - Block numbers maintained by the syncer
+type SyncState struct {
+	Name        string    `bun:",pk,type:varchar"`
+	BlockNumber int64     `bun:"type:bigint,notnull"`
+	UpdatedAt   time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// ContiguousWatermark names the sync state with the highest block number up to which every block from the checkpoint is stored.
+// It is maintained only by the ordered commit mode, and is -1 while the checkpoint is the genesis block and it is not stored.
+const ContiguousWatermark = "contiguous_up_to"
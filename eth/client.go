@@ -1,21 +1,41 @@
 package eth
 
 import (
+	"context"
+	"ethernal/explorer/loger"
+	"net/http"
+
 	"github.com/ethereum/go-ethereum/rpc"
-	"github.com/sirupsen/logrus"
 )
 
+var logger = loger.Get(loger.Eth)
+
+// transport carries the HTTP requests sent to the blockchain node and to the IPFS backends
+var transport http.RoundTripper = http.DefaultTransport
+
+// metadataTransport carries the requests sent to the NFT metadata servers. It does not share its connections with transport,
+// so that a metadata URL cannot reuse a connection to a private host which was not checked by the fetch policy.
+var metadataTransport = NewTransport()
+
 type BlockchainNodeConnection struct {
 	HTTP      *rpc.Client
 	WebSocket *rpc.Client
 }
 
+// SetTransport replaces the transports of the HTTP requests, e.g. to record or replay them. The metadata transport
+// must not share its connections with the node transport, which is checked by no fetch policy.
+// It has to be called before the clients are created.
+func SetTransport(node http.RoundTripper, metadata http.RoundTripper) {
+	transport = node
+	metadataTransport = metadata
+}
+
 // Connect to blockchain node, either using HTTP or Websocket connection depending on URL passed to function
 func GetClient(rpcUrl string) *rpc.Client {
 
-	rpcClient, err := rpc.Dial(rpcUrl)
+	rpcClient, err := rpc.DialOptions(context.Background(), rpcUrl, rpc.WithHTTPClient(&http.Client{Transport: transport}))
 	if err != nil {
-		logrus.Panic("Cannot connect to blockchain node, err: ", err)
+		logger.Panic("Cannot connect to blockchain node, err: ", err)
 	}
 
 	return rpcClient
@@ -0,0 +1,489 @@
+package eth
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"ethernal/explorer/common"
+	"ethernal/explorer/db"
+	"ethernal/explorer/ipfs"
+	"ethernal/explorer/metrics"
+	"ethernal/explorer/tracing"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/sirupsen/logrus"
+	bundb "github.com/uptrace/bun"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// collectionMethods are the methods called to get the name, symbol and metadata URI of a collection
+var collectionMethods = func() abi.ABI {
+	parsedAbi, _ := abi.JSON(strings.NewReader("[" + common.NameMethod.Abi + "," + common.SymbolMethod.Abi + "," + common.ContractUriMethod.Abi + "]"))
+	return parsedAbi
+}()
+
+// UpdateNftCollections adds the nft transfers and transfer ranges to the counters of their collections and to the balances of their holders.
+// The collections seen for the first time are created with their metadata pending. It is called in the transaction inserting the transfers.
+func UpdateNftCollections(ctx context.Context, idb bundb.IDB, dbNftTransfers []*db.NftTransfer, dbNftTransferRanges []*db.NftTransferRange) error {
+	dbNftTransfers = append(dbNftTransfers, rangeTransfers(dbNftTransferRanges)...)
+	if len(dbNftTransfers) == 0 {
+		return nil
+	}
+	return applyNftTransfers(ctx, idb, dbNftTransfers, 1)
+}
+
+// RevertNftCollections removes the deleted nft transfers and transfer ranges from the counters of their collections and from the balances
+// of their holders. It is called in the transaction deleting the transfers, after them. The collections left without transfers are deleted.
+func RevertNftCollections(ctx context.Context, idb bundb.IDB, deleted []*db.NftTransfer, deletedRanges []*db.NftTransferRange) error {
+	deleted = append(deleted, rangeTransfers(deletedRanges)...)
+	if len(deleted) == 0 {
+		return nil
+	}
+	if err := applyNftTransfers(ctx, idb, deleted, -1); err != nil {
+		return err
+	}
+
+	addresses := []string{}
+	for _, nftTransfer := range deleted {
+		addresses = append(addresses, nftTransfer.Address)
+	}
+	// the first and last blocks are taken again from the remaining transfers and transfer ranges
+	_, err := idb.ExecContext(ctx, `UPDATE nft_collections SET first_block_number = blocks.first, last_block_number = blocks.last
+		FROM (SELECT address, MIN(block_number) AS first, MAX(block_number) AS last
+			FROM (SELECT address, block_number FROM nft_transfers WHERE address IN (?0)
+				UNION ALL SELECT address, block_number FROM nft_transfer_ranges WHERE address IN (?0)) AS transfers
+			GROUP BY address) AS blocks
+		WHERE nft_collections.address = blocks.address`, bundb.In(addresses))
+	if err != nil {
+		return err
+	}
+	_, err = idb.NewDelete().Model((*db.NftCollection)(nil)).Where("address IN (?)", bundb.In(addresses)).Where("transfer_count <= 0").Exec(ctx)
+	return err
+}
+
+// rangeTransfers returns the transfer ranges as transfers of their count of tokens, to be counted by applyNftTransfers as one transfer
+// moving the tokens of the range
+func rangeTransfers(dbNftTransferRanges []*db.NftTransferRange) []*db.NftTransfer {
+	dbNftTransfers := make([]*db.NftTransfer, 0, len(dbNftTransferRanges))
+	for _, transferRange := range dbNftTransferRanges {
+		dbNftTransfers = append(dbNftTransfers, &db.NftTransfer{
+			BlockNumber: transferRange.BlockNumber,
+			Address:     transferRange.Address,
+			From:        transferRange.From,
+			To:          transferRange.To,
+			Value:       transferRange.TokenCount,
+			TokenTypeId: common.ERC721Type,
+		})
+	}
+	return dbNftTransfers
+}
+
+// applyNftTransfers adds the nft transfers, or removes them if sign is -1, from the collections and the holders.
+// The rows are updated in the order of their keys, so that concurrent commits do not deadlock.
+func applyNftTransfers(ctx context.Context, idb bundb.IDB, dbNftTransfers []*db.NftTransfer, sign int64) error {
+	type holderKey struct{ address, owner string }
+	type collectionDelta struct {
+		tokenTypeId    int
+		minted, burned *big.Int
+		holders        int64
+		transfers      int64
+		first, last    uint64
+	}
+
+	holders := map[holderKey]*big.Int{}
+	collections := map[string]*collectionDelta{}
+	for _, nftTransfer := range dbNftTransfers {
+		// the transfers of ERC-721 tokens have no value, they transfer one token
+		units, ok := new(big.Int).SetString(nftTransfer.Value, 10)
+		if !ok {
+			units = big.NewInt(1)
+		}
+		units.Mul(units, big.NewInt(sign))
+
+		collection, ok := collections[nftTransfer.Address]
+		if !ok {
+			collection = &collectionDelta{tokenTypeId: nftTransfer.TokenTypeId, minted: new(big.Int), burned: new(big.Int), first: nftTransfer.BlockNumber, last: nftTransfer.BlockNumber}
+			collections[nftTransfer.Address] = collection
+		}
+		collection.transfers += sign
+		if nftTransfer.BlockNumber < collection.first {
+			collection.first = nftTransfer.BlockNumber
+		}
+		if nftTransfer.BlockNumber > collection.last {
+			collection.last = nftTransfer.BlockNumber
+		}
+
+		if nftTransfer.From == common.ZeroAddress {
+			collection.minted.Add(collection.minted, units)
+		} else {
+			key := holderKey{nftTransfer.Address, nftTransfer.From}
+			if holders[key] == nil {
+				holders[key] = new(big.Int)
+			}
+			holders[key].Sub(holders[key], units)
+		}
+		if nftTransfer.To == common.ZeroAddress {
+			collection.burned.Add(collection.burned, units)
+		} else {
+			key := holderKey{nftTransfer.Address, nftTransfer.To}
+			if holders[key] == nil {
+				holders[key] = new(big.Int)
+			}
+			holders[key].Add(holders[key], units)
+		}
+	}
+
+	rows := []*db.NftHolder{}
+	for key, delta := range holders {
+		if delta.Sign() != 0 {
+			rows = append(rows, &db.NftHolder{Address: key.address, Owner: key.owner, Balance: delta.String()})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Address < rows[j].Address || (rows[i].Address == rows[j].Address && rows[i].Owner < rows[j].Owner)
+	})
+	if len(rows) != 0 {
+		updated := []*db.NftHolder{}
+		_, err := idb.NewInsert().Model(&rows).
+			On("CONFLICT (address, owner) DO UPDATE").
+			Set("balance = ?TableAlias.balance + EXCLUDED.balance").
+			Returning("address, owner, balance").
+			Exec(ctx, &updated)
+		if err != nil {
+			return err
+		}
+
+		// the balance before the update is the updated one minus the delta, an address becomes or stops being a holder
+		// when its balance crosses zero
+		emptied := [][]string{}
+		for _, holder := range updated {
+			balance, ok := new(big.Int).SetString(holder.Balance, 10)
+			if !ok {
+				return fmt.Errorf("invalid balance %q of %s in %s", holder.Balance, holder.Owner, holder.Address)
+			}
+			previous := new(big.Int).Sub(balance, holders[holderKey{holder.Address, holder.Owner}])
+			switch {
+			case balance.Sign() > 0 && previous.Sign() <= 0:
+				collections[holder.Address].holders++
+			case balance.Sign() <= 0 && previous.Sign() > 0:
+				collections[holder.Address].holders--
+			}
+			if balance.Sign() == 0 {
+				emptied = append(emptied, []string{holder.Address, holder.Owner})
+			}
+		}
+		if len(emptied) != 0 {
+			if _, err := idb.NewDelete().Model((*db.NftHolder)(nil)).Where("(address, owner) IN (?)", bundb.In(emptied)).Where("balance = 0").Exec(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	dbCollections := []*db.NftCollection{}
+	for address, delta := range collections {
+		dbCollections = append(dbCollections, &db.NftCollection{
+			Address:          address,
+			TokenTypeId:      delta.tokenTypeId,
+			Minted:           delta.minted.String(),
+			Burned:           delta.burned.String(),
+			HolderCount:      delta.holders,
+			TransferCount:    delta.transfers,
+			FirstBlockNumber: delta.first,
+			LastBlockNumber:  delta.last,
+			MetadataStatus:   db.NftMetadataJobPending,
+		})
+	}
+	sort.Slice(dbCollections, func(i, j int) bool { return dbCollections[i].Address < dbCollections[j].Address })
+	query := idb.NewInsert().Model(&dbCollections).
+		On("CONFLICT (address) DO UPDATE").
+		Set("minted = ?TableAlias.minted + EXCLUDED.minted").
+		Set("burned = ?TableAlias.burned + EXCLUDED.burned").
+		Set("holder_count = ?TableAlias.holder_count + EXCLUDED.holder_count").
+		Set("transfer_count = ?TableAlias.transfer_count + EXCLUDED.transfer_count").
+		Set("updated_at = current_timestamp")
+	if sign > 0 {
+		query = query.
+			Set("first_block_number = LEAST(?TableAlias.first_block_number, EXCLUDED.first_block_number)").
+			Set("last_block_number = GREATEST(?TableAlias.last_block_number, EXCLUDED.last_block_number)")
+	}
+	_, err := query.Exec(ctx)
+	return err
+}
+
+// requeueNftCollection queues the metadata of the collection to be fetched again. The claim of a worker fetching it is dropped,
+// so that the metadata it fetched is not stored over the new one.
+func requeueNftCollection(ctx context.Context, idb bundb.IDB, contract string) error {
+	_, err := idb.NewUpdate().Model((*db.NftCollection)(nil)).
+		Set("metadata_status = ?", db.NftMetadataJobPending).
+		Set("attempts = 0").
+		Set("next_attempt_at = current_timestamp").
+		Set("last_error = NULL").
+		Set("claim_token = NULL").
+		Set("claimed_until = NULL").
+		Where("address = ?", contract).
+		Exec(ctx)
+	return err
+}
+
+// nftCollectionResult is the outcome of fetching the metadata of a collection. called is set when name, symbol and contractURI
+// have been called, document when the contract metadata has been read.
+type nftCollectionResult struct {
+	collection *db.NftCollection
+	called     bool
+	document   *metadataDocument
+	err        error
+}
+
+// fetchCollectionMetadata calls name, symbol and contractURI on the contracts of the collections in batches of step calls,
+// and reads the contract metadata from its URI as the metadata of the tokens. The name, symbol and URI are set in the collections.
+// A contract which does not implement one of the methods has an empty value for it.
+func fetchCollectionMetadata(ctx context.Context, collections []*db.NftCollection, client *rpc.Client, timeout uint, ipfsClient *ipfs.Client, fetcher *httpFetcher, step uint) []*nftCollectionResult {
+	type params struct {
+		To   string `json:"to"`
+		Data string `json:"data"`
+	}
+	ctx, span := tracing.Start(ctx, "nft.fetch_collections", attribute.Int("collections.count", len(collections)))
+	defer span.End()
+
+	methods := []string{common.NameMethod.Name, common.SymbolMethod.Name, common.ContractUriMethod.Name}
+	results := make([]string, len(collections)*len(methods))
+	elems := make([]rpc.BatchElem, 0, len(results))
+	for _, collection := range collections {
+		for _, method := range methods {
+			data, _ := collectionMethods.Pack(method)
+			elems = append(elems, rpc.BatchElem{
+				Method: "eth_call",
+				Args:   []interface{}{params{collection.Address, "0x" + hex.EncodeToString(data)}, "latest"},
+				Result: &results[len(elems)],
+			})
+		}
+	}
+
+	// the errors of single calls are reverted calls, only the errors of whole batches are retried
+	batchErrors := make([]error, len(elems))
+	for from := 0; from < len(elems); from += int(step) {
+		to := from + int(step)
+		if to > len(elems) {
+			to = len(elems)
+		}
+		elemSlice := elems[from:to]
+		ctxWithTimeout, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		ctxWithTimeout, batchSpan := tracing.Start(ctxWithTimeout, "rpc.batch", tracing.RpcBatch(elemSlice)...)
+		start := time.Now()
+		err := client.BatchCallContext(ctxWithTimeout, elemSlice)
+		metrics.ObserveRpcBatch(elemSlice, start, err)
+		tracing.End(batchSpan, tracing.BatchError(elemSlice, err))
+		cancel()
+		if err != nil {
+			logger.WithField("rpc_method", "eth_call").WithError(err).Error("Cannot get collection metadata from blockchain")
+			for j := from; j < to; j++ {
+				batchErrors[j] = err
+			}
+		}
+	}
+
+	collectionResults := make([]*nftCollectionResult, len(collections))
+	for i, collection := range collections {
+		result := &nftCollectionResult{collection: collection}
+		collectionResults[i] = result
+		first := i * len(methods)
+		for j := first; j < first+len(methods); j++ {
+			if batchErrors[j] != nil {
+				result.err = fmt.Errorf("cannot call the collection contract: %w", batchErrors[j])
+			}
+		}
+		if result.err != nil {
+			continue
+		}
+		result.called = true
+
+		value := func(j int) string {
+			if elems[first+j].Error != nil {
+				return ""
+			}
+			return results[first+j]
+		}
+		collection.Name = decodeContractString(value(0))
+		collection.Symbol = decodeContractString(value(1))
+		uri, err := decodeTokenUri(value(2))
+		if value(2) == "" || errors.Is(err, errNoUri) {
+			// the collection has no contract metadata
+			collection.ContractUri = ""
+			continue
+		}
+		collection.ContractUri = uri
+		var source metadataSource
+		if err == nil {
+			source, err = resolveTokenUri(uri, "", collection.TokenTypeId)
+		}
+		var raw []byte
+		if err == nil {
+			raw, err = source.read(ctx, ipfsClient, fetcher, metadataContentTypes, 0)
+		}
+		if err == nil {
+			result.document, err = parseMetadataDocument(raw)
+		}
+		result.err = err
+	}
+	return collectionResults
+}
+
+// decodeContractString ABI-decodes the string returned by name or symbol. Some early contracts return a bytes32, which is read
+// up to its first zero byte. The characters which cannot be stored are dropped.
+func decodeContractString(result string) string {
+	data, err := hexutil.Decode(result)
+	if err != nil || len(data) == 0 {
+		return ""
+	}
+	var value string
+	if len(data) == 32 {
+		if end := strings.IndexByte(string(data), 0); end >= 0 {
+			data = data[:end]
+		}
+		value = string(data)
+	} else if values, err := stringOutput.Unpack(data); err == nil {
+		value = values[0].(string)
+	}
+	value = strings.ReplaceAll(value, "\x00", "")
+	if !utf8.ValidString(value) {
+		value = strings.ToValidUTF8(value, "")
+	}
+	return strings.TrimSpace(value)
+}
+
+// runCollections fetches the metadata of the due collections until ctx is cancelled. The collections are few compared to the tokens,
+// they are fetched one batch at a time. The batch in progress has the time left to workCtx to finish.
+func (q *NftMetadataQueue) runCollections(ctx context.Context, workCtx context.Context) {
+	for {
+		// a full batch of due collections means that more of them may be waiting
+		for q.dispatchCollections(ctx, workCtx) {
+		}
+		select {
+		case <-time.After(metadataPollInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// dispatchCollections claims a batch of due collections and fetches their metadata. It reports whether it claimed a full batch.
+func (q *NftMetadataQueue) dispatchCollections(ctx context.Context, workCtx context.Context) bool {
+	settings := q.current()
+	// every collection takes three calls
+	limit := int(settings.step+2) / 3
+	collections, err := q.claimCollections(ctx, limit)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.WithError(err).Error("Cannot claim NFT collections")
+		}
+		return false
+	}
+	if len(collections) == 0 {
+		return false
+	}
+	// the collections interrupted by a shutdown are released, the other ones are released when their outcome is stored
+	defer q.releaseCollections(collections)
+
+	for _, result := range fetchCollectionMetadata(workCtx, collections, q.client, settings.timeout, settings.ipfs, settings.fetcher, settings.step) {
+		if workCtx.Err() != nil {
+			break
+		}
+		q.storeCollection(workCtx, result)
+	}
+	return len(collections) == limit
+}
+
+// claimCollections reserves up to limit due collections to this worker for metadataClaimLease and counts their attempt,
+// as claim does for the jobs of the tokens
+func (q *NftMetadataQueue) claimCollections(ctx context.Context, limit int) ([]*db.NftCollection, error) {
+	due := q.db.NewSelect().Model((*db.NftCollection)(nil)).
+		Where("metadata_status = ?", db.NftMetadataJobPending).
+		Where("next_attempt_at <= current_timestamp").
+		Order("next_attempt_at").
+		Limit(limit)
+
+	claimed := []*db.NftCollection{}
+	err := q.collectionLease().Claim(ctx, due, &claimed)
+	return claimed, err
+}
+
+// collectionLease is the lease of the collections claimed by a worker
+func (q *NftMetadataQueue) collectionLease() *db.Lease {
+	return &db.Lease{Db: q.db, Model: (*db.NftCollection)(nil), Key: "address", Duration: metadataClaimLease}
+}
+
+// releaseCollections gives up the claims of the collections which are still held
+func (q *NftMetadataQueue) releaseCollections(collections []*db.NftCollection) {
+	addresses := make([]string, 0, len(collections))
+	for _, collection := range collections {
+		addresses = append(addresses, collection.Address)
+	}
+	if err := q.collectionLease().Release(addresses, collections[0].ClaimToken); err != nil {
+		logger.WithError(err).Error("Cannot release NFT collections")
+	}
+}
+
+// storeCollection stores the fetched name, symbol and metadata of the collection and its outcome, as fail does for the jobs
+// of the tokens: the collection is done, attempted again later, or failed if it cannot succeed or has no attempts left.
+// The values which have not been fetched are kept.
+func (q *NftMetadataQueue) storeCollection(ctx context.Context, result *nftCollectionResult) {
+	collection := result.collection
+	fields := logrus.Fields{
+		"address":  collection.Address,
+		"attempts": collection.Attempts,
+	}
+
+	update := q.db.NewUpdate().Model((*db.NftCollection)(nil)).
+		Set("claim_token = NULL").
+		Set("claimed_until = NULL").
+		Set("updated_at = current_timestamp").
+		Where("address = ?", collection.Address).
+		Where("claim_token = ?", collection.ClaimToken)
+	if result.called {
+		update = update.Set("name = ?", collection.Name).Set("symbol = ?", collection.Symbol).Set("contract_uri = ?", collection.ContractUri)
+	}
+	if result.err == nil {
+		document := result.document
+		if document == nil {
+			document = &metadataDocument{}
+		}
+		update = update.
+			Set("description = ?", document.Description).
+			Set("image = ?", document.Image).
+			Set("external_link = ?", document.ExternalUrl).
+			Set("raw = NULLIF(?, '')::jsonb", string(document.Raw)).
+			Set("content_hash = ?", document.ContentHash)
+	}
+
+	switch {
+	case result.err == nil:
+		update = update.Set("metadata_status = ?", db.NftMetadataJobDone).Set("last_error = NULL")
+		metrics.NftCollectionJobs.WithLabelValues(metrics.MetadataJobDone).Inc()
+	case isPermanent(result.err) || collection.Attempts >= q.maxAttempts:
+		update = update.Set("metadata_status = ?", db.NftMetadataJobFailed).Set("last_error = ?", result.err.Error())
+		metrics.NftCollectionJobs.WithLabelValues(metrics.MetadataJobFailed).Inc()
+		logger.WithFields(fields).WithError(result.err).Warn("NFT collection metadata failed")
+	default:
+		delay := metadataJobBackoff(collection.Attempts)
+		update = update.Set("next_attempt_at = current_timestamp + ? * interval '1 second'", int64(delay/time.Second)).Set("last_error = ?", result.err.Error())
+		metrics.NftCollectionJobs.WithLabelValues(metrics.MetadataJobRetry).Inc()
+		logger.WithFields(fields).WithField("retry_in", delay.String()).WithError(result.err).Info("NFT collection metadata failed, retrying later")
+	}
+
+	dbResult, err := update.Exec(ctx)
+	if err != nil {
+		logger.WithFields(fields).WithError(err).Error("Error during updating nft collection in DB")
+		return
+	}
+	if count, err := dbResult.RowsAffected(); err == nil && count == 0 {
+		logger.WithFields(fields).Warn("NFT collection claimed again or queued again, its metadata is not stored")
+	}
+}
@@ -0,0 +1,24 @@
+package eth
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func TestDecodeContractString(t *testing.T) {
+	name, _ := stringOutput.Pack("Collection")
+	bytes32 := make([]byte, 32)
+	copy(bytes32, "MKR")
+	for result, expected := range map[string]string{
+		hexutil.Encode(name):    "Collection",
+		hexutil.Encode(bytes32): "MKR",
+		"0x":                    "",
+		"":                      "",
+		"0x1234":                "",
+	} {
+		if value := decodeContractString(result); value != expected {
+			t.Fatalf("%s decoded as %q, expected %q", result, value, expected)
+		}
+	}
+}
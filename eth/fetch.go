@@ -0,0 +1,259 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"ethernal/explorer/media"
+	"ethernal/explorer/tracing"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	errBlockedAddress   = errors.New("address is not public")
+	errContentType      = errors.New("unexpected content type")
+	errTooManyRedirects = errors.New("too many redirects")
+)
+
+// nonPublicNetworks are the reserved networks which are not covered by the net.IP methods
+var nonPublicNetworks = func() []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, cidr := range []string{"0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "240.0.0.0/4"} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// Content types accepted for the metadata documents and the images. Many servers do not know JSON or SVG files,
+// so the generic types are accepted as well, and the content is checked once read.
+var (
+	metadataContentTypes = []string{"application/json", "text/plain", "application/octet-stream", "binary/octet-stream"}
+	mediaContentTypes    = []string{"image/", "application/octet-stream", "binary/octet-stream", "text/plain", "text/xml", "application/xml"}
+)
+
+// isRejected reports whether the fetch policy refused the URL or its content, which another attempt would not change
+func isRejected(err error) bool {
+	return errors.Is(err, errBlockedAddress) || errors.Is(err, errContentType) || errors.Is(err, media.ErrTooLarge)
+}
+
+// publicOnlyKey marks the contexts of the requests which must not connect to a private address
+type publicOnlyKey struct{}
+
+// NewTransport returns the transport sending the requests to the network. It refuses to connect the requests
+// of the NFT metadata fetcher to private addresses, unless they are allowed.
+func NewTransport() http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialContext
+	return transport
+}
+
+// dialContext checks the address every connection is made to, after the host is resolved,
+// so that a name resolving to a public address when the URL is checked and to a private one later is refused
+func dialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if ctx.Value(publicOnlyKey{}) != nil {
+		dialer.Control = func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+				return fmt.Errorf("%w: %s", errBlockedAddress, host)
+			}
+			return nil
+		}
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// isPublic reports whether the address is a public unicast address
+func isPublic(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchPolicy bounds the requests sent to the URLs found on chain, which anyone can point anywhere
+type fetchPolicy struct {
+	timeout      time.Duration
+	maxSize      int64
+	maxRedirects int
+	// hostRequests is the number of concurrent requests sent to a host
+	hostRequests int
+	userAgent    string
+	allowPrivate bool
+}
+
+// httpFetcher fetches the NFT metadata documents and images from their http(s) URLs, following its policy
+type httpFetcher struct {
+	policy fetchPolicy
+	client *http.Client
+
+	lock  sync.Mutex
+	hosts map[string]*hostSlots
+}
+
+// hostSlots are the requests in progress to a host, it is dropped when no request is waiting for it
+type hostSlots struct {
+	slots chan struct{}
+	users int
+}
+
+func newHttpFetcher(policy fetchPolicy, transport http.RoundTripper) *httpFetcher {
+	fetcher := &httpFetcher{policy: policy, hosts: map[string]*hostSlots{}}
+	fetcher.client = &http.Client{
+		Transport: transport,
+		Timeout:   policy.timeout,
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			if len(via) > policy.maxRedirects {
+				return fmt.Errorf("%w: more than %d", errTooManyRedirects, policy.maxRedirects)
+			}
+			return fetcher.checkUrl(request.URL)
+		},
+	}
+	return fetcher
+}
+
+// get returns the body of the response to a GET request of the URL, whose content type has to start with one of contentTypes.
+// A body larger than maxSize bytes, or than the maximum size of the policy if maxSize is 0, is not read and media.ErrTooLarge is returned.
+func (f *httpFetcher) get(ctx context.Context, rawUrl string, contentTypes []string, maxSize int64) (_ []byte, err error) {
+	ctx, span := tracing.Start(ctx, "nft.http_get", attribute.String("http.url", rawUrl))
+	defer func() { tracing.End(span, err) }()
+
+	if maxSize == 0 {
+		maxSize = f.policy.maxSize
+	}
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidUri, err)
+	}
+	if err := f.checkUrl(parsed); err != nil {
+		return nil, err
+	}
+	if !f.policy.allowPrivate {
+		ctx = context.WithValue(ctx, publicOnlyKey{}, true)
+	}
+
+	release, err := f.acquire(ctx, strings.ToLower(parsed.Host))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, rawUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", f.policy.userAgent)
+	response, err := f.client.Do(request)
+	if err != nil {
+		logger.WithField("url", rawUrl).WithError(err).Debug("Cannot get url")
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unexpected status %s", response.Status)
+		logger.WithField("url", rawUrl).WithError(err).Debug("Cannot get url")
+		return nil, err
+	}
+	if err := checkContentType(response.Header.Get("Content-Type"), contentTypes); err != nil {
+		return nil, err
+	}
+
+	if response.ContentLength > maxSize {
+		return nil, media.ErrTooLarge
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxSize {
+		return nil, media.ErrTooLarge
+	}
+	return body, nil
+}
+
+// checkUrl refuses the URLs which are not http(s), and the private hosts given as addresses or as localhost.
+// The hosts given by name are checked once resolved, when the connection is made.
+func (f *httpFetcher) checkUrl(target *url.URL) error {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return fmt.Errorf("%w: %s", errUnsupportedUri, target.Scheme)
+	}
+	if f.policy.allowPrivate {
+		return nil
+	}
+	host := strings.ToLower(strings.TrimSuffix(target.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s", errBlockedAddress, host)
+	}
+	if ip := net.ParseIP(host); ip != nil && !isPublic(ip) {
+		return fmt.Errorf("%w: %s", errBlockedAddress, host)
+	}
+	return nil
+}
+
+// acquire waits until fewer than hostRequests requests are sent to the host, the returned function ends the request
+func (f *httpFetcher) acquire(ctx context.Context, host string) (func(), error) {
+	f.lock.Lock()
+	slots, ok := f.hosts[host]
+	if !ok {
+		slots = &hostSlots{slots: make(chan struct{}, f.policy.hostRequests)}
+		f.hosts[host] = slots
+	}
+	slots.users++
+	f.lock.Unlock()
+
+	leave := func() {
+		f.lock.Lock()
+		defer f.lock.Unlock()
+		if slots.users--; slots.users == 0 {
+			delete(f.hosts, host)
+		}
+	}
+	select {
+	case slots.slots <- struct{}{}:
+		return func() {
+			<-slots.slots
+			leave()
+		}, nil
+	case <-ctx.Done():
+		leave()
+		return nil, ctx.Err()
+	}
+}
+
+// checkContentType accepts the responses without a content type, and the ones whose media type starts with one of contentTypes
+// or, for JSON documents, ends with +json
+func checkContentType(contentType string, contentTypes []string) error {
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errContentType, contentType)
+	}
+	for _, accepted := range contentTypes {
+		if strings.HasPrefix(mediaType, accepted) || (accepted == "application/json" && strings.HasSuffix(mediaType, "+json")) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", errContentType, mediaType)
+}
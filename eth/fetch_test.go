@@ -0,0 +1,159 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"ethernal/explorer/media"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestFetcher(allowPrivate bool) *httpFetcher {
+	return newHttpFetcher(fetchPolicy{
+		timeout:      5 * time.Second,
+		maxSize:      1024,
+		maxRedirects: 2,
+		hostRequests: 2,
+		userAgent:    "explorer-test",
+		allowPrivate: allowPrivate,
+	}, NewTransport())
+}
+
+func TestIsPublic(t *testing.T) {
+	for address, public := range map[string]bool{
+		"1.1.1.1":          true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"::1":              false,
+		"fe80::1":          false,
+		"fd00::1":          false,
+		"::ffff:127.0.0.1": false,
+	} {
+		if isPublic(net.ParseIP(address)) != public {
+			t.Fatalf("%s is public: %v", address, !public)
+		}
+	}
+}
+
+func TestFetchBlocksPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	fetcher := newTestFetcher(false)
+	for _, url := range []string{server.URL, strings.Replace(server.URL, "127.0.0.1", "localhost", 1), "http://169.254.169.254/latest/meta-data/"} {
+		if _, err := fetcher.get(context.Background(), url, metadataContentTypes, 0); !errors.Is(err, errBlockedAddress) {
+			t.Fatalf("%s fetched with %v, expected errBlockedAddress", url, err)
+		}
+	}
+	if _, err := fetcher.get(context.Background(), "file:///etc/passwd", metadataContentTypes, 0); !errors.Is(err, errUnsupportedUri) {
+		t.Fatalf("file uri fetched with %v, expected errUnsupportedUri", err)
+	}
+
+	// the names are checked once resolved
+	ctx := context.WithValue(context.Background(), publicOnlyKey{}, true)
+	if _, err := dialContext(ctx, "tcp", server.Listener.Addr().String()); !errors.Is(err, errBlockedAddress) {
+		t.Fatalf("dialed the loopback address with %v, expected errBlockedAddress", err)
+	}
+
+	if data, err := newTestFetcher(true).get(context.Background(), server.URL, metadataContentTypes, 0); err != nil || string(data) != `{}` {
+		t.Fatalf("allowed private address fetched %q (err: %v)", data, err)
+	}
+}
+
+func TestFetchPolicy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != "explorer-test" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/ld.json":
+			w.Header().Set("Content-Type", "application/ld+json; charset=utf-8")
+			w.Write([]byte(`{}`))
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html></html>`))
+		case "/large.json":
+			w.Write([]byte(strings.Repeat(" ", 2048)))
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/redirected":
+			http.Redirect(w, r, "/ld.json", http.StatusMovedPermanently)
+		}
+	}))
+	defer server.Close()
+
+	fetcher := newTestFetcher(true)
+	tests := []struct {
+		path string
+		err  error
+	}{
+		{path: "/ld.json"},
+		{path: "/redirected"},
+		{path: "/page.html", err: errContentType},
+		{path: "/large.json", err: media.ErrTooLarge},
+		{path: "/loop", err: errTooManyRedirects},
+	}
+	for _, test := range tests {
+		data, err := fetcher.get(context.Background(), server.URL+test.path, metadataContentTypes, 0)
+		if test.err == nil && (err != nil || string(data) != `{}`) {
+			t.Fatalf("%s fetched %q (err: %v)", test.path, data, err)
+		}
+		if test.err != nil && !errors.Is(err, test.err) {
+			t.Fatalf("%s fetched with %v, expected %v", test.path, err, test.err)
+		}
+	}
+	if !isRejected(errContentType) || isRejected(errTooManyRedirects) {
+		t.Fatal("unexpected rejected errors")
+	}
+}
+
+func TestFetchHostConcurrency(t *testing.T) {
+	var current, highest int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		defer atomic.AddInt32(&current, -1)
+		for {
+			previous := atomic.LoadInt32(&highest)
+			if n <= previous || atomic.CompareAndSwapInt32(&highest, previous, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	fetcher := newTestFetcher(true)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := fetcher.get(context.Background(), server.URL, metadataContentTypes, 0); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if highest > 2 {
+		t.Fatalf("%d concurrent requests sent to the host, expected at most 2", highest)
+	}
+	if len(fetcher.hosts) != 0 {
+		t.Fatalf("%d hosts left after the requests", len(fetcher.hosts))
+	}
+}
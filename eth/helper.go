@@ -27,3 +27,46 @@ type Erc1155TransferSingle struct {
 	Id       *big.Int
 	Value    *big.Int
 }
+
+type Erc4906MetadataUpdate struct {
+	TokenId *big.Int
+}
+
+type Erc4906BatchMetadataUpdate struct {
+	FromTokenId *big.Int
+	ToTokenId   *big.Int
+}
+
+type Erc1155Uri struct {
+	Value string
+	Id    *big.Int
+}
+
+type Erc2309ConsecutiveTransfer struct {
+	FromTokenId *big.Int
+	ToTokenId   *big.Int
+	FromAddress common.Address
+	ToAddress   common.Address
+}
+
+type Erc5192Lock struct {
+	TokenId *big.Int
+}
+
+type Erc6551AccountCreated struct {
+	Account        common.Address
+	Implementation common.Address
+	Salt           [32]byte
+	ChainId        *big.Int
+	TokenContract  common.Address
+	TokenId        *big.Int
+}
+
+type Erc6551LegacyAccountCreated struct {
+	Account        common.Address
+	Implementation common.Address
+	ChainId        *big.Int
+	TokenContract  common.Address
+	TokenId        *big.Int
+	Salt           *big.Int
+}
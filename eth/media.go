@@ -0,0 +1,35 @@
+package eth
+
+import (
+	"context"
+	"ethernal/explorer/db"
+	"ethernal/explorer/ipfs"
+	"ethernal/explorer/media"
+	"ethernal/explorer/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// cacheNftMedia downloads the image of the metadata into the media cache and records where it is cached
+func cacheNftMedia(ctx context.Context, cache *media.Cache, metadata *db.NftMetadata, ipfsClient *ipfs.Client, fetcher *httpFetcher) (err error) {
+	ctx, span := tracing.Start(ctx, "nft.cache_media", attribute.String("nft.address", metadata.Address), attribute.String("nft.token_id", metadata.TokenId))
+	defer func() { tracing.End(span, err) }()
+
+	source, err := resolveMediaUri(metadata.Image)
+	if err != nil {
+		return err
+	}
+	data, err := source.read(ctx, ipfsClient, fetcher, mediaContentTypes, cache.MaxSize())
+	if err != nil {
+		return err
+	}
+
+	object, err := cache.Save(ctx, data)
+	if err != nil {
+		return err
+	}
+	metadata.ImageCachePath = object.Path
+	metadata.ImageMimeType = object.MimeType
+	metadata.ThumbnailCachePath = object.ThumbnailPath
+	return nil
+}
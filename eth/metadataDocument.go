@@ -0,0 +1,191 @@
+package eth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+)
+
+// Attribute value types
+const (
+	AttributeString  = "string"
+	AttributeNumber  = "number"
+	AttributeBoolean = "boolean"
+	AttributeJson    = "json"
+)
+
+var errInvalidMetadata = errors.New("metadata is not a JSON object")
+
+// metadataDocument is the metadata JSON of a token, with the fields of the ERC-721 and ERC-1155 metadata standards and the common extensions
+type metadataDocument struct {
+	Name            string
+	Description     string
+	Image           string
+	AnimationUrl    string
+	ExternalUrl     string
+	BackgroundColor string
+	Attributes      []metadataAttribute
+	// Raw is the document as it was fetched, ContentHash its hex encoded SHA-256
+	Raw         json.RawMessage
+	ContentHash string
+}
+
+// metadataAttribute is a trait of the token. Value is the text of the value whatever its type, NumericValue is set for numbers.
+type metadataAttribute struct {
+	TraitType    string
+	Value        string
+	ValueType    string
+	NumericValue *float64
+	DisplayType  string
+	MaxValue     *float64
+}
+
+// parseMetadataDocument parses the metadata JSON. The fields with unexpected types are read as text or skipped,
+// so that a single odd field does not lose the whole document.
+func parseMetadataDocument(raw []byte) (*metadataDocument, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, errInvalidMetadata
+	}
+
+	// jsonb cannot store the NUL character
+	raw = bytes.ReplaceAll(raw, []byte(`\u0000`), nil)
+	hash := sha256.Sum256(raw)
+	document := &metadataDocument{
+		Name:            jsonText(fields["name"]),
+		Description:     jsonText(fields["description"]),
+		Image:           firstText(fields["image"], fields["image_url"], fields["image_data"]),
+		AnimationUrl:    firstText(fields["animation_url"], fields["animation"]),
+		ExternalUrl:     firstText(fields["external_url"], fields["external_link"]),
+		BackgroundColor: jsonText(fields["background_color"]),
+		Attributes:      parseAttributes(firstRaw(fields["attributes"], fields["traits"], fields["properties"])),
+		Raw:             raw,
+		ContentHash:     hex.EncodeToString(hash[:]),
+	}
+	return document, nil
+}
+
+// parseAttributes reads the attributes as an array of {trait_type, value, display_type, max_value} objects or of bare values,
+// or as an object of trait types and values
+func parseAttributes(raw json.RawMessage) []metadataAttribute {
+	attributes := []metadataAttribute{}
+
+	elements := []json.RawMessage{}
+	if err := json.Unmarshal(raw, &elements); err == nil {
+		for _, element := range elements {
+			object := map[string]json.RawMessage{}
+			if err := json.Unmarshal(element, &object); err != nil {
+				if attribute, ok := newAttribute("", element); ok {
+					attributes = append(attributes, attribute)
+				}
+				continue
+			}
+			attribute, ok := newAttribute(firstText(object["trait_type"], object["type"], object["name"]), object["value"])
+			if !ok {
+				continue
+			}
+			attribute.DisplayType = jsonText(object["display_type"])
+			attribute.MaxValue = jsonNumber(object["max_value"])
+			attributes = append(attributes, attribute)
+		}
+		return attributes
+	}
+
+	object := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &object); err == nil {
+		traitTypes := make([]string, 0, len(object))
+		for traitType := range object {
+			traitTypes = append(traitTypes, traitType)
+		}
+		sort.Strings(traitTypes)
+		for _, traitType := range traitTypes {
+			if attribute, ok := newAttribute(traitType, object[traitType]); ok {
+				attributes = append(attributes, attribute)
+			}
+		}
+	}
+	return attributes
+}
+
+// newAttribute types the value of the attribute, null and missing values are skipped
+func newAttribute(traitType string, value json.RawMessage) (metadataAttribute, bool) {
+	attribute := metadataAttribute{TraitType: traitType}
+	var decoded interface{}
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	if err := decoder.Decode(&decoded); err != nil || decoded == nil {
+		return attribute, false
+	}
+
+	switch typed := decoded.(type) {
+	case string:
+		attribute.Value = typed
+		attribute.ValueType = AttributeString
+	case json.Number:
+		attribute.Value = typed.String()
+		attribute.ValueType = AttributeNumber
+		attribute.NumericValue = jsonNumber(value)
+	case bool:
+		attribute.Value = strconv.FormatBool(typed)
+		attribute.ValueType = AttributeBoolean
+	default:
+		attribute.Value = string(value)
+		attribute.ValueType = AttributeJson
+	}
+	return attribute, true
+}
+
+// jsonText returns a string or the text of a number or a boolean, and an empty string for the other values
+func jsonText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	var number json.Number
+	if err := json.Unmarshal(raw, &number); err == nil {
+		return number.String()
+	}
+	var boolean bool
+	if err := json.Unmarshal(raw, &boolean); err == nil {
+		return strconv.FormatBool(boolean)
+	}
+	return ""
+}
+
+// jsonNumber returns a number, or a string holding one
+func jsonNumber(raw json.RawMessage) *float64 {
+	text := jsonText(raw)
+	if text == "" {
+		return nil
+	}
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil
+	}
+	return &number
+}
+
+func firstText(values ...json.RawMessage) string {
+	for _, value := range values {
+		if text := jsonText(value); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+func firstRaw(values ...json.RawMessage) json.RawMessage {
+	for _, value := range values {
+		if len(value) != 0 && string(value) != "null" {
+			return value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package eth
+
+import "testing"
+
+func TestParseMetadataDocument(t *testing.T) {
+	raw := `{
+		"name": "Token 1",
+		"description": 42,
+		"image": "ipfs://image",
+		"animation_url": "ipfs://animation",
+		"external_url": "https://example.com/1",
+		"background_color": "ffffff",
+		"attributes": [
+			{"trait_type": "color", "value": "red"},
+			{"trait_type": "level", "value": 5, "display_type": "number", "max_value": 10},
+			{"trait_type": "shiny", "value": true},
+			{"trait_type": "empty", "value": null},
+			"bare"
+		]
+	}`
+	document, err := parseMetadataDocument([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if document.Name != "Token 1" || document.Description != "42" || document.Image != "ipfs://image" || document.AnimationUrl != "ipfs://animation" ||
+		document.ExternalUrl != "https://example.com/1" || document.BackgroundColor != "ffffff" {
+		t.Fatalf("unexpected document %+v", document)
+	}
+	if string(document.Raw) != raw || len(document.ContentHash) != 64 {
+		t.Fatalf("raw document %q with hash %q", document.Raw, document.ContentHash)
+	}
+
+	if len(document.Attributes) != 4 {
+		t.Fatalf("got %d attributes, expected 4: %+v", len(document.Attributes), document.Attributes)
+	}
+	level := document.Attributes[1]
+	if level.ValueType != AttributeNumber || level.Value != "5" || level.NumericValue == nil || *level.NumericValue != 5 ||
+		level.DisplayType != "number" || level.MaxValue == nil || *level.MaxValue != 10 {
+		t.Fatalf("unexpected numeric attribute %+v", level)
+	}
+	if shiny := document.Attributes[2]; shiny.ValueType != AttributeBoolean || shiny.Value != "true" {
+		t.Fatalf("unexpected boolean attribute %+v", shiny)
+	}
+	if bare := document.Attributes[3]; bare.TraitType != "" || bare.Value != "bare" || bare.ValueType != AttributeString {
+		t.Fatalf("unexpected bare attribute %+v", bare)
+	}
+}
+
+func TestParseAttributesObject(t *testing.T) {
+	attributes := parseAttributes([]byte(`{"size": 3, "color": "blue"}`))
+	if len(attributes) != 2 || attributes[0].TraitType != "color" || attributes[1].ValueType != AttributeNumber {
+		t.Fatalf("unexpected attributes %+v", attributes)
+	}
+}
+
+func TestParseMetadataDocumentInvalid(t *testing.T) {
+	for _, raw := range []string{`<html></html>`, `["name"]`, ``} {
+		if _, err := parseMetadataDocument([]byte(raw)); err != errInvalidMetadata {
+			t.Fatalf("%q parsed with %v, expected errInvalidMetadata", raw, err)
+		}
+	}
+}
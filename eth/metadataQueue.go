@@ -0,0 +1,626 @@
+package eth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"ethernal/explorer/common"
+	"ethernal/explorer/config"
+	"ethernal/explorer/db"
+	"ethernal/explorer/ipfs"
+	"ethernal/explorer/media"
+	"ethernal/explorer/metrics"
+	"ethernal/explorer/utils"
+	"ethernal/explorer/workers"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/sirupsen/logrus"
+	bundb "github.com/uptrace/bun"
+)
+
+// nftMetadataVersionColumns are the columns copied from nft_metadata to nft_metadata_versions
+const nftMetadataVersionColumns = "token_id, address, name, image, description, animation_url, external_url, background_color, raw, content_hash, source_uri"
+
+const (
+	// metadataPollInterval is how often the queue looks for due jobs
+	metadataPollInterval = 2 * time.Second
+	// metadataBackoff is the delay before the second attempt of a job, it doubles with every next attempt up to metadataMaxBackoff
+	metadataBackoff    = 30 * time.Second
+	metadataMaxBackoff = 6 * time.Hour
+	// metadataClaimLease is how long the jobs claimed by a worker are reserved to it. It is longer than a batch of jobs takes,
+	// the jobs of a process which stopped without releasing them are claimed again once it expires.
+	metadataClaimLease = 15 * time.Minute
+)
+
+// errClaimLost is returned when the lease of a job has expired and the job has been claimed again by another worker
+var errClaimLost = errors.New("nft metadata job claimed by another worker")
+
+// ErrTooManyRangeTokens is returned when a refresh covers more tokens of ConsecutiveTransfer ranges than are queued at once
+var ErrTooManyRangeTokens = errors.New("too many tokens of ConsecutiveTransfer ranges to refresh")
+
+// NftMetadataQueue fetches the metadata of the tokens queued in the nft_metadata_jobs table with a pool of workers.
+// A failed job is attempted again with exponential backoff until it runs out of attempts, after which it is marked as failed.
+// Tokens without a metadata URI or with an invalid or unsupported one fail at once.
+type NftMetadataQueue struct {
+	db          *bundb.DB
+	client      *rpc.Client
+	workers     uint
+	maxAttempts int
+	// media caches the images of the metadata, nil if the media cache is disabled
+	media *media.Cache
+
+	lock     sync.Mutex
+	settings nftMetadataSettings
+}
+
+// nftMetadataSettings are the settings of the queue which can be reloaded while it is running
+type nftMetadataSettings struct {
+	timeout     uint
+	ipfsOptions ipfs.Options
+	ipfs        *ipfs.Client
+	fetcher     *httpFetcher
+	step        uint
+}
+
+var queueInstance *NftMetadataQueue
+
+// NewNftMetadataQueue creates the queue fetching the NFT metadata, which is configured again by ConfigureNftMetadata.
+func NewNftMetadataQueue(bunDb *bundb.DB, client *rpc.Client, config *config.Config) *NftMetadataQueue {
+	queueInstance = &NftMetadataQueue{
+		db:          bunDb,
+		client:      client,
+		workers:     config.NftMetadataWorkersCount,
+		maxAttempts: int(config.NftMetadataMaxAttempts),
+		media:       media.NewConfiguredCache(config),
+	}
+	queueInstance.configure(config)
+	return queueInstance
+}
+
+// ConfigureNftMetadata applies the reloaded timeout, IPFS settings, fetch policy and step to the jobs the queue starts from now on.
+func ConfigureNftMetadata(config *config.Config) {
+	if queueInstance != nil {
+		queueInstance.configure(config)
+	}
+}
+
+func (q *NftMetadataQueue) configure(config *config.Config) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	ipfsOptions := ipfs.Options{
+		Gateways:  config.IPFSGateways(),
+		NodeApi:   config.IPFSApiUrl,
+		Strategy:  config.IPFSStrategy,
+		RateLimit: config.IPFSRateLimit,
+		Verify:    config.IPFSVerify,
+		Timeout:   time.Duration(config.CallTimeoutInSeconds) * time.Second,
+	}
+	// the client is kept, with the health of its backends, unless its options change
+	ipfsClient := q.settings.ipfs
+	if ipfsClient == nil || !reflect.DeepEqual(ipfsOptions, q.settings.ipfsOptions) {
+		ipfsClient = ipfs.NewClient(ipfsOptions, transport)
+	}
+	policy := fetchPolicy{
+		timeout:      time.Duration(config.CallTimeoutInSeconds) * time.Second,
+		maxSize:      int64(config.NftMetadataMaxSizeInKB) << 10,
+		maxRedirects: int(config.NftMetadataRedirects),
+		hostRequests: int(config.NftMetadataHostRequests),
+		userAgent:    config.NftMetadataUserAgent,
+		allowPrivate: config.NftMetadataAllowPrivate,
+	}
+	// as the IPFS client, the fetcher is kept with the requests in progress to every host
+	fetcher := q.settings.fetcher
+	if fetcher == nil || fetcher.policy != policy {
+		fetcher = newHttpFetcher(policy, metadataTransport)
+	}
+	q.settings = nftMetadataSettings{
+		timeout:     config.CallTimeoutInSeconds,
+		ipfsOptions: ipfsOptions,
+		ipfs:        ipfsClient,
+		fetcher:     fetcher,
+		step:        config.Step,
+	}
+}
+
+func (q *NftMetadataQueue) current() nftMetadataSettings {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.settings
+}
+
+// EnqueueNftMetadata adds the tokens minted by the nft transfers to the queue, unless they are queued already.
+// It is called in the transaction inserting the nft transfers, so that no minted token is lost.
+func EnqueueNftMetadata(ctx context.Context, idb bundb.IDB, dbNftTransfers []*db.NftTransfer) error {
+	jobs := []*db.NftMetadataJob{}
+	for _, nftTransfer := range dbNftTransfers {
+		if nftTransfer.From == common.ZeroAddress {
+			jobs = append(jobs, &db.NftMetadataJob{
+				TokenId:     nftTransfer.TokenId,
+				Address:     nftTransfer.Address,
+				TokenTypeId: nftTransfer.TokenTypeId,
+				Status:      db.NftMetadataJobPending,
+			})
+		}
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+	_, err := idb.NewInsert().Model(&jobs).On("CONFLICT (token_id, address) DO NOTHING").Exec(ctx)
+	return err
+}
+
+// RefreshNftMetadata queues the metadata of the contract tokens (or of a single token, if tokenId is not empty) to be fetched again,
+// and returns the number of queued tokens. The metadata of the collection is queued with its tokens. The tokens of the ConsecutiveTransfer
+// ranges stored as ranges are queued too, the refresh is rejected with ErrTooManyRangeTokens if they are more than maxRangeTokens.
+// The stored metadata is replaced once the new one is fetched.
+func RefreshNftMetadata(ctx context.Context, bunDb *bundb.DB, contract string, tokenId string, maxRangeTokens uint64) (int, error) {
+	contract = strings.ToLower(contract)
+	rangeCount, err := requeueNftRangeMetadata(ctx, bunDb, contract, tokenId, tokenId, maxRangeTokens)
+	if err != nil {
+		return 0, err
+	}
+	if tokenId == "" {
+		if err := requeueNftCollection(ctx, bunDb, contract); err != nil {
+			return 0, err
+		}
+	}
+	count, err := requeueNftMetadata(ctx, bunDb, contract, tokenId, tokenId)
+	return rangeCount + count, err
+}
+
+// RefreshNftMetadataUpdates queues the tokens whose metadata has changed to be fetched again. It is called in the transaction
+// inserting the nft transfers, after them, so that the tokens minted in the same blocks are known. Only the known tokens
+// are queued, the ones minted later are fetched on mint. The tokens of the ConsecutiveTransfer ranges are skipped with a warning
+// when they are more than maxRangeTokens, as the update must not stop the synchronization.
+func RefreshNftMetadataUpdates(ctx context.Context, idb bundb.IDB, updates []*NftMetadataUpdate, maxRangeTokens uint64) error {
+	for _, update := range updates {
+		fields := logrus.Fields{
+			"address":       update.Address,
+			"from_token_id": update.FromTokenId,
+			"to_token_id":   update.ToTokenId,
+		}
+		rangeCount, err := requeueNftRangeMetadata(ctx, idb, update.Address, update.FromTokenId, update.ToTokenId, maxRangeTokens)
+		if errors.Is(err, ErrTooManyRangeTokens) {
+			logger.WithFields(fields).WithError(err).Warn("NFT metadata update of ConsecutiveTransfer ranges skipped")
+		} else if err != nil {
+			return err
+		}
+		count, err := requeueNftMetadata(ctx, idb, update.Address, update.FromTokenId, update.ToTokenId)
+		if err != nil {
+			return err
+		}
+		fields["tokens"] = rangeCount + count
+		logger.WithFields(fields).Debug("NFT metadata update queued")
+	}
+	return nil
+}
+
+// requeueNftMetadata queues the tokens of the contract which have been transferred, with an id from fromTokenId to toTokenId,
+// or all of them if fromTokenId is empty. Their jobs are reset to pending with all their attempts.
+func requeueNftMetadata(ctx context.Context, idb bundb.IDB, contract string, fromTokenId string, toTokenId string) (int, error) {
+	tokens := idb.NewSelect().Model((*db.NftTransfer)(nil)).
+		DistinctOn("token_id").
+		Column("token_id", "address", "token_type_id").
+		ColumnExpr("? AS status", db.NftMetadataJobPending).
+		Where("address = ?", contract).
+		Order("token_id", "block_number")
+	if fromTokenId != "" {
+		tokens = tokens.Where("token_id::numeric BETWEEN ?::numeric AND ?::numeric", fromTokenId, toTokenId)
+	}
+	return insertNftMetadataJobs(ctx, idb, tokens)
+}
+
+// requeueNftRangeMetadata queues the tokens of the ConsecutiveTransfer ranges of the contract stored as ranges, with an id from fromTokenId
+// to toTokenId, or all of them if fromTokenId is empty. Nothing is queued if they are more than maxTokens.
+func requeueNftRangeMetadata(ctx context.Context, idb bundb.IDB, contract string, fromTokenId string, toTokenId string, maxTokens uint64) (int, error) {
+	query := idb.NewSelect().Model((*db.NftTransferRange)(nil)).Column("from_token_id", "to_token_id").Where("address = ?", contract)
+	if fromTokenId != "" {
+		query = query.Where("to_token_id::numeric >= ?::numeric AND from_token_id::numeric <= ?::numeric", fromTokenId, toTokenId)
+	}
+	ranges := []*db.NftTransferRange{}
+	if err := query.Scan(ctx, &ranges); err != nil {
+		return 0, err
+	}
+
+	// the ranges are bounded by the requested ids
+	bounded := []*db.NftTransferRange{}
+	total := new(big.Int)
+	for _, transferRange := range ranges {
+		if fromTokenId != "" {
+			transferRange.FromTokenId = maxTokenId(transferRange.FromTokenId, fromTokenId)
+			transferRange.ToTokenId = minTokenId(transferRange.ToTokenId, toTokenId)
+		}
+		from, _ := new(big.Int).SetString(transferRange.FromTokenId, 10)
+		to, _ := new(big.Int).SetString(transferRange.ToTokenId, 10)
+		if to.Cmp(from) < 0 {
+			continue
+		}
+		bounded = append(bounded, transferRange)
+		total.Add(total, to.Sub(to, from).Add(to, big.NewInt(1)))
+	}
+	if !total.IsUint64() || total.Uint64() > maxTokens {
+		return 0, fmt.Errorf("%w: %s tokens of %s, at most %d are queued at once", ErrTooManyRangeTokens, total.String(), contract, maxTokens)
+	}
+
+	count := 0
+	for _, transferRange := range bounded {
+		tokens := idb.NewSelect().
+			ColumnExpr("generate_series(?::numeric, ?::numeric)::text AS token_id", transferRange.FromTokenId, transferRange.ToTokenId).
+			ColumnExpr("? AS address", contract).
+			ColumnExpr("? AS token_type_id", common.ERC721Type).
+			ColumnExpr("? AS status", db.NftMetadataJobPending)
+		rangeCount, err := insertNftMetadataJobs(ctx, idb, tokens)
+		if err != nil {
+			return count, err
+		}
+		count += rangeCount
+	}
+	return count, nil
+}
+
+// insertNftMetadataJobs queues the tokens selected by the query. The jobs of the tokens which are queued already are reset to pending
+// with all their attempts.
+func insertNftMetadataJobs(ctx context.Context, idb bundb.IDB, tokens *bundb.SelectQuery) (int, error) {
+	result, err := idb.ExecContext(ctx, `INSERT INTO nft_metadata_jobs (token_id, address, token_type_id, status) ?
+		ON CONFLICT (token_id, address) DO UPDATE SET
+			status = EXCLUDED.status,
+			attempts = 0,
+			next_attempt_at = current_timestamp,
+			last_error = NULL,
+			updated_at = current_timestamp`, tokens)
+	if err != nil {
+		return 0, err
+	}
+	count, err := result.RowsAffected()
+	return int(count), err
+}
+
+// maxTokenId and minTokenId return the larger and the smaller of two decimal token ids
+func maxTokenId(a string, b string) string {
+	if compareTokenIds(a, b) >= 0 {
+		return a
+	}
+	return b
+}
+
+func minTokenId(a string, b string) string {
+	if compareTokenIds(a, b) <= 0 {
+		return a
+	}
+	return b
+}
+
+func compareTokenIds(a string, b string) int {
+	x, _ := new(big.Int).SetString(a, 10)
+	y, _ := new(big.Int).SetString(b, 10)
+	return x.Cmp(y)
+}
+
+// WaitNftMetadataJobs waits until every queued job of the contract (or of a single token, if tokenId is not empty) has been attempted,
+// and returns the number of jobs by status.
+func WaitNftMetadataJobs(ctx context.Context, bunDb *bundb.DB, contract string, tokenId string) (map[string]int, error) {
+	contract = strings.ToLower(contract)
+	for {
+		query := bunDb.NewSelect().Model((*db.NftMetadataJob)(nil)).Where("address = ?", contract).Where("status = ?", db.NftMetadataJobPending).Where("attempts = 0")
+		if tokenId != "" {
+			query = query.Where("token_id = ?", tokenId)
+		}
+		waiting, err := query.Count(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if waiting == 0 {
+			break
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	counts := []struct {
+		Status string
+		Count  int
+	}{}
+	query := bunDb.NewSelect().Model((*db.NftMetadataJob)(nil)).Column("status").ColumnExpr("COUNT(*) AS count").Where("address = ?", contract).Group("status")
+	if tokenId != "" {
+		query = query.Where("token_id = ?", tokenId)
+	}
+	if err := query.Scan(ctx, &counts); err != nil {
+		return nil, err
+	}
+	byStatus := map[string]int{}
+	for _, count := range counts {
+		byStatus[count.Status] = count.Count
+	}
+	return byStatus, nil
+}
+
+// Run works through the due jobs, and the due collections, until ctx is cancelled. The jobs in progress then have the shutdown timeout to finish,
+// the ones which do not finish are attempted again by the next run.
+func (q *NftMetadataQueue) Run(ctx context.Context, shutdownTimeout time.Duration) {
+	workCtx, cancel := utils.WithDrainTimeout(ctx, shutdownTimeout)
+	defer cancel()
+
+	input := make(chan []*db.NftMetadataJob)
+	go func() {
+		defer close(input)
+		for {
+			// a full page of due jobs means that more of them may be waiting
+			for q.dispatch(ctx, input) {
+			}
+			select {
+			case <-time.After(metadataPollInterval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var collections sync.WaitGroup
+	collections.Add(1)
+	go func() {
+		defer collections.Done()
+		q.runCollections(ctx, workCtx)
+	}()
+
+	stage := workers.Stage[[]*db.NftMetadataJob]{Name: "nft_metadata", Workers: q.workers, Fn: q.process}
+	for range stage.Run(workCtx, input, func(result workers.Result[[]*db.NftMetadataJob, []*db.NftMetadataJob]) {
+		logger.WithField("job", result.JobId).WithError(result.Err).Error("NFT metadata jobs failed")
+	}) {
+	}
+	collections.Wait()
+	logger.Info("NFT metadata queue stopped")
+}
+
+// dispatch claims the due jobs and sends them to the workers in batches of step jobs.
+// It reports whether it claimed a full page of jobs.
+func (q *NftMetadataQueue) dispatch(ctx context.Context, input chan<- []*db.NftMetadataJob) bool {
+	step := int(q.current().step)
+	limit := 4 * int(q.workers) * step
+	jobs, err := q.claim(ctx, limit)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.WithError(err).Error("Cannot claim NFT metadata jobs")
+		}
+		return false
+	}
+
+	for from := 0; from < len(jobs); from += step {
+		to := from + step
+		if to > len(jobs) {
+			to = len(jobs)
+		}
+		select {
+		case input <- jobs[from:to]:
+		case <-ctx.Done():
+			q.release(jobs[from:])
+			return false
+		}
+	}
+	return len(jobs) == limit
+}
+
+// jobLease is the lease of the jobs claimed by a worker
+func (q *NftMetadataQueue) jobLease() *db.Lease {
+	return &db.Lease{Db: q.db, Model: (*db.NftMetadataJob)(nil), Key: "id", Duration: metadataClaimLease}
+}
+
+// claim reserves up to limit due jobs to this worker for metadataClaimLease and counts their attempt. The jobs claimed
+// by another worker, of this process or of another one, are skipped until their lease expires.
+func (q *NftMetadataQueue) claim(ctx context.Context, limit int) ([]*db.NftMetadataJob, error) {
+	due := q.db.NewSelect().Model((*db.NftMetadataJob)(nil)).
+		Where("status = ?", db.NftMetadataJobPending).
+		Where("next_attempt_at <= current_timestamp").
+		Order("next_attempt_at").
+		Limit(limit)
+
+	claimed := []*db.NftMetadataJob{}
+	err := q.jobLease().Claim(ctx, due, &claimed, "updated_at = current_timestamp")
+	return claimed, err
+}
+
+// release gives up the claims of the jobs which are still held, so that they can be claimed again without waiting for their lease
+// to expire
+func (q *NftMetadataQueue) release(jobs []*db.NftMetadataJob) {
+	if len(jobs) == 0 {
+		return
+	}
+	ids := make([]uint64, 0, len(jobs))
+	for _, job := range jobs {
+		ids = append(ids, job.Id)
+	}
+	if err := q.jobLease().Release(ids, jobs[0].ClaimToken); err != nil {
+		logger.WithError(err).Error("Cannot release NFT metadata jobs")
+	}
+}
+
+// process fetches the metadata of the jobs and stores the outcome of every job
+func (q *NftMetadataQueue) process(ctx context.Context, jobs []*db.NftMetadataJob) ([]*db.NftMetadataJob, error) {
+	// the jobs interrupted by a shutdown are released, the other ones are released when their outcome is stored
+	defer q.release(jobs)
+
+	settings := q.current()
+	for _, result := range fetchNftMetadata(ctx, jobs, q.client, settings.timeout, settings.ipfs, settings.fetcher, settings.step) {
+		if ctx.Err() != nil {
+			// the interrupted jobs are attempted again by the next run
+			break
+		}
+		if result.err == nil && q.media != nil {
+			q.cacheMedia(ctx, result.metadata, settings)
+		}
+		if result.err == nil {
+			result.err = q.store(ctx, result)
+		}
+		if errors.Is(result.err, errClaimLost) {
+			logger.WithFields(logrus.Fields{"address": result.job.Address, "token_id": result.job.TokenId}).Warn("NFT metadata job claimed by another worker, its lease expired")
+			continue
+		}
+		if result.err != nil {
+			q.fail(ctx, result.job, result.err)
+		}
+	}
+	return jobs, nil
+}
+
+// cacheMedia caches the image of the metadata, or takes the cached image of the stored metadata if the image has not changed.
+// The metadata is stored even if its image cannot be cached, the image is cached again when the metadata is refreshed.
+func (q *NftMetadataQueue) cacheMedia(ctx context.Context, metadata *db.NftMetadata, settings nftMetadataSettings) {
+	if metadata.Image == "" {
+		return
+	}
+
+	previous := &db.NftMetadata{}
+	err := q.db.NewSelect().Model(previous).
+		Column("image", "image_cache_path", "image_mime_type", "thumbnail_cache_path").
+		Where("token_id = ? AND address = ?", metadata.TokenId, metadata.Address).
+		Scan(ctx)
+	if err == nil && previous.Image == metadata.Image && previous.ImageCachePath != "" {
+		metadata.ImageCachePath = previous.ImageCachePath
+		metadata.ImageMimeType = previous.ImageMimeType
+		metadata.ThumbnailCachePath = previous.ThumbnailCachePath
+		metrics.NftMedia.WithLabelValues(metrics.MediaReused).Inc()
+		return
+	}
+
+	err = cacheNftMedia(ctx, q.media, metadata, settings.ipfs, settings.fetcher)
+	fields := logrus.Fields{"address": metadata.Address, "token_id": metadata.TokenId}
+	switch {
+	case err == nil:
+		metrics.NftMedia.WithLabelValues(metrics.MediaCached).Inc()
+	case isRejected(err), errors.Is(err, media.ErrUnsupportedType), errors.Is(err, errUnsupportedUri), errors.Is(err, errInvalidUri):
+		metrics.NftMedia.WithLabelValues(metrics.MediaRejected).Inc()
+		logger.WithFields(fields).WithError(err).Info("NFT image rejected by the media cache")
+	default:
+		metrics.NftMedia.WithLabelValues(metrics.MediaError).Inc()
+		logger.WithFields(fields).WithError(err).Warn("Cannot cache NFT image")
+	}
+}
+
+// store replaces the stored metadata of the token with the fetched one and marks the job as done
+func (q *NftMetadataQueue) store(ctx context.Context, result *nftMetadataResult) error {
+	err := q.db.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bundb.Tx) error {
+		// the job is updated first, so that its row stays locked while the metadata is replaced
+		if err := q.finish(ctx, tx, result.job, func(update *bundb.UpdateQuery) *bundb.UpdateQuery {
+			return update.Set("status = ?", db.NftMetadataJobDone).Set("last_error = NULL")
+		}); err != nil {
+			return err
+		}
+
+		// the replaced metadata is kept as a version, unless the document has not changed
+		_, err := tx.ExecContext(ctx, `INSERT INTO nft_metadata_versions (`+nftMetadataVersionColumns+`)
+			SELECT `+nftMetadataVersionColumns+` FROM nft_metadata
+			WHERE token_id = ? AND address = ? AND content_hash IS DISTINCT FROM ?`, result.job.TokenId, result.job.Address, result.metadata.ContentHash)
+		if err != nil {
+			return err
+		}
+
+		metadataIds := tx.NewSelect().Table("nft_metadata").Column("id").Where("token_id = ? AND address = ?", result.job.TokenId, result.job.Address)
+		if _, err := tx.NewDelete().Table("nft_metadata_attributes").Where("nft_metadata_id IN (?)", metadataIds).Exec(ctx); err != nil {
+			return err
+		}
+		if _, err := tx.NewDelete().Table("nft_metadata").Where("token_id = ? AND address = ?", result.job.TokenId, result.job.Address).Exec(ctx); err != nil {
+			return err
+		}
+
+		if _, err := tx.NewInsert().Model(result.metadata).Exec(ctx); err != nil {
+			logger.WithError(err).Error("Error during inserting nft metadata in DB")
+			return err
+		}
+		if len(result.attributes) != 0 {
+			if _, err := tx.NewInsert().Model(&result.attributes).Exec(ctx); err != nil {
+				logger.WithError(err).Error("Error during inserting nft metadata attributes in DB")
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		metrics.NftMetadataJobs.WithLabelValues(metrics.MetadataJobDone).Inc()
+	}
+	return err
+}
+
+// finish records the outcome of the job set by outcome and releases its claim. A job queued again while its metadata was being fetched
+// stays pending, with its claim released. errClaimLost is returned if the job is no longer claimed by this worker.
+func (q *NftMetadataQueue) finish(ctx context.Context, idb bundb.IDB, job *db.NftMetadataJob, outcome func(*bundb.UpdateQuery) *bundb.UpdateQuery) error {
+	update := idb.NewUpdate().Model((*db.NftMetadataJob)(nil)).
+		Set("claim_token = NULL").
+		Set("claimed_until = NULL").
+		Set("updated_at = current_timestamp").
+		Where("id = ?", job.Id).
+		Where("claim_token = ?", job.ClaimToken)
+	result, err := outcome(update).Where("updated_at = ?", job.UpdatedAt).Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if count, err := result.RowsAffected(); err != nil || count == 1 {
+		return err
+	}
+
+	result, err = idb.NewUpdate().Model((*db.NftMetadataJob)(nil)).
+		Set("claim_token = NULL").
+		Set("claimed_until = NULL").
+		Where("id = ?", job.Id).
+		Where("claim_token = ?", job.ClaimToken).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if count, err := result.RowsAffected(); err != nil || count == 1 {
+		return err
+	}
+	return errClaimLost
+}
+
+// fail schedules the next attempt of the job, or marks it as failed if it cannot succeed or has no attempts left
+func (q *NftMetadataQueue) fail(ctx context.Context, job *db.NftMetadataJob, jobErr error) {
+	fields := logrus.Fields{
+		"address":  job.Address,
+		"token_id": job.TokenId,
+		"attempts": job.Attempts,
+	}
+
+	var outcome func(*bundb.UpdateQuery) *bundb.UpdateQuery
+	if isPermanent(jobErr) || job.Attempts >= q.maxAttempts {
+		outcome = func(update *bundb.UpdateQuery) *bundb.UpdateQuery {
+			return update.Set("status = ?", db.NftMetadataJobFailed).Set("last_error = ?", jobErr.Error())
+		}
+		metrics.NftMetadataJobs.WithLabelValues(metrics.MetadataJobFailed).Inc()
+		logger.WithFields(fields).WithError(jobErr).Warn("NFT metadata job failed")
+	} else {
+		delay := metadataJobBackoff(job.Attempts)
+		outcome = func(update *bundb.UpdateQuery) *bundb.UpdateQuery {
+			return update.Set("next_attempt_at = current_timestamp + ? * interval '1 second'", int64(delay/time.Second)).Set("last_error = ?", jobErr.Error())
+		}
+		metrics.NftMetadataJobs.WithLabelValues(metrics.MetadataJobRetry).Inc()
+		logger.WithFields(fields).WithField("retry_in", delay.String()).WithError(jobErr).Info("NFT metadata job failed, retrying later")
+	}
+
+	if err := q.finish(ctx, q.db, job, outcome); err != nil {
+		logger.WithFields(fields).WithError(err).Error("Error during updating nft metadata job in DB")
+	}
+}
+
+// isPermanent reports whether the metadata cannot be fetched whatever the number of attempts
+func isPermanent(err error) bool {
+	return errors.Is(err, errNoUri) || errors.Is(err, errUnsupportedUri) || errors.Is(err, errInvalidUri) || isRejected(err)
+}
+
+func metadataJobBackoff(attempts int) time.Duration {
+	delay := metadataBackoff
+	for i := 1; i < attempts && delay < metadataMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > metadataMaxBackoff {
+		return metadataMaxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,68 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"ethernal/explorer/common"
+	"ethernal/explorer/config"
+	"ethernal/explorer/db"
+	"ethernal/explorer/db/dbtest"
+	"testing"
+
+	bundb "github.com/uptrace/bun"
+)
+
+func TestNftMetadataClaims(t *testing.T) {
+	database := dbtest.New(t, &config.Config{})
+	ctx := context.Background()
+	jobs := []*db.NftMetadataJob{}
+	for _, tokenId := range []string{"1", "2", "3"} {
+		jobs = append(jobs, &db.NftMetadataJob{TokenId: tokenId, Address: "0x1000000000000000000000000000000000000001", TokenTypeId: common.ERC721Type, Status: db.NftMetadataJobPending})
+	}
+	if _, err := database.NewInsert().Model(&jobs).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// two queues stand for two processes sharing the database
+	first := &NftMetadataQueue{db: database, maxAttempts: 3}
+	second := &NftMetadataQueue{db: database, maxAttempts: 3}
+	claimedByFirst, err := first.claim(ctx, 2)
+	if err != nil || len(claimedByFirst) != 2 {
+		t.Fatalf("first queue claimed %d jobs, expected 2 (err: %v)", len(claimedByFirst), err)
+	}
+	claimedBySecond, err := second.claim(ctx, 10)
+	if err != nil || len(claimedBySecond) != 1 || claimedBySecond[0].Id == claimedByFirst[0].Id || claimedBySecond[0].Id == claimedByFirst[1].Id {
+		t.Fatalf("second queue claimed %+v, expected the remaining job (err: %v)", claimedBySecond, err)
+	}
+	if again, err := second.claim(ctx, 10); err != nil || len(again) != 0 {
+		t.Fatalf("claimed %d jobs held by the other queue (err: %v)", len(again), err)
+	}
+
+	first.release(claimedByFirst)
+	released, err := second.claim(ctx, 10)
+	if err != nil || len(released) != 2 {
+		t.Fatalf("claimed %d released jobs, expected 2 (err: %v)", len(released), err)
+	}
+
+	// the lease of a process which stopped without releasing its jobs expires
+	expired := claimedBySecond[0]
+	if _, err := database.NewUpdate().Model((*db.NftMetadataJob)(nil)).Set("claimed_until = current_timestamp - interval '1 second'").Where("id = ?", expired.Id).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	reclaimed, err := first.claim(ctx, 10)
+	if err != nil || len(reclaimed) != 1 || reclaimed[0].Id != expired.Id || reclaimed[0].Attempts != 2 {
+		t.Fatalf("reclaimed %+v, expected the expired job at its second attempt (err: %v)", reclaimed, err)
+	}
+	if err := second.finish(ctx, database, expired, func(update *bundb.UpdateQuery) *bundb.UpdateQuery { return update }); !errors.Is(err, errClaimLost) {
+		t.Fatalf("finished a job claimed again with %v, expected errClaimLost", err)
+	}
+
+	first.fail(ctx, reclaimed[0], errors.New("timeout"))
+	job := &db.NftMetadataJob{}
+	if err := database.NewSelect().Model(job).Where("id = ?", expired.Id).Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != db.NftMetadataJobPending || job.ClaimToken != "" || !job.ClaimedUntil.IsZero() || job.LastError != "timeout" || !job.NextAttemptAt.After(job.UpdatedAt) {
+		t.Fatalf("unexpected failed job %+v", job)
+	}
+}
@@ -2,18 +2,17 @@ package eth
 
 import (
 	"context"
-	"database/sql"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"ethernal/explorer/common"
 	"ethernal/explorer/db"
+	"ethernal/explorer/ipfs"
+	"ethernal/explorer/metrics"
+	"ethernal/explorer/tracing"
 	"ethernal/explorer/utils"
 	"fmt"
-	"io/ioutil"
 	"math"
 	"math/big"
-	"net/http"
-	"regexp"
 	"strings"
 	"time"
 
@@ -21,7 +20,7 @@ import (
 	ethereumCommon "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/sirupsen/logrus"
-	bundb "github.com/uptrace/bun"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Block struct {
@@ -93,18 +92,6 @@ type Log struct {
 	//Removed          bool
 }
 
-type NftMetadata struct {
-	Name                  string                 `json:"name"`
-	Image                 string                 `json:"image"`
-	Description           string                 `json:"description"`
-	NftMetadataAttributes []NftMetadataAttribute `json:"attributes"`
-}
-
-type NftMetadataAttribute struct {
-	TraitType string `json:"trait_type"`
-	Value     string `json:"value"`
-}
-
 func CreateDbBlock(block *Block) *db.Block {
 	return &db.Block{
 		Hash:              block.Hash,
@@ -128,7 +115,7 @@ func CreateDbTransaction(transaction *Transaction, receipt *TransactionReceipt)
 		transaction.BlockNumber != receipt.BlockNumber ||
 		transaction.TransactionIndex != receipt.TransactionIndex ||
 		transaction.Hash != receipt.TransactionHash {
-		logrus.Panic("Error converting transaction and receipt to DbTransaction")
+		logger.Panic("Error converting transaction and receipt to DbTransaction")
 		return &db.Transaction{}
 	}
 
@@ -163,7 +150,7 @@ func CreateDbLog(transaction *Transaction, receipt *TransactionReceipt) []*db.Lo
 		transaction.BlockNumber != receipt.BlockNumber ||
 		transaction.TransactionIndex != receipt.TransactionIndex ||
 		transaction.Hash != receipt.TransactionHash {
-		logrus.Panic("Error converting transaction and receipt to DbLog")
+		logger.Panic("Error converting transaction and receipt to DbLog")
 		return []*db.Log{}
 	}
 
@@ -196,7 +183,10 @@ func CreateDbLog(transaction *Transaction, receipt *TransactionReceipt) []*db.Lo
 	return logs
 }
 
-func CreateDbNftTransfers(receipt *TransactionReceipt) ([]*db.NftTransfer, error) {
+// CreateDbNftTransfers returns the transfers of the ERC-721 and ERC-1155 tokens of the transaction. An ERC-2309 ConsecutiveTransfer
+// event is stored as the transfers of its tokens, unless its range has more than maxConsecutive tokens: it is then stored by
+// CreateDbNftTransferRanges.
+func CreateDbNftTransfers(receipt *TransactionReceipt, maxConsecutive uint64) ([]*db.NftTransfer, error) {
 	var dbNftTransfers []*db.NftTransfer
 	for _, log := range receipt.Logs {
 		if len(log.Topics) == 4 && log.Topics[0] == common.Erc721TransferEvent.Signature {
@@ -259,6 +249,12 @@ func CreateDbNftTransfers(receipt *TransactionReceipt) ([]*db.NftTransfer, error
 				}
 				dbNftTransfers = append(dbNftTransfers, nftTransfer)
 			}
+		} else if len(log.Topics) == 4 && log.Topics[0] == common.Erc2309ConsecutiveTransferEvent.Signature {
+			parsedLog := &Erc2309ConsecutiveTransfer{}
+			if err := parseLog(parsedLog, log, common.Erc2309ConsecutiveTransferEvent.Name, common.Erc2309ConsecutiveTransferEvent.Abi); err != nil {
+				return nil, err
+			}
+			dbNftTransfers = append(dbNftTransfers, consecutiveTransfers(log, parsedLog, maxConsecutive)...)
 		} else {
 			continue
 		}
@@ -266,32 +262,212 @@ func CreateDbNftTransfers(receipt *TransactionReceipt) ([]*db.NftTransfer, error
 	return dbNftTransfers, nil
 }
 
-func CreateDbNftMetadata(dbNftTransfers []*db.NftTransfer, client rpc.Client, timeout uint, ipfsGateway string, step uint, bunDb *bundb.DB, ctx context.Context) {
-	metadataForProcessing := []*db.NftTransfer{}
-	for _, nftTransfer := range dbNftTransfers {
-		// if nft mint
-		if nftTransfer.From == "0x0000000000000000000000000000000000000000" {
-			exists, _ := bunDb.NewSelect().Table("nft_metadata").Column("id").Where("token_id = ? AND address = ?", nftTransfer.TokenId, nftTransfer.Address).Exists(ctx)
-			// if metadata does not exist in the database, check if it is in the dictionary
-			if !exists {
-				dictionary := GetMetadataDictionaryInstance()
-				key := nftTransfer.TokenId + "-" + nftTransfer.Address
-
-				// we start processing metadata only if it has been added to the dictionary (if another goroutine has not already started processing metadata for the same nft)
-				if added := dictionary.TryAdd(key, true); added {
-					exists, _ = bunDb.NewSelect().Table("nft_metadata").Column("id").Where("token_id = ? AND address = ?", nftTransfer.TokenId, nftTransfer.Address).Exists(ctx)
-					if !exists {
-						metadataForProcessing = append(metadataForProcessing, nftTransfer)
-					} else {
-						dictionary.TryRemove(key)
-					}
+// consecutiveTransfers returns a transfer for every token of the range of the ConsecutiveTransfer event. A range of more than
+// maxTokens tokens is left to CreateDbNftTransferRanges, as a contract can announce billions of tokens in one event, and an inverted
+// range is skipped.
+func consecutiveTransfers(log Log, event *Erc2309ConsecutiveTransfer, maxTokens uint64) []*db.NftTransfer {
+	count := consecutiveCount(event)
+	if count.Sign() <= 0 {
+		logger.WithFields(consecutiveFields(log, event)).Warn("ConsecutiveTransfer range skipped, it is inverted")
+		metrics.NftSkippedRanges.Inc()
+		return nil
+	}
+	if !count.IsUint64() || count.Uint64() > maxTokens {
+		return nil
+	}
+
+	dbNftTransfers := make([]*db.NftTransfer, 0, count.Uint64())
+	for tokenId := new(big.Int).Set(event.FromTokenId); tokenId.Cmp(event.ToTokenId) <= 0; tokenId.Add(tokenId, big.NewInt(1)) {
+		dbNftTransfers = append(dbNftTransfers, &db.NftTransfer{
+			BlockHash:       log.BlockHash,
+			Index:           utils.ToUint32(log.LogIndex),
+			BlockNumber:     utils.ToUint64(log.BlockNumber),
+			TransactionHash: log.TransactionHash,
+			Address:         log.Address,
+			From:            event.FromAddress.String(),
+			To:              event.ToAddress.String(),
+			TokenId:         tokenId.String(),
+			TokenTypeId:     common.ERC721Type,
+		})
+	}
+	return dbNftTransfers
+}
+
+// CreateDbNftTransferRanges returns the ERC-2309 ConsecutiveTransfer events of the transaction with more than maxConsecutive tokens.
+// Their tokens are not stored as transfers, the range is stored instead so that it is still counted in its collection.
+func CreateDbNftTransferRanges(receipt *TransactionReceipt, maxConsecutive uint64) ([]*db.NftTransferRange, error) {
+	var dbNftTransferRanges []*db.NftTransferRange
+	for _, log := range receipt.Logs {
+		if len(log.Topics) != 4 || log.Topics[0] != common.Erc2309ConsecutiveTransferEvent.Signature {
+			continue
+		}
+		parsedLog := &Erc2309ConsecutiveTransfer{}
+		if err := parseLog(parsedLog, log, common.Erc2309ConsecutiveTransferEvent.Name, common.Erc2309ConsecutiveTransferEvent.Abi); err != nil {
+			return nil, err
+		}
+		count := consecutiveCount(parsedLog)
+		if count.Sign() <= 0 || (count.IsUint64() && count.Uint64() <= maxConsecutive) {
+			continue
+		}
+
+		logger.WithFields(consecutiveFields(log, parsedLog)).Warn("ConsecutiveTransfer range stored as a range, it has too many tokens")
+		metrics.NftSkippedRanges.Inc()
+		dbNftTransferRanges = append(dbNftTransferRanges, &db.NftTransferRange{
+			BlockHash:       log.BlockHash,
+			Index:           utils.ToUint32(log.LogIndex),
+			BlockNumber:     utils.ToUint64(log.BlockNumber),
+			TransactionHash: log.TransactionHash,
+			Address:         log.Address,
+			From:            parsedLog.FromAddress.String(),
+			To:              parsedLog.ToAddress.String(),
+			FromTokenId:     parsedLog.FromTokenId.String(),
+			ToTokenId:       parsedLog.ToTokenId.String(),
+			TokenCount:      count.String(),
+		})
+	}
+	return dbNftTransferRanges, nil
+}
+
+// consecutiveCount returns the number of tokens of the range of the ConsecutiveTransfer event, not positive if it is inverted
+func consecutiveCount(event *Erc2309ConsecutiveTransfer) *big.Int {
+	count := new(big.Int).Sub(event.ToTokenId, event.FromTokenId)
+	return count.Add(count, big.NewInt(1))
+}
+
+func consecutiveFields(log Log, event *Erc2309ConsecutiveTransfer) logrus.Fields {
+	return logrus.Fields{
+		"transaction":   log.TransactionHash,
+		"index":         log.LogIndex,
+		"address":       log.Address,
+		"from_token_id": event.FromTokenId.String(),
+		"to_token_id":   event.ToTokenId.String(),
+	}
+}
+
+// CreateDbNftLocks returns the ERC-5192 Locked and Unlocked events of the transaction. A malformed event is skipped.
+func CreateDbNftLocks(receipt *TransactionReceipt) []*db.NftLock {
+	var dbNftLocks []*db.NftLock
+	for _, log := range receipt.Logs {
+		if len(log.Topics) != 1 {
+			continue
+		}
+		var eventName, eventAbi string
+		switch log.Topics[0] {
+		case common.Erc5192LockedEvent.Signature:
+			eventName, eventAbi = common.Erc5192LockedEvent.Name, common.Erc5192LockedEvent.Abi
+		case common.Erc5192UnlockedEvent.Signature:
+			eventName, eventAbi = common.Erc5192UnlockedEvent.Name, common.Erc5192UnlockedEvent.Abi
+		default:
+			continue
+		}
+
+		parsedLog := &Erc5192Lock{}
+		if err := parseLog(parsedLog, log, eventName, eventAbi); err != nil {
+			logger.WithFields(logrus.Fields{"transaction": log.TransactionHash, "index": log.LogIndex}).WithError(err).Warn("Cannot parse lock event")
+			continue
+		}
+		dbNftLocks = append(dbNftLocks, &db.NftLock{
+			BlockHash:       log.BlockHash,
+			Index:           utils.ToUint32(log.LogIndex),
+			BlockNumber:     utils.ToUint64(log.BlockNumber),
+			TransactionHash: log.TransactionHash,
+			Address:         log.Address,
+			TokenId:         parsedLog.TokenId.String(),
+			Locked:          log.Topics[0] == common.Erc5192LockedEvent.Signature,
+		})
+	}
+	return dbNftLocks
+}
+
+// CreateDbTokenBoundAccounts returns the ERC-6551 accounts created in the transaction, by a registry of version 0.3
+// or of an earlier version. A malformed event is skipped.
+func CreateDbTokenBoundAccounts(receipt *TransactionReceipt) []*db.TokenBoundAccount {
+	var dbAccounts []*db.TokenBoundAccount
+	for _, log := range receipt.Logs {
+		var account *db.TokenBoundAccount
+		var err error
+		if len(log.Topics) == 4 && log.Topics[0] == common.Erc6551AccountCreatedEvent.Signature {
+			parsedLog := &Erc6551AccountCreated{}
+			if err = parseLog(parsedLog, log, common.Erc6551AccountCreatedEvent.Name, common.Erc6551AccountCreatedEvent.Abi); err == nil {
+				account = &db.TokenBoundAccount{
+					Account:        parsedLog.Account.String(),
+					Implementation: parsedLog.Implementation.String(),
+					Salt:           ethereumCommon.Hash(parsedLog.Salt).Hex(),
+					ChainId:        parsedLog.ChainId.String(),
+					TokenContract:  parsedLog.TokenContract.String(),
+					TokenId:        parsedLog.TokenId.String(),
 				}
 			}
+		} else if len(log.Topics) == 1 && log.Topics[0] == common.Erc6551LegacyAccountCreatedEvent.Signature {
+			parsedLog := &Erc6551LegacyAccountCreated{}
+			if err = parseLog(parsedLog, log, common.Erc6551LegacyAccountCreatedEvent.Name, common.Erc6551LegacyAccountCreatedEvent.Abi); err == nil {
+				account = &db.TokenBoundAccount{
+					Account:        parsedLog.Account.String(),
+					Implementation: parsedLog.Implementation.String(),
+					Salt:           ethereumCommon.BigToHash(parsedLog.Salt).Hex(),
+					ChainId:        parsedLog.ChainId.String(),
+					TokenContract:  parsedLog.TokenContract.String(),
+					TokenId:        parsedLog.TokenId.String(),
+				}
+			}
+		} else {
+			continue
+		}
+
+		if err != nil {
+			logger.WithFields(logrus.Fields{"transaction": log.TransactionHash, "index": log.LogIndex}).WithError(err).Warn("Cannot parse account creation event")
+			continue
 		}
+		account.BlockHash = log.BlockHash
+		account.Index = utils.ToUint32(log.LogIndex)
+		account.BlockNumber = utils.ToUint64(log.BlockNumber)
+		account.TransactionHash = log.TransactionHash
+		account.Registry = log.Address
+		dbAccounts = append(dbAccounts, account)
 	}
-	if len(metadataForProcessing) > 0 {
-		go processNftMetadata(metadataForProcessing, client, timeout, ipfsGateway, step, bunDb)
+	return dbAccounts
+}
+
+// NftMetadataUpdate announces that the metadata of the tokens of a contract, from FromTokenId to ToTokenId, has changed
+type NftMetadataUpdate struct {
+	Address     string
+	FromTokenId string
+	ToTokenId   string
+}
+
+// CreateNftMetadataUpdates returns the metadata changes announced by the ERC-4906 MetadataUpdate and BatchMetadataUpdate
+// and the ERC-1155 URI events of the transaction. A malformed event is skipped, it must not stop the synchronization.
+func CreateNftMetadataUpdates(receipt *TransactionReceipt) []*NftMetadataUpdate {
+	var updates []*NftMetadataUpdate
+	for _, log := range receipt.Logs {
+		var update *NftMetadataUpdate
+		var err error
+		if len(log.Topics) == 1 && log.Topics[0] == common.Erc4906MetadataUpdateEvent.Signature {
+			parsedLog := &Erc4906MetadataUpdate{}
+			if err = parseLog(parsedLog, log, common.Erc4906MetadataUpdateEvent.Name, common.Erc4906MetadataUpdateEvent.Abi); err == nil {
+				update = &NftMetadataUpdate{Address: log.Address, FromTokenId: parsedLog.TokenId.String(), ToTokenId: parsedLog.TokenId.String()}
+			}
+		} else if len(log.Topics) == 1 && log.Topics[0] == common.Erc4906BatchMetadataUpdateEvent.Signature {
+			parsedLog := &Erc4906BatchMetadataUpdate{}
+			if err = parseLog(parsedLog, log, common.Erc4906BatchMetadataUpdateEvent.Name, common.Erc4906BatchMetadataUpdateEvent.Abi); err == nil {
+				update = &NftMetadataUpdate{Address: log.Address, FromTokenId: parsedLog.FromTokenId.String(), ToTokenId: parsedLog.ToTokenId.String()}
+			}
+		} else if len(log.Topics) == 2 && log.Topics[0] == common.Erc1155UriEvent.Signature {
+			parsedLog := &Erc1155Uri{}
+			if err = parseLog(parsedLog, log, common.Erc1155UriEvent.Name, common.Erc1155UriEvent.Abi); err == nil {
+				update = &NftMetadataUpdate{Address: log.Address, FromTokenId: parsedLog.Id.String(), ToTokenId: parsedLog.Id.String()}
+			}
+		} else {
+			continue
+		}
+
+		if err != nil {
+			logger.WithFields(logrus.Fields{"transaction": log.TransactionHash, "index": log.LogIndex}).WithError(err).Warn("Cannot parse metadata update event")
+			continue
+		}
+		updates = append(updates, update)
 	}
+	return updates
 }
 
 func parseLog(out interface{}, log Log, eventName string, eventAbi string) error {
@@ -318,43 +494,46 @@ func parseLog(out interface{}, log Log, eventName string, eventAbi string) error
 	return abi.ParseTopics(out, indexed, topics)
 }
 
-func processNftMetadata(dbNftTransfers []*db.NftTransfer, client rpc.Client, timeout uint, ipfsGateway string, step uint, bunDb *bundb.DB) {
-	metadataList := []*NftMetadata{}
-	dbNftMetadataList := []*db.NftMetadata{}
-	dbNftMetadataAttributes := []*db.NftMetadataAttribute{}
+// nftMetadataResult is the fetched metadata of the token of a job, or why it could not be fetched
+type nftMetadataResult struct {
+	job        *db.NftMetadataJob
+	metadata   *db.NftMetadata
+	attributes []*db.NftMetadataAttribute
+	err        error
+}
+
+// fetchNftMetadata gets the metadata URIs of the tokens from the blockchain in batches of step calls and fetches the metadata from them.
+// It returns one result for every job, in the same order.
+func fetchNftMetadata(ctx context.Context, jobs []*db.NftMetadataJob, client *rpc.Client, timeout uint, ipfsClient *ipfs.Client, fetcher *httpFetcher, step uint) []*nftMetadataResult {
 	metadataUrls := []*string{}
 	var elems []rpc.BatchElem
 	type params struct {
 		To   string `json:"to"`
 		Data string `json:"data"`
 	}
-	ctx, cancel := context.WithCancel(context.TODO())
-	defer cancel()
+	ctx, span := tracing.Start(ctx, "nft.fetch_metadata", attribute.Int("tokens.count", len(jobs)))
+	defer span.End()
 
-	for _, dbNftTransfer := range dbNftTransfers {
-		metadata := &NftMetadata{
-			NftMetadataAttributes: make([]NftMetadataAttribute, 0),
-		}
+	for _, job := range jobs {
 		var metadataUrl string
 		var data []byte
-		if dbNftTransfer.TokenTypeId == common.ERC721Type {
+		if job.TokenTypeId == common.ERC721Type {
 			parsedAbi, _ := abi.JSON(strings.NewReader("[" + common.TokenUriMethod.Abi + "]"))
 			tokenId := new(big.Int)
-			tokenId.SetString(dbNftTransfer.TokenId, 10)
+			tokenId.SetString(job.TokenId, 10)
 			data, _ = parsedAbi.Pack(common.TokenUriMethod.Name, tokenId)
-		} else if dbNftTransfer.TokenTypeId == common.ERC1155Type {
+		} else if job.TokenTypeId == common.ERC1155Type {
 			parsedAbi, _ := abi.JSON(strings.NewReader("[" + common.UriMethod.Abi + "]"))
 			tokenId := new(big.Int)
-			tokenId.SetString(dbNftTransfer.TokenId, 10)
+			tokenId.SetString(job.TokenId, 10)
 			data, _ = parsedAbi.Pack(common.UriMethod.Name, tokenId)
 		}
 
 		elems = append(elems, rpc.BatchElem{
 			Method: "eth_call",
-			Args:   []interface{}{params{dbNftTransfer.Address, "0x" + hex.EncodeToString(data)}, "latest"},
+			Args:   []interface{}{params{job.Address, "0x" + hex.EncodeToString(data)}, "latest"},
 			Result: &metadataUrl,
 		})
-		metadataList = append(metadataList, metadata)
 		metadataUrls = append(metadataUrls, &metadataUrl)
 	}
 
@@ -365,111 +544,101 @@ func processNftMetadata(dbNftTransfers []*db.NftTransfer, client rpc.Client, tim
 		to := int(math.Min(float64(len(elems)), float64((i+1)*step)))
 		elemSlice := elems[from:to]
 		ctxWithTimeout, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
-		defer cancel()
+		ctxWithTimeout, batchSpan := tracing.Start(ctxWithTimeout, "rpc.batch", tracing.RpcBatch(elemSlice)...)
+		start := time.Now()
 		err := client.BatchCallContext(ctxWithTimeout, elemSlice)
+		metrics.ObserveRpcBatch(elemSlice, start, err)
+		tracing.End(batchSpan, tracing.BatchError(elemSlice, err))
+		cancel()
 		if err != nil {
-			logrus.Error("Cannot get metadata url from blockchain, err: ", err)
+			logger.WithField("rpc_method", "eth_call").WithError(err).Error("Cannot get metadata url from blockchain")
+			// the calls of the batch are retried with the jobs
+			for j := range elemSlice {
+				elemSlice[j].Error = err
+			}
 		}
-
 	}
 
+	results := make([]*nftMetadataResult, len(jobs))
 	for i, metadataUrl := range metadataUrls {
-		url := *metadataUrl
-		if len(url) > 0 && url[0:2] == "0x" {
-			url = url[2:]
+		results[i] = &nftMetadataResult{job: jobs[i]}
+		if elems[i].Error != nil {
+			results[i].err = fmt.Errorf("cannot get the metadata uri: %w", elems[i].Error)
+			continue
 		}
 
-		bs, _ := hex.DecodeString(url)
-		re := regexp.MustCompile(`[^a-zA-Z0-9@:%._\+~#?&//=]+`)
-		str := re.ReplaceAllString(string(bs), "")
-		r, _ := regexp.Compile(`(?P<protocol>\w+):\/\/(?P<route>.*)`)
-		m := r.FindStringSubmatch(str)
-
-		if len(m) > 0 {
-			result := make(map[string]string)
-			for i, name := range r.SubexpNames() {
-				if i != 0 && name != "" {
-					result[name] = m[i]
-				}
-			}
-			protocol := result["protocol"]
-
-			if strings.Contains(protocol, "ipfs") {
-				url := ipfsGateway + result["route"]
-				getJson(url, metadataList[i], timeout)
-			} else if strings.Contains(protocol, "https") {
-				url := "https://" + result["route"]
-				getJson(url, metadataList[i], timeout)
-			} else if strings.Contains(protocol, "http") {
-				url := "http://" + result["route"]
-				getJson(url, metadataList[i], timeout)
-			}
+		uri, err := decodeTokenUri(*metadataUrl)
+		var source metadataSource
+		if err == nil {
+			source, err = resolveTokenUri(uri, jobs[i].TokenId, jobs[i].TokenTypeId)
 		}
-		dbNftMetadata := &db.NftMetadata{
-			TokenId:     dbNftTransfers[i].TokenId,
-			Address:     dbNftTransfers[i].Address,
-			Name:        metadataList[i].Name,
-			Image:       metadataList[i].Image,
-			Description: metadataList[i].Description,
+		var raw []byte
+		if err == nil {
+			raw, err = source.read(ctx, ipfsClient, fetcher, metadataContentTypes, 0)
+		}
+		var document *metadataDocument
+		if err == nil {
+			document, err = parseMetadataDocument(raw)
+		}
+
+		switch {
+		case err == nil:
+			metrics.NftMetadataFetches.WithLabelValues(metrics.MetadataSuccess).Inc()
+		case errors.Is(err, errNoUri):
+			metrics.NftMetadataFetches.WithLabelValues(metrics.MetadataNoUri).Inc()
+		case errors.Is(err, errUnsupportedUri), errors.Is(err, errInvalidUri):
+			metrics.NftMetadataFetches.WithLabelValues(metrics.MetadataUnsupported).Inc()
+		case isRejected(err):
+			metrics.NftMetadataFetches.WithLabelValues(metrics.MetadataRejected).Inc()
+		default:
+			metrics.NftMetadataFetches.WithLabelValues(metrics.MetadataFetchError).Inc()
+		}
+		if err != nil {
+			results[i].err = err
+			continue
 		}
 
-		for _, attribute := range metadataList[i].NftMetadataAttributes {
-			dbNftAttribute := &db.NftMetadataAttribute{
+		dbNftMetadata := &db.NftMetadata{
+			TokenId:         jobs[i].TokenId,
+			Address:         jobs[i].Address,
+			Name:            document.Name,
+			Image:           document.Image,
+			Description:     document.Description,
+			AnimationUrl:    document.AnimationUrl,
+			ExternalUrl:     document.ExternalUrl,
+			BackgroundColor: document.BackgroundColor,
+			Raw:             string(document.Raw),
+			ContentHash:     document.ContentHash,
+			SourceUri:       uri,
+		}
+		results[i].metadata = dbNftMetadata
+		for _, attribute := range document.Attributes {
+			results[i].attributes = append(results[i].attributes, &db.NftMetadataAttribute{
 				TraitType:     attribute.TraitType,
 				Value:         attribute.Value,
+				ValueType:     attribute.ValueType,
+				NumericValue:  attribute.NumericValue,
+				DisplayType:   attribute.DisplayType,
+				MaxValue:      attribute.MaxValue,
 				NftMetadataId: &dbNftMetadata.Id,
-			}
-			dbNftMetadataAttributes = append(dbNftMetadataAttributes, dbNftAttribute)
+			})
 		}
-		dbNftMetadataList = append(dbNftMetadataList, dbNftMetadata)
 	}
-	dictionary := GetMetadataDictionaryInstance()
-	dictionary.itemsData <- itemsData{metadata: dbNftMetadataList, attributes: dbNftMetadataAttributes}
+	return results
 }
 
-func getJson(url string, target interface{}, timeout uint) error {
-	client := http.Client{
-		Timeout: time.Duration(timeout) * time.Second,
-	}
-	response, err := client.Get(url)
-	if err != nil {
-		logrus.Debug("Cannot get metadata from ", url, ", err: ", err)
-		return err
-	}
-	defer response.Body.Close()
-	if response.StatusCode != http.StatusOK {
-		logrus.Debug("Cannot get metadata from ", url, ", err: ", err)
-		return err
+// read returns the document of the source, read from IPFS or fetched from its URL unless it is the document itself.
+// contentTypes are the content types accepted from the URL. A file larger than maxSize bytes, or than the maximum size
+// of the fetch policy if maxSize is 0, is not read and media.ErrTooLarge is returned.
+func (s metadataSource) read(ctx context.Context, ipfsClient *ipfs.Client, fetcher *httpFetcher, contentTypes []string, maxSize int64) ([]byte, error) {
+	if maxSize == 0 {
+		maxSize = fetcher.policy.maxSize
 	}
-	read, _ := ioutil.ReadAll(response.Body)
-	return json.Unmarshal([]byte(read), target)
-}
-
-// SyncNftMetadata inserts nft metadata into the database.
-func SyncNftMetadata(bunDb *bundb.DB) {
-	dictionary := GetMetadataDictionaryInstance()
-	ctx := context.TODO()
-	for itemData := range dictionary.itemsData {
-		_ = bunDb.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bundb.Tx) error {
-			_, nftMetadataError := tx.NewInsert().Model(&itemData.metadata).Exec(ctx)
-			if nftMetadataError != nil {
-				logrus.Error("Error during inserting nft metadata in DB, err: ", nftMetadataError)
-				return nftMetadataError
-			}
-
-			if len(itemData.attributes) != 0 {
-				_, nftMetadataAttributeError := tx.NewInsert().Model(&itemData.attributes).Exec(ctx)
-				if nftMetadataAttributeError != nil {
-					logrus.Error("Error during inserting nft metadata attributes in DB, err: ", nftMetadataAttributeError)
-					return nftMetadataAttributeError
-				}
-			}
-			return nil
-		})
-		keys := make([]string, len(itemData.metadata))
-		for _, metadata := range itemData.metadata {
-			keys = append(keys, metadata.TokenId+"-"+metadata.Address)
-		}
-		dictionary.TryRemoveRange(keys)
+	switch {
+	case s.document != nil:
+		return s.document, nil
+	case s.ipfs != "":
+		return ipfsClient.Get(ctx, s.ipfs, maxSize)
 	}
+	return fetcher.get(ctx, s.url, contentTypes, maxSize)
 }
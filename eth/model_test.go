@@ -0,0 +1,218 @@
+package eth
+
+import (
+	"ethernal/explorer/common"
+	"ethernal/explorer/mocknode"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestCreateDbNftTransfers(t *testing.T) {
+	const (
+		contract = "0x1000000000000000000000000000000000000001"
+		alice    = "0x2000000000000000000000000000000000000002"
+		bob      = "0x3000000000000000000000000000000000000003"
+	)
+
+	chain := mocknode.NewChain()
+	number := chain.MineBlock(mocknode.Tx{
+		From: alice,
+		To:   contract,
+		Logs: []mocknode.LogSpec{
+			mocknode.Erc721Transfer(contract, mocknode.ZeroAddress, alice, 7),
+			mocknode.Erc1155TransferSingle(contract, alice, alice, bob, 3, 20),
+			{Address: contract, Topics: []string{"0x01"}, Data: "0x"},
+		},
+	})
+	node := mocknode.New(chain)
+	defer node.Close()
+	client, err := rpc.Dial(node.HTTPUrl())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	receipt := &TransactionReceipt{}
+	if err := client.Call(receipt, "eth_getTransactionReceipt", chain.BlockByNumber(number).Transactions[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	transfers, err := CreateDbNftTransfers(receipt, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transfers) != 2 {
+		t.Fatalf("got %d transfers, expected 2", len(transfers))
+	}
+
+	mint := transfers[0]
+	if mint.TokenTypeId != common.ERC721Type || mint.From != mocknode.ZeroAddress || mint.To != alice || mint.TokenId != "7" || mint.BlockNumber != number {
+		t.Fatalf("unexpected ERC-721 transfer %+v", mint)
+	}
+	single := transfers[1]
+	if single.TokenTypeId != common.ERC1155Type || single.From != alice || single.To != bob || single.TokenId != "3" || single.Value != "20" || single.Index != 1 {
+		t.Fatalf("unexpected ERC-1155 transfer %+v", single)
+	}
+}
+
+// getTestReceipt returns the receipt of the first transaction of the block, served by a mock node
+func getTestReceipt(t *testing.T, chain *mocknode.Chain, number uint64) *TransactionReceipt {
+	t.Helper()
+	node := mocknode.New(chain)
+	defer node.Close()
+	client, err := rpc.Dial(node.HTTPUrl())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	receipt := &TransactionReceipt{}
+	if err := client.Call(receipt, "eth_getTransactionReceipt", chain.BlockByNumber(number).Transactions[0]); err != nil {
+		t.Fatal(err)
+	}
+	return receipt
+}
+
+func TestConsecutiveTransfers(t *testing.T) {
+	const (
+		contract = "0x1000000000000000000000000000000000000001"
+		alice    = "0x2000000000000000000000000000000000000002"
+	)
+
+	chain := mocknode.NewChain()
+	number := chain.MineBlock(mocknode.Tx{
+		From: alice,
+		To:   contract,
+		Logs: []mocknode.LogSpec{
+			mocknode.ConsecutiveTransfer(contract, mocknode.ZeroAddress, alice, 10, 14),
+			// a too large range is stored as a range, an inverted one is skipped
+			mocknode.ConsecutiveTransfer(contract, mocknode.ZeroAddress, alice, 100, 1000),
+			mocknode.ConsecutiveTransfer(contract, mocknode.ZeroAddress, alice, 5, 4),
+		},
+	})
+	receipt := getTestReceipt(t, chain, number)
+
+	transfers, err := CreateDbNftTransfers(receipt, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transfers) != 5 {
+		t.Fatalf("got %d transfers, expected 5", len(transfers))
+	}
+	for i, transfer := range transfers {
+		if transfer.TokenTypeId != common.ERC721Type || transfer.From != mocknode.ZeroAddress || transfer.To != alice || transfer.TokenId != fmt.Sprint(10+i) || transfer.Index != 0 {
+			t.Fatalf("unexpected consecutive transfer %+v", transfer)
+		}
+	}
+
+	ranges, err := CreateDbNftTransferRanges(receipt, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ranges) != 1 {
+		t.Fatalf("got %d transfer ranges, expected 1", len(ranges))
+	}
+	if r := ranges[0]; r.From != mocknode.ZeroAddress || r.To != alice || r.FromTokenId != "100" || r.ToTokenId != "1000" || r.TokenCount != "901" || r.Index != 1 {
+		t.Fatalf("unexpected transfer range %+v", r)
+	}
+}
+
+func TestCreateDbNftLocksAndAccounts(t *testing.T) {
+	const (
+		contract       = "0x1000000000000000000000000000000000000001"
+		alice          = "0x2000000000000000000000000000000000000002"
+		registry       = "0x000000006551c19487814612e58FE06813775758"
+		account        = "0x4000000000000000000000000000000000000004"
+		implementation = "0x5000000000000000000000000000000000000005"
+	)
+
+	chain := mocknode.NewChain()
+	number := chain.MineBlock(mocknode.Tx{
+		From: alice,
+		To:   contract,
+		Logs: []mocknode.LogSpec{
+			mocknode.Locked(contract, 7, true),
+			mocknode.Locked(contract, 8, false),
+			mocknode.AccountCreated(registry, account, implementation, 1, 137, contract, 7),
+			// a Locked event without data is skipped
+			{Address: contract, Topics: []string{common.Erc5192LockedEvent.Signature}, Data: "0x"},
+		},
+	})
+	receipt := getTestReceipt(t, chain, number)
+
+	locks := CreateDbNftLocks(receipt)
+	if len(locks) != 2 || !locks[0].Locked || locks[0].TokenId != "7" || locks[1].Locked || locks[1].TokenId != "8" || locks[1].Index != 1 {
+		t.Fatalf("unexpected locks %+v", locks)
+	}
+
+	accounts := CreateDbTokenBoundAccounts(receipt)
+	if len(accounts) != 1 {
+		t.Fatalf("got %d accounts, expected 1", len(accounts))
+	}
+	created := accounts[0]
+	if created.Registry != strings.ToLower(registry) || created.Account != account || created.Implementation != implementation || created.ChainId != "137" ||
+		created.TokenContract != contract || created.TokenId != "7" || created.Salt != "0x0000000000000000000000000000000000000000000000000000000000000001" {
+		t.Fatalf("unexpected account %+v", created)
+	}
+}
+
+func TestCreateNftMetadataUpdates(t *testing.T) {
+	const (
+		contract = "0x1000000000000000000000000000000000000001"
+		alice    = "0x2000000000000000000000000000000000000002"
+	)
+
+	chain := mocknode.NewChain()
+	number := chain.MineBlock(mocknode.Tx{
+		From: alice,
+		To:   contract,
+		Logs: []mocknode.LogSpec{
+			mocknode.MetadataUpdate(contract, 7),
+			mocknode.Erc721Transfer(contract, mocknode.ZeroAddress, alice, 8),
+			mocknode.BatchMetadataUpdate(contract, 1, 100),
+			mocknode.Erc1155Uri(contract, "https://example.com/{id}.json", 3),
+			// a MetadataUpdate without data is skipped
+			{Address: contract, Topics: []string{common.Erc4906MetadataUpdateEvent.Signature}, Data: "0x"},
+		},
+	})
+	node := mocknode.New(chain)
+	defer node.Close()
+	client, err := rpc.Dial(node.HTTPUrl())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	receipt := &TransactionReceipt{}
+	if err := client.Call(receipt, "eth_getTransactionReceipt", chain.BlockByNumber(number).Transactions[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	updates := CreateNftMetadataUpdates(receipt)
+	expected := []NftMetadataUpdate{
+		{Address: contract, FromTokenId: "7", ToTokenId: "7"},
+		{Address: contract, FromTokenId: "1", ToTokenId: "100"},
+		{Address: contract, FromTokenId: "3", ToTokenId: "3"},
+	}
+	if len(updates) != len(expected) {
+		t.Fatalf("got %d metadata updates, expected %d", len(updates), len(expected))
+	}
+	for i, update := range updates {
+		if *update != expected[i] {
+			t.Fatalf("metadata update %d is %+v, expected %+v", i, *update, expected[i])
+		}
+	}
+}
+
+func TestMetadataJobBackoff(t *testing.T) {
+	expected := map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 4: 4 * time.Minute, 20: metadataMaxBackoff}
+	for attempts, delay := range expected {
+		if backoff := metadataJobBackoff(attempts); backoff != delay {
+			t.Fatalf("backoff after %d attempts is %s, expected %s", attempts, backoff, delay)
+		}
+	}
+}
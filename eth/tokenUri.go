@@ -0,0 +1,162 @@
+package eth
+
+import (
+	"encoding/base64"
+	"errors"
+	"ethernal/explorer/common"
+	"fmt"
+	"math/big"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// arweaveGateway serves the ar:// URIs
+const arweaveGateway = "https://arweave.net/"
+
+var (
+	errUnsupportedUri = errors.New("unsupported uri protocol")
+	errNoUri          = errors.New("token has no metadata uri")
+	errInvalidUri     = errors.New("invalid metadata uri")
+)
+
+// cidPattern matches a bare IPFS CID, version 0 (base58) or version 1 (base32), optionally followed by a path
+var cidPattern = regexp.MustCompile(`^(Qm[1-9A-HJ-NP-Za-km-z]{44}|b[a-z2-7]{58,})(/.*)?$`)
+
+var stringOutput = func() abi.Arguments {
+	stringType, _ := abi.NewType("string", "", nil)
+	return abi.Arguments{{Type: stringType}}
+}()
+
+// metadataSource is where the metadata of a token is read from: the URL to fetch, the IPFS content path (/ipfs/<cid>/<path>
+// or /ipns/<name>/<path>) to read, or the document itself for on-chain metadata
+type metadataSource struct {
+	url      string
+	ipfs     string
+	document []byte
+}
+
+// decodeTokenUri ABI-decodes the string returned by the tokenURI or uri call
+func decodeTokenUri(result string) (string, error) {
+	data, err := hexutil.Decode(result)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errInvalidUri, err)
+	}
+	if len(data) == 0 {
+		return "", errNoUri
+	}
+	values, err := stringOutput.Unpack(data)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errInvalidUri, err)
+	}
+	uri := strings.TrimSpace(strings.Trim(values[0].(string), "\x00"))
+	if uri == "" {
+		return "", errNoUri
+	}
+	return uri, nil
+}
+
+// resolveTokenUri returns where the metadata of the token is read from. The {id} placeholder of ERC-1155 URIs is replaced by the token id
+// as 64 hexadecimal characters. The IPFS and IPNS URIs and bare CIDs are read from IPFS, the Arweave URIs through their gateway.
+func resolveTokenUri(uri string, tokenId string, tokenTypeId int) (metadataSource, error) {
+	if tokenTypeId == common.ERC1155Type && strings.Contains(uri, "{id}") {
+		id, ok := new(big.Int).SetString(tokenId, 10)
+		if !ok {
+			return metadataSource{}, fmt.Errorf("%w: token id %q is not a number", errInvalidUri, tokenId)
+		}
+		uri = strings.ReplaceAll(uri, "{id}", fmt.Sprintf("%064x", id))
+	}
+
+	switch {
+	case strings.HasPrefix(strings.ToLower(uri), "data:"):
+		mediaType, document, err := decodeDataUri(uri)
+		if err == nil && mediaType != "" && mediaType != "application/json" && mediaType != "text/plain" {
+			return metadataSource{}, fmt.Errorf("%w: data uri of %s", errUnsupportedUri, mediaType)
+		}
+		return metadataSource{document: document}, err
+	case strings.HasPrefix(uri, "{"):
+		// some contracts return the JSON document itself
+		return metadataSource{document: []byte(uri)}, nil
+	}
+	return resolveUrl(uri)
+}
+
+// resolveMediaUri returns where a media file of the metadata is read from, the URIs are resolved as the metadata URIs.
+// The image_data field holds the SVG markup itself.
+func resolveMediaUri(uri string) (metadataSource, error) {
+	trimmed := strings.TrimSpace(uri)
+	switch {
+	case strings.HasPrefix(strings.ToLower(trimmed), "data:"):
+		_, document, err := decodeDataUri(trimmed)
+		return metadataSource{document: document}, err
+	case strings.HasPrefix(trimmed, "<"):
+		return metadataSource{document: []byte(trimmed)}, nil
+	}
+	return resolveUrl(trimmed)
+}
+
+// resolveUrl returns the URL of an http(s) or Arweave URI, or the IPFS content path of an IPFS or IPNS URI, path or bare CID
+func resolveUrl(uri string) (metadataSource, error) {
+	lower := strings.ToLower(uri)
+	switch {
+	case strings.HasPrefix(lower, "https://"), strings.HasPrefix(lower, "http://"):
+		return metadataSource{url: uri}, nil
+	case strings.HasPrefix(lower, "ipfs://"):
+		// ipfs://ipfs/<cid> is a common mistake for ipfs://<cid>
+		path := uri[len("ipfs://"):]
+		if strings.HasPrefix(strings.ToLower(path), "ipfs/") {
+			path = path[len("ipfs/"):]
+		}
+		return metadataSource{ipfs: contentPath("ipfs", path)}, nil
+	case strings.HasPrefix(lower, "ipns://"):
+		return metadataSource{ipfs: contentPath("ipns", uri[len("ipns://"):])}, nil
+	case strings.HasPrefix(lower, "ar://"):
+		return metadataSource{url: arweaveGateway + uri[len("ar://"):]}, nil
+	case strings.HasPrefix(uri, "/ipfs/"):
+		return metadataSource{ipfs: contentPath("ipfs", uri[len("/ipfs/"):])}, nil
+	case strings.HasPrefix(uri, "/ipns/"):
+		return metadataSource{ipfs: contentPath("ipns", uri[len("/ipns/"):])}, nil
+	case cidPattern.MatchString(uri):
+		return metadataSource{ipfs: contentPath("ipfs", uri)}, nil
+	}
+	return metadataSource{}, errUnsupportedUri
+}
+
+// contentPath returns the IPFS content path of the path in the namespace, ipfs or ipns. The query and the fragment of the URI are dropped.
+func contentPath(namespace string, path string) string {
+	if end := strings.IndexAny(path, "?#"); end >= 0 {
+		path = path[:end]
+	}
+	return "/" + namespace + "/" + strings.TrimPrefix(path, "/")
+}
+
+// decodeDataUri returns the media type and the data of a data: URI, data:[<media type>][;base64],<data>
+func decodeDataUri(uri string) (string, []byte, error) {
+	comma := strings.Index(uri, ",")
+	if comma < 0 {
+		return "", nil, fmt.Errorf("%w: data uri without data", errInvalidUri)
+	}
+	header := strings.ToLower(uri[len("data:"):comma])
+	data := uri[comma+1:]
+	mediaType := strings.TrimSpace(strings.Split(header, ";")[0])
+
+	if strings.HasSuffix(header, ";base64") {
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			// the padding is often left out
+			if decoded, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "=")); err != nil {
+				return "", nil, fmt.Errorf("%w: %v", errInvalidUri, err)
+			}
+		}
+		return mediaType, decoded, nil
+	}
+
+	// the data of a plain data URI is percent-encoded, or included as it is
+	if unescaped, err := url.PathUnescape(data); err == nil {
+		return mediaType, []byte(unescaped), nil
+	}
+	return mediaType, []byte(data), nil
+}
@@ -0,0 +1,111 @@
+package eth
+
+import (
+	"errors"
+	"ethernal/explorer/common"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func TestDecodeTokenUri(t *testing.T) {
+	encoded, err := stringOutput.Pack("ipfs://QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG/1.json\x00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, err := decodeTokenUri(hexutil.Encode(encoded))
+	if err != nil || uri != "ipfs://QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG/1.json" {
+		t.Fatalf("decoded uri %q (err: %v)", uri, err)
+	}
+
+	if _, err := decodeTokenUri("0x"); !errors.Is(err, errNoUri) {
+		t.Fatalf("empty result decoded with %v, expected errNoUri", err)
+	}
+	if _, err := decodeTokenUri("0x1234"); !errors.Is(err, errInvalidUri) {
+		t.Fatalf("truncated result decoded with %v, expected errInvalidUri", err)
+	}
+}
+
+func TestResolveTokenUri(t *testing.T) {
+	const (
+		cid   = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+		cidV1 = "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"
+	)
+	tests := []struct {
+		name        string
+		uri         string
+		tokenTypeId int
+		url         string
+		ipfs        string
+		document    string
+		err         error
+	}{
+		{name: "https", uri: "https://example.com/1.json", url: "https://example.com/1.json"},
+		{name: "http", uri: "http://example.com/1.json", url: "http://example.com/1.json"},
+		{name: "ipfs", uri: "ipfs://" + cid + "/1.json", ipfs: "/ipfs/" + cid + "/1.json"},
+		{name: "ipfs with ipfs prefix", uri: "ipfs://ipfs/" + cid + "/1.json", ipfs: "/ipfs/" + cid + "/1.json"},
+		{name: "ipfs with query", uri: "ipfs://" + cid + "/1.json?filename=1.json", ipfs: "/ipfs/" + cid + "/1.json"},
+		{name: "ipfs path", uri: "/ipfs/" + cid, ipfs: "/ipfs/" + cid},
+		{name: "bare cid", uri: cid + "/1", ipfs: "/ipfs/" + cid + "/1"},
+		{name: "bare cid v1", uri: cidV1, ipfs: "/ipfs/" + cidV1},
+		{name: "ipns", uri: "ipns://k51qzi5uqu5dlvj2baxnqndepeb86cbk3ng7n3i46uzyxzyqj2xjonzllnv0v8/1.json", ipfs: "/ipns/k51qzi5uqu5dlvj2baxnqndepeb86cbk3ng7n3i46uzyxzyqj2xjonzllnv0v8/1.json"},
+		{name: "arweave", uri: "ar://bNbA3TEQVL60xlgCcqdz4ZPHFZ711cZ3hmkpGttDt_U/1", url: "https://arweave.net/bNbA3TEQVL60xlgCcqdz4ZPHFZ711cZ3hmkpGttDt_U/1"},
+		{name: "base64 json", uri: "data:application/json;base64,eyJuYW1lIjoiVG9rZW4gMSJ9", document: `{"name":"Token 1"}`},
+		{name: "base64 json without padding", uri: "data:application/json;base64,eyJuYW1lIjoiVG9rZW4ifQ", document: `{"name":"Token"}`},
+		{name: "utf8 json", uri: `data:application/json;utf8,{"name":"Token 1"}`, document: `{"name":"Token 1"}`},
+		{name: "percent-encoded json", uri: "data:application/json,%7B%22name%22%3A%22Token%201%22%7D", document: `{"name":"Token 1"}`},
+		{name: "json", uri: `{"name":"Token 1"}`, document: `{"name":"Token 1"}`},
+		{
+			name:        "erc-1155 id",
+			uri:         "https://example.com/{id}.json",
+			tokenTypeId: common.ERC1155Type,
+			url:         "https://example.com/00000000000000000000000000000000000000000000000000000000000004d2.json",
+		},
+		{name: "erc-721 braces", uri: "https://example.com/{id}.json", tokenTypeId: common.ERC721Type, url: "https://example.com/{id}.json"},
+		{name: "svg data", uri: "data:image/svg+xml;base64,PHN2Zy8+", err: errUnsupportedUri},
+		{name: "data without comma", uri: "data:application/json;base64", err: errInvalidUri},
+		{name: "unknown scheme", uri: "ftp://example.com/1.json", err: errUnsupportedUri},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokenTypeId := test.tokenTypeId
+			if tokenTypeId == 0 {
+				tokenTypeId = common.ERC721Type
+			}
+			source, err := resolveTokenUri(test.uri, "1234", tokenTypeId)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("error %v, expected %v", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if source.url != test.url || source.ipfs != test.ipfs || string(source.document) != test.document {
+				t.Fatalf("resolved to url %q, ipfs %q and document %q, expected %q, %q and %q", source.url, source.ipfs, source.document, test.url, test.ipfs, test.document)
+			}
+		})
+	}
+}
+
+func TestResolveMediaUri(t *testing.T) {
+	tests := []struct {
+		uri      string
+		url      string
+		ipfs     string
+		document string
+	}{
+		{uri: "ipfs://QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG/1.png", ipfs: "/ipfs/QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG/1.png"},
+		{uri: "https://example.com/1.png", url: "https://example.com/1.png"},
+		{uri: "data:image/svg+xml;base64,PHN2Zy8+", document: "<svg/>"},
+		{uri: ` <svg xmlns="http://www.w3.org/2000/svg"></svg>`, document: `<svg xmlns="http://www.w3.org/2000/svg"></svg>`},
+	}
+	for _, test := range tests {
+		source, err := resolveMediaUri(test.uri)
+		if err != nil || source.url != test.url || source.ipfs != test.ipfs || string(source.document) != test.document {
+			t.Fatalf("%q resolved to url %q, ipfs %q and document %q (err: %v)", test.uri, source.url, source.ipfs, source.document, err)
+		}
+	}
+}
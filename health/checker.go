@@ -0,0 +1,158 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"ethernal/explorer/common"
+	"ethernal/explorer/config"
+	"ethernal/explorer/metrics"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/uptrace/bun"
+)
+
+const (
+	statusOk      = "ok"
+	statusFail    = "fail"
+	statusSkipped = "skipped"
+)
+
+type Check struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type Report struct {
+	Status                 string           `json:"status"`
+	Checks                 map[string]Check `json:"checks"`
+	ChainHead              uint64           `json:"chain_head"`
+	IndexedHead            uint64           `json:"indexed_head"`
+	HeadLag                uint64           `json:"head_lag"`
+	LastCommittedBlock     uint64           `json:"last_committed_block"`
+	SecondsSinceLastCommit *float64         `json:"seconds_since_last_commit"`
+}
+
+type Checker struct {
+	db     *bun.DB
+	client *rpc.Client
+	config *config.Config
+	// the call timeout can be reloaded while the synchronization is running, the checker keeps the initial one
+	timeout time.Duration
+}
+
+func NewChecker(bunDb *bun.DB, client *rpc.Client, config *config.Config) *Checker {
+	return &Checker{
+		db:      bunDb,
+		client:  client,
+		config:  config,
+		timeout: time.Duration(config.CallTimeoutInSeconds) * time.Second,
+	}
+}
+
+// Liveness fails only when restarting could help: the subscription to new blocks has been down,
+// or the database has been lagging without a single commit, for longer than the stall timeout.
+func (c *Checker) Liveness(w http.ResponseWriter, r *http.Request) {
+	report := c.newReport()
+	stallTimeout := time.Duration(c.config.HealthStallTimeout) * time.Second
+
+	state.lock.RLock()
+	lastProgress := state.lastProgress()
+	subscribed := state.subscribed
+	subscriptionSince := state.subscriptionSince
+	state.lock.RUnlock()
+
+	report.Checks["progress"] = Check{Status: statusOk}
+	if report.HeadLag > uint64(c.config.HealthLagThreshold) && time.Since(lastProgress) > stallTimeout {
+		report.Checks["progress"] = Check{Status: statusFail, Detail: "no blocks committed since " + lastProgress.UTC().Format(time.RFC3339)}
+	}
+
+	report.Checks["subscription"] = Check{Status: statusSkipped}
+	if c.config.Mode == common.Automatic {
+		report.Checks["subscription"] = Check{Status: statusOk}
+		if !subscribed && time.Since(subscriptionSince) > stallTimeout {
+			report.Checks["subscription"] = Check{Status: statusFail, Detail: "not subscribed since " + subscriptionSince.UTC().Format(time.RFC3339)}
+		}
+	}
+
+	c.write(w, report)
+}
+
+// Readiness fails when the database or the blockchain node is unreachable, the subscription to new blocks
+// is down or the database lags behind the blockchain by more than the configured threshold.
+func (c *Checker) Readiness(w http.ResponseWriter, r *http.Request) {
+	report := c.newReport()
+	timeout := c.timeout
+
+	report.Checks["database"] = Check{Status: statusOk}
+	dbCtx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	if err := c.db.PingContext(dbCtx); err != nil {
+		report.Checks["database"] = Check{Status: statusFail, Detail: err.Error()}
+	}
+
+	report.Checks["rpc"] = Check{Status: statusOk}
+	rpcCtx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	var blockNumber string
+	if err := c.client.CallContext(rpcCtx, &blockNumber, "eth_blockNumber"); err != nil {
+		report.Checks["rpc"] = Check{Status: statusFail, Detail: err.Error()}
+	}
+
+	report.Checks["subscription"] = Check{Status: statusSkipped}
+	if c.config.Mode == common.Automatic {
+		state.lock.RLock()
+		subscribed := state.subscribed
+		state.lock.RUnlock()
+
+		report.Checks["subscription"] = Check{Status: statusOk}
+		if !subscribed {
+			report.Checks["subscription"] = Check{Status: statusFail, Detail: "not subscribed to newHeads"}
+		}
+	}
+
+	report.Checks["lag"] = Check{Status: statusOk}
+	if report.HeadLag > uint64(c.config.HealthLagThreshold) {
+		report.Checks["lag"] = Check{Status: statusFail, Detail: "database is lagging behind the blockchain"}
+	}
+
+	c.write(w, report)
+}
+
+func (c *Checker) newReport() *Report {
+	chainHead, indexedHead := metrics.Heads()
+	report := &Report{
+		Checks:      map[string]Check{},
+		ChainHead:   chainHead,
+		IndexedHead: indexedHead,
+	}
+	if chainHead > indexedHead {
+		report.HeadLag = chainHead - indexedHead
+	}
+
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+	report.LastCommittedBlock = state.lastCommittedBlock
+	if !state.lastCommitAt.IsZero() {
+		seconds := time.Since(state.lastCommitAt).Seconds()
+		report.SecondsSinceLastCommit = &seconds
+	}
+	return report
+}
+
+// write responds with 503 if any of the checks failed
+func (c *Checker) write(w http.ResponseWriter, report *Report) {
+	report.Status = statusOk
+	for _, check := range report.Checks {
+		if check.Status == statusFail {
+			report.Status = statusFail
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status == statusFail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(report)
+}
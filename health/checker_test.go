@@ -0,0 +1,176 @@
+package health
+
+import (
+	"database/sql"
+	"encoding/json"
+	"ethernal/explorer/common"
+	"ethernal/explorer/config"
+	"ethernal/explorer/metrics"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// newTestChecker returns a checker of a node answering eth_blockNumber and of an unreachable database
+func newTestChecker(t *testing.T, mode string) *Checker {
+	t.Helper()
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x64"}`))
+	}))
+	t.Cleanup(node.Close)
+	client, err := rpc.DialHTTP(node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+
+	sqldb := sql.OpenDB(pgdriver.NewConnector(pgdriver.WithAddr("127.0.0.1:1"), pgdriver.WithDialTimeout(time.Second)))
+	bunDb := bun.NewDB(sqldb, pgdialect.New())
+	t.Cleanup(func() { bunDb.Close() })
+
+	return NewChecker(bunDb, client, &config.Config{
+		Mode:                 mode,
+		CallTimeoutInSeconds: 5,
+		HealthLagThreshold:   10,
+		HealthStallTimeout:   60,
+	})
+}
+
+// resetState restores the state of a process which has just started, with the heads at chainHead and indexedHead
+func resetState(t *testing.T, chainHead uint64, indexedHead uint64) {
+	t.Helper()
+	state.lock.Lock()
+	state.startedAt = time.Now()
+	state.lastCommitAt = time.Time{}
+	state.lastCommittedBlock = 0
+	state.subscribed = false
+	state.subscriptionSince = time.Now()
+	state.lock.Unlock()
+	metrics.SetChainHead(chainHead)
+	metrics.SetIndexedHead(indexedHead)
+}
+
+// setStalled moves the start of the process, the last commit and the last subscription change before the stall timeout
+func setStalled() {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	past := time.Now().Add(-2 * time.Minute)
+	state.startedAt = past
+	if !state.lastCommitAt.IsZero() {
+		state.lastCommitAt = past
+	}
+	state.subscriptionSince = past
+}
+
+func check(t *testing.T, handler http.HandlerFunc) (int, *Report) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	report := &Report{}
+	if err := json.NewDecoder(recorder.Body).Decode(report); err != nil {
+		t.Fatal(err)
+	}
+	return recorder.Code, report
+}
+
+func expectChecks(t *testing.T, step string, report *Report, expected map[string]string) {
+	t.Helper()
+	for name, status := range expected {
+		if report.Checks[name].Status != status {
+			t.Errorf("%s: %s check is %s (%s), expected %s", step, name, report.Checks[name].Status, report.Checks[name].Detail, status)
+		}
+	}
+}
+
+func TestLivenessProgress(t *testing.T) {
+	checker := newTestChecker(t, common.Manual)
+
+	resetState(t, 100, 95)
+	setStalled()
+	code, report := check(t, checker.Liveness)
+	if code != http.StatusOK {
+		t.Fatalf("stalled within the lag threshold, status %d", code)
+	}
+	expectChecks(t, "within the lag threshold", report, map[string]string{"progress": statusOk, "subscription": statusSkipped})
+
+	resetState(t, 100, 50)
+	_, report = check(t, checker.Liveness)
+	expectChecks(t, "lagging since the start", report, map[string]string{"progress": statusOk})
+
+	setStalled()
+	code, report = check(t, checker.Liveness)
+	if code != http.StatusServiceUnavailable || report.Status != statusFail {
+		t.Fatalf("lagging for longer than the stall timeout, status %d %s", code, report.Status)
+	}
+	expectChecks(t, "stalled", report, map[string]string{"progress": statusFail})
+
+	BlocksCommitted(60)
+	code, report = check(t, checker.Liveness)
+	if code != http.StatusOK || report.LastCommittedBlock != 60 || report.SecondsSinceLastCommit == nil {
+		t.Fatalf("committed after the stall, status %d, last committed block %d", code, report.LastCommittedBlock)
+	}
+
+	setStalled()
+	_, report = check(t, checker.Liveness)
+	expectChecks(t, "stalled after a commit", report, map[string]string{"progress": statusFail})
+}
+
+func TestLivenessSubscription(t *testing.T) {
+	checker := newTestChecker(t, common.Automatic)
+	resetState(t, 100, 100)
+
+	_, report := check(t, checker.Liveness)
+	expectChecks(t, "not subscribed yet", report, map[string]string{"subscription": statusOk})
+
+	setStalled()
+	_, report = check(t, checker.Liveness)
+	expectChecks(t, "never subscribed", report, map[string]string{"subscription": statusFail})
+
+	SetSubscribed(true)
+	setStalled()
+	_, report = check(t, checker.Liveness)
+	expectChecks(t, "subscribed", report, map[string]string{"subscription": statusOk})
+
+	SetSubscribed(false)
+	_, report = check(t, checker.Liveness)
+	expectChecks(t, "unsubscribed", report, map[string]string{"subscription": statusOk})
+
+	setStalled()
+	_, report = check(t, checker.Liveness)
+	expectChecks(t, "unsubscribed for longer than the stall timeout", report, map[string]string{"subscription": statusFail})
+}
+
+func TestReadiness(t *testing.T) {
+	checker := newTestChecker(t, common.Automatic)
+	resetState(t, 100, 90)
+
+	code, report := check(t, checker.Readiness)
+	if code != http.StatusServiceUnavailable || report.HeadLag != 10 {
+		t.Fatalf("unreachable database, status %d, head lag %d", code, report.HeadLag)
+	}
+	expectChecks(t, "lag at the threshold", report, map[string]string{
+		"database":     statusFail,
+		"rpc":          statusOk,
+		"subscription": statusFail,
+		"lag":          statusOk,
+	})
+
+	SetSubscribed(true)
+	metrics.SetChainHead(101)
+	_, report = check(t, checker.Readiness)
+	expectChecks(t, "lag above the threshold", report, map[string]string{"subscription": statusOk, "lag": statusFail})
+
+	metrics.ObserveIndexedHead(101)
+	_, report = check(t, checker.Readiness)
+	expectChecks(t, "caught up", report, map[string]string{"lag": statusOk})
+	if report.HeadLag != 0 {
+		t.Fatalf("caught up with a head lag of %d", report.HeadLag)
+	}
+}
@@ -0,0 +1,48 @@
+package health
+
+import (
+	"sync"
+	"time"
+)
+
+type syncState struct {
+	lock               sync.RWMutex
+	startedAt          time.Time
+	lastCommitAt       time.Time
+	lastCommittedBlock uint64
+	subscribed         bool
+	subscriptionSince  time.Time
+}
+
+var state = &syncState{
+	startedAt:         time.Now(),
+	subscriptionSince: time.Now(),
+}
+
+// BlocksCommitted records that the result of a sync job has been committed to the database.
+func BlocksCommitted(highestBlock uint64) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	state.lastCommitAt = time.Now()
+	if highestBlock > state.lastCommittedBlock {
+		state.lastCommittedBlock = highestBlock
+	}
+}
+
+// SetSubscribed records whether the subscription to new blocks is established.
+func SetSubscribed(subscribed bool) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	if state.subscribed != subscribed {
+		state.subscribed = subscribed
+		state.subscriptionSince = time.Now()
+	}
+}
+
+// lastProgress returns the time of the last commit, or the start of the process if nothing has been committed yet
+func (s *syncState) lastProgress() time.Time {
+	if s.lastCommitAt.IsZero() {
+		return s.startedAt
+	}
+	return s.lastCommitAt
+}
@@ -0,0 +1,124 @@
+package ipfs
+
+import (
+	"context"
+	"errors"
+	"ethernal/explorer/media"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	errNotFound    = errors.New("content not found")
+	errRateLimited = errors.New("rate limited by the gateway")
+)
+
+// backend reads the content of IPFS, through a gateway or the HTTP API of a node
+type backend interface {
+	// get returns the file at the content path, /ipfs/<cid>/<path> or /ipns/<name>/<path>
+	get(ctx context.Context, contentPath string, maxSize int64) ([]byte, error)
+	// block returns the raw block of the CID
+	block(ctx context.Context, cid Cid, maxSize int64) ([]byte, error)
+}
+
+// gateway is an HTTP gateway, such as https://ipfs.io. The blocks are read with the trustless gateway API.
+type gateway struct {
+	root   string
+	client *http.Client
+}
+
+func newGateway(address string, client *http.Client) *gateway {
+	return &gateway{root: gatewayRoot(address), client: client}
+}
+
+// gatewayRoot returns the address of the gateway, which can be configured with or without the /ipfs/ suffix
+func gatewayRoot(address string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(address, "/"), "/ipfs")
+}
+
+func (g *gateway) get(ctx context.Context, contentPath string, maxSize int64) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, g.root+contentPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	return readResponse(g.client, request, maxSize)
+}
+
+func (g *gateway) block(ctx context.Context, cid Cid, maxSize int64) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, g.root+"/ipfs/"+cid.String()+"?format=raw", nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/vnd.ipld.raw")
+	return readResponse(g.client, request, maxSize)
+}
+
+// node is the HTTP API (RPC) of an IPFS node, such as http://127.0.0.1:5001
+type node struct {
+	root   string
+	client *http.Client
+}
+
+func newNode(address string, client *http.Client) *node {
+	return &node{root: strings.TrimSuffix(address, "/"), client: client}
+}
+
+func (n *node) get(ctx context.Context, contentPath string, maxSize int64) ([]byte, error) {
+	return n.call(ctx, "cat", contentPath, maxSize)
+}
+
+func (n *node) block(ctx context.Context, cid Cid, maxSize int64) ([]byte, error) {
+	return n.call(ctx, "block/get", cid.String(), maxSize)
+}
+
+// call sends a command to the API, which accepts only POST requests
+func (n *node) call(ctx context.Context, command string, arg string, maxSize int64) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, n.root+"/api/v0/"+command+"?arg="+url.QueryEscape(arg), nil)
+	if err != nil {
+		return nil, err
+	}
+	data, err := readResponse(n.client, request, maxSize)
+	// the API answers 500 with a JSON message when the content cannot be resolved
+	if err != nil && strings.Contains(err.Error(), "no link named") {
+		return nil, errNotFound
+	}
+	return data, err
+}
+
+// readResponse returns the body of the response to the request, or media.ErrTooLarge if it is larger than maxSize bytes
+// and maxSize is not 0
+func readResponse(client *http.Client, request *http.Request, maxSize int64) ([]byte, error) {
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusNotFound:
+		return nil, errNotFound
+	case response.StatusCode == http.StatusTooManyRequests:
+		return nil, errRateLimited
+	case response.StatusCode != http.StatusOK:
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return nil, fmt.Errorf("unexpected status %s: %s", response.Status, strings.TrimSpace(string(message)))
+	}
+
+	if maxSize == 0 {
+		return io.ReadAll(response.Body)
+	}
+	if response.ContentLength > maxSize {
+		return nil, media.ErrTooLarge
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxSize {
+		return nil, media.ErrTooLarge
+	}
+	return body, nil
+}
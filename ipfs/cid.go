@@ -0,0 +1,132 @@
+package ipfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// multicodecs of the blocks and of the hash functions
+const (
+	codecRaw   = 0x55
+	codecDagPb = 0x70
+	hashSha256 = 0x12
+)
+
+var (
+	errInvalidCid      = errors.New("invalid cid")
+	errUnsupportedHash = errors.New("unsupported cid hash function")
+)
+
+var base32Encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// Cid is a content identifier: the codec of the block and the multihash of its content
+type Cid struct {
+	Codec    uint64
+	HashCode uint64
+	Digest   []byte
+}
+
+// ParseCid parses a CID of version 0 (Qm..., base58) or of version 1 in base32 (b...), base58 (z...) or base16 (f...)
+func ParseCid(text string) (Cid, error) {
+	if len(text) == 46 && strings.HasPrefix(text, "Qm") {
+		multihash, err := decodeBase58(text)
+		if err != nil {
+			return Cid{}, err
+		}
+		return parseMultihash(codecDagPb, multihash)
+	}
+	if len(text) < 2 {
+		return Cid{}, errInvalidCid
+	}
+
+	var data []byte
+	var err error
+	switch text[0] {
+	case 'b':
+		data, err = base32Encoding.DecodeString(strings.ToUpper(text[1:]))
+	case 'z':
+		data, err = decodeBase58(text[1:])
+	case 'f':
+		data, err = hex.DecodeString(text[1:])
+	default:
+		return Cid{}, fmt.Errorf("%w: unsupported multibase %q", errInvalidCid, text[0])
+	}
+	if err != nil {
+		return Cid{}, fmt.Errorf("%w: %v", errInvalidCid, err)
+	}
+	return decodeCid(data)
+}
+
+// decodeCid decodes a binary CID, as found in the links of dag-pb blocks
+func decodeCid(data []byte) (Cid, error) {
+	// the binary CIDs of version 0 are bare sha2-256 multihashes
+	if len(data) == 34 && data[0] == hashSha256 && data[1] == 32 {
+		return parseMultihash(codecDagPb, data)
+	}
+	version, n := binary.Uvarint(data)
+	if n <= 0 || version != 1 {
+		return Cid{}, fmt.Errorf("%w: unsupported version", errInvalidCid)
+	}
+	codec, m := binary.Uvarint(data[n:])
+	if m <= 0 {
+		return Cid{}, errInvalidCid
+	}
+	return parseMultihash(codec, data[n+m:])
+}
+
+func parseMultihash(codec uint64, multihash []byte) (Cid, error) {
+	hashCode, n := binary.Uvarint(multihash)
+	if n <= 0 {
+		return Cid{}, errInvalidCid
+	}
+	length, m := binary.Uvarint(multihash[n:])
+	if m <= 0 || uint64(len(multihash)-n-m) != length {
+		return Cid{}, fmt.Errorf("%w: invalid multihash", errInvalidCid)
+	}
+	return Cid{Codec: codec, HashCode: hashCode, Digest: multihash[n+m:]}, nil
+}
+
+// String returns the CID of version 1 in base32, which identifies the same content as the CID of version 0
+func (c Cid) String() string {
+	data := []byte{}
+	for _, value := range []uint64{1, c.Codec, c.HashCode, uint64(len(c.Digest))} {
+		varint := make([]byte, binary.MaxVarintLen64)
+		data = append(data, varint[:binary.PutUvarint(varint, value)]...)
+	}
+	data = append(data, c.Digest...)
+	return "b" + strings.ToLower(base32Encoding.EncodeToString(data))
+}
+
+// Verify reports whether the block has the content identified by the CID
+func (c Cid) Verify(block []byte) (bool, error) {
+	if c.HashCode != hashSha256 {
+		return false, fmt.Errorf("%w: 0x%x", errUnsupportedHash, c.HashCode)
+	}
+	sum := sha256.Sum256(block)
+	return bytes.Equal(sum[:], c.Digest), nil
+}
+
+func decodeBase58(text string) ([]byte, error) {
+	number := new(big.Int)
+	radix := big.NewInt(58)
+	for _, char := range text {
+		digit := strings.IndexRune(base58Alphabet, char)
+		if digit < 0 {
+			return nil, fmt.Errorf("%w: invalid base58 character %q", errInvalidCid, char)
+		}
+		number.Mul(number, radix)
+		number.Add(number, big.NewInt(int64(digit)))
+	}
+	// the leading zeros are encoded as leading ones
+	zeros := len(text) - len(strings.TrimLeft(text, "1"))
+	return append(make([]byte, zeros), number.Bytes()...), nil
+}
@@ -0,0 +1,50 @@
+package ipfs
+
+import (
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+func TestParseCid(t *testing.T) {
+	v0, err := ParseCid("QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v0.Codec != codecDagPb || v0.HashCode != hashSha256 || len(v0.Digest) != 32 {
+		t.Fatalf("unexpected cid %+v", v0)
+	}
+	if v1 := v0.String(); v1 != "bafybeihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku" {
+		t.Fatalf("cid v0 converted to %s", v1)
+	}
+	v1, err := ParseCid("bafybeihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku")
+	if err != nil || v1.String() != v0.String() {
+		t.Fatalf("cid v1 parsed as %s (err: %v)", v1, err)
+	}
+
+	for _, text := range []string{"", "Qm", "mAXASIA", "bafy!", "QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR10"} {
+		if _, err := ParseCid(text); !errors.Is(err, errInvalidCid) {
+			t.Fatalf("%q parsed with %v, expected errInvalidCid", text, err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	block := []byte("hello")
+	sum := sha256.Sum256(block)
+	cid := Cid{Codec: codecRaw, HashCode: hashSha256, Digest: sum[:]}
+
+	parsed, err := ParseCid(cid.String())
+	if err != nil || parsed.Codec != codecRaw {
+		t.Fatalf("cid %s parsed as %+v (err: %v)", cid, parsed, err)
+	}
+	if valid, err := parsed.Verify(block); !valid || err != nil {
+		t.Fatalf("block not verified (err: %v)", err)
+	}
+	if valid, _ := parsed.Verify([]byte("hello!")); valid {
+		t.Fatal("altered block verified")
+	}
+	if _, err := (Cid{HashCode: 0x1e}).Verify(block); !errors.Is(err, errUnsupportedHash) {
+		t.Fatalf("blake3 cid verified with %v, expected errUnsupportedHash", err)
+	}
+}
@@ -0,0 +1,432 @@
+package ipfs
+
+import (
+	"context"
+	"errors"
+	"ethernal/explorer/loger"
+	"ethernal/explorer/media"
+	"ethernal/explorer/metrics"
+	"ethernal/explorer/tracing"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var logger = loger.Get(loger.Eth)
+
+// Strategies of sending the requests to the backends
+const (
+	// RoundRobin sends every request to the next healthy backend, and to the following ones if it fails
+	RoundRobin = "round-robin"
+	// Race sends every request to all healthy backends at once and takes the first answer
+	Race = "race"
+)
+
+const (
+	// unhealthyAfter is the number of consecutive failures after which a backend is skipped
+	unhealthyAfter = 3
+	// healthBackoff is how long an unhealthy backend is skipped, it doubles with every next failure up to maxHealthBackoff
+	healthBackoff    = 10 * time.Second
+	maxHealthBackoff = 5 * time.Minute
+	// maxBlocks bounds the number of blocks read to verify one file
+	maxBlocks = 4096
+)
+
+var (
+	errVerification = errors.New("content does not match its cid")
+	errUnverifiable = errors.New("content cannot be verified")
+	errNoBackend    = errors.New("no IPFS gateway or node is configured")
+)
+
+// Options configures the backends of the client
+type Options struct {
+	Gateways []string
+	// NodeApi is the address of the HTTP API of an IPFS node, used as a backend along with the gateways
+	NodeApi  string
+	Strategy string
+	// RateLimit is the number of requests per second sent to every gateway, unlimited if 0
+	RateLimit uint
+	// Verify checks every block read from the /ipfs/ namespace against its CID
+	Verify  bool
+	Timeout time.Duration
+}
+
+// Client reads files from IPFS through several gateways and IPFS nodes, skipping the backends which keep failing
+type Client struct {
+	backends []*backendState
+	strategy string
+	verify   bool
+	timeout  time.Duration
+
+	lock sync.Mutex
+	next int
+}
+
+// NewClient creates a client sending the requests of all backends with the transport
+func NewClient(options Options, transport http.RoundTripper) *Client {
+	client := &http.Client{Transport: transport}
+	c := &Client{strategy: options.Strategy, verify: options.Verify, timeout: options.Timeout}
+	if options.NodeApi != "" {
+		c.backends = append(c.backends, newBackendState(hostOf(options.NodeApi), newNode(options.NodeApi, client), 0))
+	}
+	for _, address := range options.Gateways {
+		c.backends = append(c.backends, newBackendState(hostOf(address), newGateway(address, client), options.RateLimit))
+	}
+	return c
+}
+
+// Get returns the file at the content path, /ipfs/<cid>/<path> or /ipns/<name>/<path>. A file larger than maxSize bytes,
+// if maxSize is not 0, is not read and media.ErrTooLarge is returned.
+func (c *Client) Get(ctx context.Context, contentPath string, maxSize int64) (_ []byte, err error) {
+	ctx, span := tracing.Start(ctx, "ipfs.get", attribute.String("ipfs.path", contentPath))
+	defer func() { tracing.End(span, err) }()
+
+	if c.verify && strings.HasPrefix(contentPath, "/ipfs/") {
+		data, err := c.getVerified(ctx, strings.Split(strings.Trim(contentPath[len("/ipfs/"):], "/"), "/"), maxSize)
+		if !errors.Is(err, errUnverifiable) {
+			return data, err
+		}
+		logger.WithField("path", contentPath).WithError(err).Debug("Reading IPFS content without verification")
+	}
+	return c.do(ctx, func(ctx context.Context, b backend) ([]byte, error) {
+		return b.get(ctx, contentPath, maxSize)
+	})
+}
+
+// getVerified reads the file at the path from its blocks, checking every block against its CID.
+// The path is resolved through the links of the UnixFS directories.
+func (c *Client) getVerified(ctx context.Context, path []string, maxSize int64) ([]byte, error) {
+	root, err := ParseCid(path[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errUnverifiable, err)
+	}
+	blocks := 0
+	current := root
+	for _, name := range path[1:] {
+		if name == "" {
+			continue
+		}
+		node, err := c.dagPbNode(ctx, current, &blocks)
+		if err != nil {
+			return nil, err
+		}
+		if node.unixfsType == unixfsHAMTShard {
+			return nil, fmt.Errorf("%w: sharded directory", errUnverifiable)
+		}
+		if node.unixfsType != unixfsDirectory {
+			return nil, fmt.Errorf("%w: %s is not a directory", errNotFound, current)
+		}
+		found := false
+		for _, link := range node.links {
+			if link.name == name {
+				current, found = link.cid, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: no link named %q", errNotFound, name)
+		}
+	}
+
+	data := []byte{}
+	if err := c.readFile(ctx, current, &data, maxSize, &blocks); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readFile appends the content of the file, raw or UnixFS, to data
+func (c *Client) readFile(ctx context.Context, cid Cid, data *[]byte, maxSize int64, blocks *int) error {
+	if cid.Codec == codecRaw {
+		block, err := c.block(ctx, cid, blocks)
+		if err != nil {
+			return err
+		}
+		*data = append(*data, block...)
+	} else {
+		node, err := c.dagPbNode(ctx, cid, blocks)
+		if err != nil {
+			return err
+		}
+		if node.unixfsType != unixfsFile && node.unixfsType != unixfsRaw {
+			return fmt.Errorf("%w: %s is not a file", errUnverifiable, cid)
+		}
+		*data = append(*data, node.data...)
+		for _, link := range node.links {
+			if maxSize != 0 && int64(len(*data)) > maxSize {
+				break
+			}
+			if err := c.readFile(ctx, link.cid, data, maxSize, blocks); err != nil {
+				return err
+			}
+		}
+	}
+
+	if maxSize != 0 && int64(len(*data)) > maxSize {
+		return media.ErrTooLarge
+	}
+	return nil
+}
+
+func (c *Client) dagPbNode(ctx context.Context, cid Cid, blocks *int) (*pbNode, error) {
+	if cid.Codec != codecDagPb {
+		return nil, fmt.Errorf("%w: codec 0x%x", errUnverifiable, cid.Codec)
+	}
+	block, err := c.block(ctx, cid, blocks)
+	if err != nil {
+		return nil, err
+	}
+	return decodePbNode(block)
+}
+
+// block reads the block of the CID, from the next backend if the block read from one backend does not match the CID
+func (c *Client) block(ctx context.Context, cid Cid, blocks *int) ([]byte, error) {
+	if *blocks++; *blocks > maxBlocks {
+		return nil, fmt.Errorf("%w: more than %d blocks", errUnverifiable, maxBlocks)
+	}
+	if cid.HashCode != hashSha256 {
+		return nil, fmt.Errorf("%w: hash function 0x%x", errUnverifiable, cid.HashCode)
+	}
+	return c.do(ctx, func(ctx context.Context, b backend) ([]byte, error) {
+		// blocks are at most 2 MiB
+		block, err := b.block(ctx, cid, 2<<20)
+		if err != nil {
+			return nil, err
+		}
+		if valid, _ := cid.Verify(block); !valid {
+			return nil, fmt.Errorf("%w: %s", errVerification, cid)
+		}
+		return block, nil
+	})
+}
+
+// do sends the request with the strategy of the client
+func (c *Client) do(ctx context.Context, request func(ctx context.Context, b backend) ([]byte, error)) ([]byte, error) {
+	candidates := c.candidates()
+	if len(candidates) == 0 {
+		return nil, errNoBackend
+	}
+	if c.strategy == Race && len(candidates) > 1 {
+		return c.race(ctx, candidates, request)
+	}
+
+	var lastErr error
+	for _, candidate := range candidates {
+		data, err := candidate.send(ctx, c.timeout, request)
+		if err == nil {
+			return data, nil
+		}
+		if ctx.Err() != nil || errors.Is(err, media.ErrTooLarge) {
+			return nil, err
+		}
+		logger.WithField("backend", candidate.name).WithError(err).Debug("IPFS request failed")
+		lastErr = keepNotFound(lastErr, err)
+	}
+	return nil, fmt.Errorf("all IPFS backends failed, last error: %w", lastErr)
+}
+
+// race sends the request to all candidates at once, the slower requests are cancelled once one succeeds
+func (c *Client) race(ctx context.Context, candidates []*backendState, request func(ctx context.Context, b backend) ([]byte, error)) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type answer struct {
+		name string
+		data []byte
+		err  error
+	}
+	answers := make(chan answer, len(candidates))
+	for _, candidate := range candidates {
+		go func(candidate *backendState) {
+			data, err := candidate.send(ctx, c.timeout, request)
+			answers <- answer{name: candidate.name, data: data, err: err}
+		}(candidate)
+	}
+
+	var lastErr error
+	for range candidates {
+		answer := <-answers
+		if answer.err == nil {
+			return answer.data, nil
+		}
+		logger.WithField("backend", answer.name).WithError(answer.err).Debug("IPFS request failed")
+		lastErr = keepNotFound(lastErr, answer.err)
+	}
+	return nil, fmt.Errorf("all IPFS backends failed, last error: %w", lastErr)
+}
+
+// keepNotFound returns the error of the last failed request, unless a previous backend did not find the content:
+// the errors of the unhealthy backends tried after it would hide that the content is missing
+func keepNotFound(lastErr error, err error) error {
+	if errors.Is(lastErr, errNotFound) {
+		return lastErr
+	}
+	return err
+}
+
+// candidates returns the backends in the order they are tried: the healthy ones from the next one in the rotation,
+// then the unhealthy ones as a last resort
+func (c *Client) candidates() []*backendState {
+	c.lock.Lock()
+	start := c.next
+	c.next++
+	c.lock.Unlock()
+
+	now := time.Now()
+	healthy, unhealthy := []*backendState{}, []*backendState{}
+	for i := range c.backends {
+		backend := c.backends[(start+i)%len(c.backends)]
+		if backend.healthy(now) {
+			healthy = append(healthy, backend)
+		} else {
+			unhealthy = append(unhealthy, backend)
+		}
+	}
+	if len(healthy) != 0 && c.strategy == Race {
+		return healthy
+	}
+	return append(healthy, unhealthy...)
+}
+
+// backendState is the health and the rate limit of a backend
+type backendState struct {
+	name    string
+	backend backend
+	limiter *rateLimiter
+
+	lock      sync.Mutex
+	failures  int
+	downUntil time.Time
+}
+
+func newBackendState(name string, backend backend, rateLimit uint) *backendState {
+	state := &backendState{name: name, backend: backend}
+	if rateLimit != 0 {
+		state.limiter = newRateLimiter(float64(rateLimit))
+	}
+	metrics.IpfsBackendHealthy.WithLabelValues(name).Set(1)
+	return state
+}
+
+// send waits for the rate limit and sends the request, recording its outcome in the health of the backend
+func (s *backendState) send(ctx context.Context, timeout time.Duration, request func(ctx context.Context, b backend) ([]byte, error)) ([]byte, error) {
+	if s.limiter != nil {
+		if err := s.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	requestCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	data, err := request(requestCtx, s.backend)
+
+	switch {
+	case err == nil:
+		metrics.IpfsRequests.WithLabelValues(s.name, metrics.IpfsSuccess).Inc()
+		s.succeeded()
+	case ctx.Err() != nil:
+		// cancelled by the caller, or by a faster backend of a race
+	case errors.Is(err, errNotFound), errors.Is(err, media.ErrTooLarge):
+		// the content is missing or too large, the backend works
+		metrics.IpfsRequests.WithLabelValues(s.name, metrics.IpfsNotFound).Inc()
+	case errors.Is(err, errVerification):
+		metrics.IpfsRequests.WithLabelValues(s.name, metrics.IpfsInvalid).Inc()
+		s.failed()
+	default:
+		metrics.IpfsRequests.WithLabelValues(s.name, metrics.IpfsError).Inc()
+		s.failed()
+	}
+	return data, err
+}
+
+func (s *backendState) healthy(now time.Time) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return now.After(s.downUntil)
+}
+
+func (s *backendState) succeeded() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.failures >= unhealthyAfter {
+		logger.WithField("backend", s.name).Info("IPFS backend is healthy again")
+	}
+	s.failures = 0
+	s.downUntil = time.Time{}
+	metrics.IpfsBackendHealthy.WithLabelValues(s.name).Set(1)
+}
+
+func (s *backendState) failed() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.failures++
+	if s.failures < unhealthyAfter {
+		return
+	}
+	delay := healthBackoff
+	for i := unhealthyAfter; i < s.failures && delay < maxHealthBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxHealthBackoff {
+		delay = maxHealthBackoff
+	}
+	s.downUntil = time.Now().Add(delay)
+	metrics.IpfsBackendHealthy.WithLabelValues(s.name).Set(0)
+	logger.WithField("backend", s.name).WithField("failures", s.failures).WithField("skipped_for", delay.String()).Warn("IPFS backend is unhealthy")
+}
+
+// rateLimiter is a token bucket allowing rate requests per second, with bursts of up to rate requests
+type rateLimiter struct {
+	lock   sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	return &rateLimiter{rate: rate, tokens: rate, last: time.Now()}
+}
+
+// wait takes a token, waiting until one is available
+func (l *rateLimiter) wait(ctx context.Context) error {
+	for {
+		delay := l.take(time.Now())
+		if delay == 0 {
+			return nil
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// take takes a token if one is available, otherwise it returns how long until one is
+func (l *rateLimiter) take(now time.Time) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// hostOf returns the host of the address, which names the backend in the logs and metrics without its credentials
+func hostOf(address string) string {
+	parsed, err := url.Parse(address)
+	if err != nil || parsed.Host == "" {
+		return address
+	}
+	return parsed.Host
+}
@@ -0,0 +1,192 @@
+package ipfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const document = `{"name":"Token 1"}`
+
+// protobufField encodes a length-delimited or a varint field of a protobuf message
+func protobufField(field uint64, value []byte, number uint64) []byte {
+	varint := func(n uint64) []byte {
+		buffer := make([]byte, binary.MaxVarintLen64)
+		return buffer[:binary.PutUvarint(buffer, n)]
+	}
+	if value == nil {
+		return append(varint(field<<3), varint(number)...)
+	}
+	return append(append(varint(field<<3|2), varint(uint64(len(value)))...), value...)
+}
+
+// dagPbBlock encodes a dag-pb block of the UnixFS type with the links, and returns it with its CID
+func dagPbBlock(unixfsType uint64, links []pbLink) ([]byte, Cid) {
+	block := []byte{}
+	for _, link := range links {
+		message := protobufField(1, binaryCid(link.cid), 0)
+		if link.name != "" {
+			message = append(message, protobufField(2, []byte(link.name), 0)...)
+		}
+		block = append(block, protobufField(2, message, 0)...)
+	}
+	block = append(block, protobufField(1, protobufField(1, nil, unixfsType), 0)...)
+	sum := sha256.Sum256(block)
+	return block, Cid{Codec: codecDagPb, HashCode: hashSha256, Digest: sum[:]}
+}
+
+func binaryCid(cid Cid) []byte {
+	data, _ := base32Encoding.DecodeString(strings.ToUpper(cid.String()[1:]))
+	return data
+}
+
+// newTestGateway serves the blocks, and the file of the directory at /ipfs/<root>/1.json. alter changes the blocks it serves.
+func newTestGateway(t *testing.T, blocks map[string][]byte, root Cid, alter func([]byte) []byte) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ipfs/"+root.String()+"/1.json" {
+			w.Write([]byte(document))
+			return
+		}
+		block, ok := blocks[strings.TrimPrefix(r.URL.Path, "/ipfs/")]
+		if !ok || r.URL.Query().Get("format") != "raw" {
+			http.NotFound(w, r)
+			return
+		}
+		if alter != nil {
+			block = alter(block)
+		}
+		w.Write(block)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testDirectory returns the blocks of a directory holding 1.json, a file split in two raw blocks, and the CID of the directory
+func testDirectory() (map[string][]byte, Cid) {
+	blocks := map[string][]byte{}
+	parts := []pbLink{}
+	for _, part := range []string{document[:8], document[8:]} {
+		sum := sha256.Sum256([]byte(part))
+		cid := Cid{Codec: codecRaw, HashCode: hashSha256, Digest: sum[:]}
+		blocks[cid.String()] = []byte(part)
+		parts = append(parts, pbLink{cid: cid})
+	}
+	fileBlock, file := dagPbBlock(unixfsFile, parts)
+	blocks[file.String()] = fileBlock
+	directoryBlock, directory := dagPbBlock(unixfsDirectory, []pbLink{{cid: file, name: "1.json"}})
+	blocks[directory.String()] = directoryBlock
+	return blocks, directory
+}
+
+func TestClientFailover(t *testing.T) {
+	blocks, root := testDirectory()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	working := newTestGateway(t, blocks, root, nil)
+
+	client := NewClient(Options{Gateways: []string{failing.URL, working.URL + "/ipfs/"}, Strategy: RoundRobin, Timeout: time.Second}, http.DefaultTransport)
+	for i := 0; i < 2*unhealthyAfter; i++ {
+		data, err := client.Get(context.Background(), "/ipfs/"+root.String()+"/1.json", 0)
+		if err != nil || string(data) != document {
+			t.Fatalf("read %q (err: %v)", data, err)
+		}
+	}
+	if client.backends[0].healthy(time.Now()) || !client.backends[1].healthy(time.Now()) {
+		t.Fatal("the failing gateway is still healthy")
+	}
+
+	if _, err := client.Get(context.Background(), "/ipfs/"+root.String()+"/2.json", 0); !errors.Is(err, errNotFound) {
+		t.Fatalf("missing file read with %v, expected errNotFound", err)
+	}
+}
+
+func TestClientRace(t *testing.T) {
+	blocks, root := testDirectory()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	fast := newTestGateway(t, blocks, root, nil)
+
+	client := NewClient(Options{Gateways: []string{slow.URL, fast.URL}, Strategy: Race, Timeout: 10 * time.Second}, http.DefaultTransport)
+	start := time.Now()
+	data, err := client.Get(context.Background(), "/ipfs/"+root.String()+"/1.json", 0)
+	if err != nil || string(data) != document {
+		t.Fatalf("read %q (err: %v)", data, err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("race waited %s for the slow gateway", elapsed)
+	}
+}
+
+func TestClientVerify(t *testing.T) {
+	blocks, root := testDirectory()
+	tampering := newTestGateway(t, blocks, root, func(block []byte) []byte {
+		return []byte(strings.Replace(string(block), "Token", "Scam!", 1))
+	})
+	honest := newTestGateway(t, blocks, root, nil)
+
+	client := NewClient(Options{Gateways: []string{tampering.URL, honest.URL}, Strategy: RoundRobin, Verify: true, Timeout: time.Second}, http.DefaultTransport)
+	data, err := client.Get(context.Background(), "/ipfs/"+root.String()+"/1.json", 0)
+	if err != nil || string(data) != document {
+		t.Fatalf("read %q (err: %v)", data, err)
+	}
+
+	client = NewClient(Options{Gateways: []string{tampering.URL}, Verify: true, Timeout: time.Second}, http.DefaultTransport)
+	if data, err := client.Get(context.Background(), "/ipfs/"+root.String()+"/1.json", 0); !errors.Is(err, errVerification) {
+		t.Fatalf("tampered file read as %q with %v, expected errVerification", data, err)
+	}
+}
+
+func TestNode(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v0/cat" || r.URL.Query().Get("arg") != "/ipfs/cid/1.json" {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"Message":"no link named \"2.json\" under cid","Code":0,"Type":"error"}`))
+			return
+		}
+		w.Write([]byte(document))
+	}))
+	defer api.Close()
+
+	client := NewClient(Options{NodeApi: api.URL, Timeout: time.Second}, http.DefaultTransport)
+	if data, err := client.Get(context.Background(), "/ipfs/cid/1.json", 0); err != nil || string(data) != document {
+		t.Fatalf("read %q (err: %v)", data, err)
+	}
+	if _, err := client.Get(context.Background(), "/ipfs/cid/2.json", 0); !errors.Is(err, errNotFound) {
+		t.Fatalf("missing file read with %v, expected errNotFound", err)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(2)
+	now := limiter.last
+	if limiter.take(now) != 0 || limiter.take(now) != 0 {
+		t.Fatal("the burst is not allowed")
+	}
+	if delay := limiter.take(now); delay != 500*time.Millisecond {
+		t.Fatalf("waiting %s for the third request, expected 500ms", delay)
+	}
+	if limiter.take(now.Add(500*time.Millisecond)) != 0 {
+		t.Fatal("no token after 500ms")
+	}
+}
+
+func TestGatewayRoot(t *testing.T) {
+	for _, address := range []string{"https://ipfs.io/ipfs/", "https://ipfs.io/ipfs", "https://ipfs.io/", "https://ipfs.io"} {
+		if root := gatewayRoot(address); root != "https://ipfs.io" {
+			t.Fatalf("gateway %s has root %s", address, root)
+		}
+	}
+}
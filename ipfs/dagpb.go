@@ -0,0 +1,127 @@
+package ipfs
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// UnixFS data types
+const (
+	unixfsRaw       = 0
+	unixfsDirectory = 1
+	unixfsFile      = 2
+	unixfsHAMTShard = 5
+)
+
+var errInvalidBlock = errors.New("invalid dag-pb block")
+
+// pbNode is a decoded dag-pb block: the links to its children and its UnixFS data
+type pbNode struct {
+	links []pbLink
+	// unixfsType and data are the type and the content of the UnixFS data of the node
+	unixfsType uint64
+	data       []byte
+}
+
+type pbLink struct {
+	cid  Cid
+	name string
+}
+
+// decodePbNode decodes a dag-pb block, a PBNode protobuf message whose data is a UnixFS protobuf message
+func decodePbNode(block []byte) (*pbNode, error) {
+	node := &pbNode{}
+	var unixfs []byte
+	err := readProtobuf(block, func(field uint64, value []byte, number uint64) error {
+		switch field {
+		case 1:
+			unixfs = value
+		case 2:
+			link, err := decodePbLink(value)
+			if err != nil {
+				return err
+			}
+			node.links = append(node.links, link)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readProtobuf(unixfs, func(field uint64, value []byte, number uint64) error {
+		switch field {
+		case 1:
+			node.unixfsType = number
+		case 2:
+			node.data = value
+		}
+		return nil
+	})
+	return node, err
+}
+
+func decodePbLink(message []byte) (pbLink, error) {
+	link := pbLink{}
+	var hash []byte
+	err := readProtobuf(message, func(field uint64, value []byte, number uint64) error {
+		switch field {
+		case 1:
+			hash = value
+		case 2:
+			link.name = string(value)
+		}
+		return nil
+	})
+	if err != nil {
+		return link, err
+	}
+	link.cid, err = decodeCid(hash)
+	return link, err
+}
+
+// readProtobuf calls fn with every field of the protobuf message, with the value of the length-delimited fields
+// or the number of the varint fields
+func readProtobuf(message []byte, fn func(field uint64, value []byte, number uint64) error) error {
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return errInvalidBlock
+		}
+		message = message[n:]
+
+		var value []byte
+		var number uint64
+		switch key & 7 {
+		case 0:
+			if number, n = binary.Uvarint(message); n <= 0 {
+				return errInvalidBlock
+			}
+			message = message[n:]
+		case 1:
+			if len(message) < 8 {
+				return errInvalidBlock
+			}
+			message = message[8:]
+		case 2:
+			length, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < length {
+				return errInvalidBlock
+			}
+			value = message[n : n+int(length)]
+			message = message[n+int(length):]
+		case 5:
+			if len(message) < 4 {
+				return errInvalidBlock
+			}
+			message = message[4:]
+		default:
+			return errInvalidBlock
+		}
+
+		if err := fn(key>>3, value, number); err != nil {
+			return err
+		}
+	}
+	return nil
+}
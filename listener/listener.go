@@ -4,22 +4,27 @@ import (
 	"context"
 	"ethernal/explorer/config"
 	"ethernal/explorer/eth"
+	"ethernal/explorer/health"
+	"ethernal/explorer/loger"
+	"ethernal/explorer/metrics"
 	"ethernal/explorer/syncer"
 	"ethernal/explorer/utils"
 	"time"
 
 	"github.com/ethereum/go-ethereum/rpc"
-	"github.com/sirupsen/logrus"
 
 	bundb "github.com/uptrace/bun"
 )
 
+var logger = loger.Get(loger.Listener)
+
 type BlockHeader struct {
 	Number string
 }
 
 // ListenForNewBlocks listens for new blocks on the blockchain and then processes them.
-func ListenForNewBlocks(connection *eth.BlockchainNodeConnection, db *bundb.DB, config *config.Config) {
+// When ctx is cancelled, it stops listening and waits for the synchronization in progress to finish.
+func ListenForNewBlocks(ctx context.Context, connection *eth.BlockchainNodeConnection, db *bundb.DB, config *config.Config) {
 
 	// synch signal ensures that only one trigger can perform synchronization at a time
 	synch := syncer.GetSignalSynchInstance()
@@ -27,46 +32,69 @@ func ListenForNewBlocks(connection *eth.BlockchainNodeConnection, db *bundb.DB,
 	synch.Done <- struct{}{}
 	// channel for new blocks
 	blocks := make(chan BlockHeader)
+	// the call timeout can be reloaded by the synchronization, the subscription keeps the initial one
+	timeout := config.CallTimeoutInSeconds
 
 	// subscription to newHeads event run in a goroutine
 	go func() {
 		// loop to re-establish the subscription if it has ended
-		for i := 0; ; i++ {
+		for i := 0; ctx.Err() == nil; i++ {
 			if i > 0 {
-				time.Sleep(2 * time.Second)
+				select {
+				case <-time.After(2 * time.Second):
+				case <-ctx.Done():
+					return
+				}
 			}
-			subscribeBlocks(connection.WebSocket, blocks, config.CallTimeoutInSeconds)
+			subscribeBlocks(ctx, connection.WebSocket, blocks, timeout)
 		}
 	}()
 
 	// listen on channel for new blocks
-	for block := range blocks {
-		logrus.Info("New block: ", utils.ToUint64(block.Number))
-		// check if the trigger can start sync or it will be ignored
+	for {
 		select {
-		// if channel Done contains sync signal, start sync
-		case <-synch.Done:
-			go syncer.SyncMissingBlocks(connection.HTTP, db, config)
-		// ignore synch
-		default:
+		case block := <-blocks:
+			logger.WithField("block", utils.ToUint64(block.Number)).Info("New block")
+			metrics.SetChainHead(utils.ToUint64(block.Number))
+			// check if the trigger can start sync or it will be ignored
+			select {
+			// if channel Done contains sync signal, start sync
+			case <-synch.Done:
+				go syncer.SyncMissingBlocks(ctx, connection.HTTP, db, config)
+			// ignore synch
+			default:
+			}
+		case <-ctx.Done():
+			logger.Info("Stopped listening for new blocks, waiting for the synchronization in progress")
+			// the signal is returned to the channel when the synchronization in progress is finished
+			<-synch.Done
+			return
 		}
 	}
 }
 
 // SubscribeBlocks maintains a subscription for new blocks.
-func subscribeBlocks(client *rpc.Client, blocks chan BlockHeader, timeout uint) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+func subscribeBlocks(ctx context.Context, client *rpc.Client, blocks chan BlockHeader, timeout uint) {
+	subscribeCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
 	defer cancel()
 
 	// subscribe to newHeads event
-	subscription, err := client.EthSubscribe(ctx, blocks, "newHeads")
+	subscription, err := client.EthSubscribe(subscribeCtx, blocks, "newHeads")
 	if err != nil {
-		logrus.Error("Error subscribing to newHeads event, error: ", err)
+		logger.WithError(err).Error("Error subscribing to newHeads event")
+		health.SetSubscribed(false)
 		return
 	}
+	health.SetSubscribed(true)
 
 	// The subscription will deliver events to the channel. Wait for the
 	// subscription to end for any reason, then loop around to re-establish
 	// the connection.
-	logrus.Error("Connection with subscription to newHeads event lost, error: ", <-subscription.Err())
+	select {
+	case err := <-subscription.Err():
+		logger.WithError(err).Error("Connection with subscription to newHeads event lost")
+	case <-ctx.Done():
+		subscription.Unsubscribe()
+	}
+	health.SetSubscribed(false)
 }
@@ -0,0 +1,84 @@
+package listener
+
+import (
+	"context"
+	"ethernal/explorer/common"
+	"ethernal/explorer/config"
+	"ethernal/explorer/db/dbtest"
+	"ethernal/explorer/eth"
+	"ethernal/explorer/mocknode"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestListenForNewBlocks(t *testing.T) {
+	cfg := &config.Config{
+		Mode:                 common.Automatic,
+		WorkersCount:         2,
+		Step:                 5,
+		CallTimeoutInSeconds: 5,
+		Checkpoint:           1,
+		CheckpointWindow:     4,
+		CheckpointDistance:   2,
+		ShutdownTimeout:      5,
+	}
+	database := dbtest.New(t, cfg)
+
+	chain := mocknode.NewChain()
+	chain.Mine(5)
+	node := mocknode.New(chain)
+	defer node.Close()
+
+	connection := &eth.BlockchainNodeConnection{}
+	var err error
+	if connection.HTTP, err = rpc.Dial(node.HTTPUrl()); err != nil {
+		t.Fatal(err)
+	}
+	defer connection.HTTP.Close()
+	if connection.WebSocket, err = rpc.Dial(node.WebSocketUrl()); err != nil {
+		t.Fatal(err)
+	}
+	defer connection.WebSocket.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ListenForNewBlocks(ctx, connection, database, cfg)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// waitForChain mines blocks until the database has every block but the head with the hashes of the chain
+	waitForChain := func() {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) {
+			head := chain.MineBlock()
+			time.Sleep(100 * time.Millisecond)
+
+			hashes := []string{}
+			if err := database.NewSelect().Table("blocks").Column("hash").Where("number < ?", head).Order("number").Scan(context.Background(), &hashes); err != nil {
+				t.Fatal(err)
+			}
+			synced := len(hashes) == int(head-1)
+			for i := 0; synced && i < len(hashes); i++ {
+				synced = hashes[i] == chain.BlockByNumber(uint64(i+1)).Hash
+			}
+			if synced {
+				return
+			}
+		}
+		t.Fatal("the database did not catch up with the chain")
+	}
+
+	waitForChain()
+
+	// the replaced blocks are deleted by the checkpoint search and synchronized again
+	chain.Reorg(3)
+	waitForChain()
+}
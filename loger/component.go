@@ -0,0 +1,98 @@
+package loger
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// components with their own logger and level, the rest of the application uses the standard logger
+const (
+	Syncer   = "syncer"
+	Listener = "listener"
+	Eth      = "eth"
+	Db       = "db"
+	Workers  = "workers"
+	Webhooks = "webhooks"
+
+	// Default is the name of the standard logger
+	Default = "default"
+)
+
+const (
+	FormatText = "text"
+	FormatJson = "json"
+
+	OutputFile   = "file"
+	OutputStdout = "stdout"
+)
+
+var components = map[string]*logrus.Logger{
+	Syncer:   logrus.New(),
+	Listener: logrus.New(),
+	Eth:      logrus.New(),
+	Db:       logrus.New(),
+	Workers:  logrus.New(),
+	Webhooks: logrus.New(),
+}
+
+// Get returns the logger of the component. Its entries carry the component field.
+func Get(component string) *logrus.Entry {
+	logger, ok := components[component]
+	if !ok {
+		logger = logrus.StandardLogger()
+	}
+	return logger.WithField("component", component)
+}
+
+// Logger returns the underlying logger of the component, for libraries which expect a *logrus.Logger.
+func Logger(component string) *logrus.Logger {
+	if logger, ok := components[component]; ok {
+		return logger
+	}
+	return logrus.StandardLogger()
+}
+
+// Levels returns the current level of every component.
+func Levels() map[string]string {
+	levels := map[string]string{}
+	for name, logger := range loggersByName() {
+		levels[name] = logger.GetLevel().String()
+	}
+	return levels
+}
+
+// SetLevel changes the level of the component at runtime.
+func SetLevel(component string, level string) error {
+	logger, ok := loggersByName()[component]
+	if !ok {
+		return fmt.Errorf("unknown log component %s", component)
+	}
+
+	parsedLevel, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	logger.SetLevel(parsedLevel)
+	logrus.WithField("component", component).Info("Log level changed to ", parsedLevel)
+	return nil
+}
+
+func loggersByName() map[string]*logrus.Logger {
+	loggers := map[string]*logrus.Logger{
+		Default: logrus.StandardLogger(),
+	}
+	for name, logger := range components {
+		loggers[name] = logger
+	}
+	return loggers
+}
+
+func allLoggers() []*logrus.Logger {
+	loggers := []*logrus.Logger{}
+	for _, logger := range loggersByName() {
+		loggers = append(loggers, logger)
+	}
+	return loggers
+}
@@ -2,7 +2,12 @@ package loger
 
 import (
 	"bytes"
+	"ethernal/explorer/config"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
 	"time"
 
 	rotatelogs "github.com/lestrrat-go/file-rotatelogs"
@@ -32,34 +37,124 @@ func (MyFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 	}
 
 	if entry.Level == logrus.DebugLevel {
-		b.WriteString(fmt.Sprintf(" %s - %s (line:%d)\n[%s] %s\n\n",
+		b.WriteString(fmt.Sprintf(" %s - %s (line:%d)\n[%s] %s%s\n\n",
 			entry.Time.Format("2006-01-02 15:04:05"), entry.Caller.File,
-			entry.Caller.Line, levelList[int(entry.Level)], entry.Message))
+			entry.Caller.Line, levelList[int(entry.Level)], entry.Message, formatFields(entry.Data)))
 		return b.Bytes(), nil
 	} else {
-		b.WriteString(fmt.Sprintf(" %s [%s] %s\n\n",
-			entry.Time.Format("2006-01-02 15:04:05"), levelList[int(entry.Level)], entry.Message))
+		b.WriteString(fmt.Sprintf(" %s [%s] %s%s\n\n",
+			entry.Time.Format("2006-01-02 15:04:05"), levelList[int(entry.Level)], entry.Message, formatFields(entry.Data)))
 		return b.Bytes(), nil
 	}
 }
 
+// formatFields appends the entry fields to the message of the text format, sorted by key
+func formatFields(fields logrus.Fields) string {
+	if len(fields) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(fmt.Sprintf(" %s=%v", key, fields[key]))
+	}
+	return b.String()
+}
+
+// Setup configures the loggers with the defaults used until the configuration is loaded.
 func Setup() {
-	logrus.SetReportCaller(true)       // this line is for logging filename and line number
-	logrus.SetLevel(logrus.InfoLevel)  // setting log level
-	logrus.SetFormatter(MyFormatter{}) // setting custom formatter
+	for _, logger := range allLoggers() {
+		logger.SetReportCaller(true)       // this line is for logging filename and line number
+		logger.SetLevel(logrus.InfoLevel)  // setting log level
+		logger.SetFormatter(MyFormatter{}) // setting custom formatter
+	}
 }
 
-func Rotate() {
-	writer, err := rotatelogs.New(
-		"logs/logfile.%Y.%m.%d",
-		//rotatelogs.WithLinkName("logs/logfile"),
-		rotatelogs.WithRotationTime(7*24*time.Hour),
-		rotatelogs.WithMaxAge(-1),
-		rotatelogs.WithRotationCount(4),
-	)
+// Configure applies the logging configuration: format, output, rotation and the level of each component.
+func Configure(config *config.Config) error {
+	var formatter logrus.Formatter
+	switch config.LogFormat {
+	case "", FormatText:
+		formatter = MyFormatter{}
+	case FormatJson:
+		formatter = &logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano}
+	default:
+		return fmt.Errorf("unknown log format %s", config.LogFormat)
+	}
+
+	var output io.Writer
+	switch config.LogOutput {
+	case "", OutputFile:
+		writer, err := rotatelogs.New(
+			config.LogFile,
+			//rotatelogs.WithLinkName("logs/logfile"),
+			rotatelogs.WithRotationTime(time.Duration(config.LogRotationHours)*time.Hour),
+			rotatelogs.WithMaxAge(-1),
+			rotatelogs.WithRotationCount(config.LogRotationCount),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to initialize log file: %w", err)
+		}
+		output = writer
+	case OutputStdout:
+		output = os.Stdout
+	default:
+		return fmt.Errorf("unknown log output %s", config.LogOutput)
+	}
 
+	levels, err := parseLevels(config.LogLevel, config.LogLevels)
 	if err != nil {
-		logrus.Fatalf("Failed to Initialize Log File %s", err)
+		return err
+	}
+
+	for name, logger := range loggersByName() {
+		logger.SetFormatter(formatter)
+		logger.SetOutput(output)
+		logger.SetLevel(levels[name])
+	}
+	return nil
+}
+
+// parseLevels returns the level of every component, from the default level and the component=level list
+func parseLevels(defaultLevel string, componentLevels string) (map[string]logrus.Level, error) {
+	level := logrus.InfoLevel
+	if defaultLevel != "" {
+		var err error
+		if level, err = logrus.ParseLevel(defaultLevel); err != nil {
+			return nil, err
+		}
+	}
+
+	levels := map[string]logrus.Level{}
+	for name := range loggersByName() {
+		levels[name] = level
+	}
+
+	for _, pair := range strings.Split(componentLevels, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid component log level %s, expected component=level", pair)
+		}
+		component := strings.TrimSpace(parts[0])
+		if _, ok := levels[component]; !ok {
+			return nil, fmt.Errorf("unknown log component %s", component)
+		}
+		componentLevel, err := logrus.ParseLevel(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+		levels[component] = componentLevel
 	}
-	logrus.SetOutput(writer)
+	return levels, nil
 }
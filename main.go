@@ -1,45 +1,10 @@
 package main
 
 import (
-	"ethernal/explorer/common"
-	"ethernal/explorer/config"
-	"ethernal/explorer/db"
-	"ethernal/explorer/eth"
-	"ethernal/explorer/listener"
-	"ethernal/explorer/loger"
-	"ethernal/explorer/syncer"
-
-	"github.com/sirupsen/logrus"
+	"ethernal/explorer/cmd"
+	"os"
 )
 
 func main() {
-	loger.Setup()
-	loger.Rotate()
-
-	config, err := config.LoadConfig()
-	if err != nil {
-		logrus.Panic("Failed to load config, err: ", err.Error())
-	}
-
-	db := db.InitDb(config)
-
-	switch config.Mode {
-	case common.Manual:
-		// HTTP connection to blockchain
-		connection := eth.BlockchainNodeConnection{
-			HTTP: eth.GetClient(config.HTTPUrl),
-		}
-		go eth.SyncNftMetadata(db)
-		syncer.SyncMissingBlocks(connection.HTTP, db, config)
-	case common.Automatic:
-		// both HTTP and WebSocket connection to blockchain
-		connection := eth.BlockchainNodeConnection{
-			HTTP:      eth.GetClient(config.HTTPUrl),
-			WebSocket: eth.GetClient(config.WebSocketUrl),
-		}
-		go eth.SyncNftMetadata(db)
-		listener.ListenForNewBlocks(&connection, db, config)
-	default:
-		logrus.Info("Mode ", config.Mode, " is not provided")
-	}
+	os.Exit(cmd.Execute(os.Args[1:]))
 }
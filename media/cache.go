@@ -0,0 +1,193 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"ethernal/explorer/config"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrTooLarge        = errors.New("media file is too large")
+	ErrUnsupportedType = errors.New("unsupported media type")
+)
+
+// mediaTypes are the cached media types and the extensions of their files. SVG images are not cached: they can hold scripts,
+// which would run in the origin serving the cache.
+var mediaTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// maxThumbnailPixels bounds the size of the decoded images, larger images are cached without a thumbnail
+const maxThumbnailPixels = 50_000_000
+
+// Object is a cached media file, with its thumbnail when one could be generated
+type Object struct {
+	Path          string
+	MimeType      string
+	ThumbnailPath string
+}
+
+// Cache stores the media files under the SHA-256 of their content, so that a file shared by many tokens is stored once,
+// along with thumbnails of the PNG, JPEG and GIF images.
+type Cache struct {
+	store         Store
+	maxSize       int64
+	thumbnailSize int
+}
+
+func NewCache(store Store, maxSize int64, thumbnailSize int) *Cache {
+	return &Cache{store: store, maxSize: maxSize, thumbnailSize: thumbnailSize}
+}
+
+// NewConfiguredCache returns the cache set up by the configuration, or nil if the media cache is disabled
+func NewConfiguredCache(config *config.Config) *Cache {
+	var store Store
+	switch config.MediaStore {
+	case "local":
+		store = NewLocalStore(config.MediaDir)
+	case "s3":
+		client := &http.Client{Timeout: time.Duration(config.CallTimeoutInSeconds) * time.Second}
+		store = NewS3Store(config.MediaS3Endpoint, config.MediaS3Bucket, config.MediaS3Region, config.MediaS3AccessKey, config.MediaS3SecretKey, client)
+	default:
+		return nil
+	}
+	return NewCache(store, int64(config.MediaMaxSizeInMB)<<20, int(config.MediaThumbnailSize))
+}
+
+// MaxSize is the size in bytes of the largest file which is cached
+func (c *Cache) MaxSize() int64 {
+	return c.maxSize
+}
+
+// Save stores the file and its thumbnail, unless they are stored already. The media type is detected from the content,
+// the types which are not images are rejected.
+func (c *Cache) Save(ctx context.Context, data []byte) (*Object, error) {
+	if int64(len(data)) > c.maxSize {
+		return nil, ErrTooLarge
+	}
+	mimeType := DetectType(data)
+	extension, ok := mediaTypes[mimeType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, mimeType)
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	object := &Object{Path: hash[:2] + "/" + hash + extension, MimeType: mimeType}
+	if err := c.put(ctx, object.Path, mimeType, func() ([]byte, error) { return data, nil }); err != nil {
+		return nil, err
+	}
+
+	thumbnailPath := fmt.Sprintf("thumbnails/%d/%s/%s.png", c.thumbnailSize, hash[:2], hash)
+	err := c.put(ctx, thumbnailPath, "image/png", func() ([]byte, error) { return encodeThumbnail(data, c.thumbnailSize) })
+	switch {
+	case err == nil:
+		object.ThumbnailPath = thumbnailPath
+	case !errors.Is(err, errNoThumbnail):
+		return nil, err
+	}
+	return object, nil
+}
+
+// put stores the file returned by content under the key, if no file is stored under it
+func (c *Cache) put(ctx context.Context, key string, contentType string, content func() ([]byte, error)) error {
+	exists, err := c.store.Exists(ctx, key)
+	if err != nil || exists {
+		return err
+	}
+	data, err := content()
+	if err != nil {
+		return err
+	}
+	return c.store.Put(ctx, key, contentType, data)
+}
+
+// DetectType returns the media type of the file from its first bytes
+func DetectType(data []byte) string {
+	mimeType := http.DetectContentType(data)
+	if mimeType == "text/xml; charset=utf-8" || mimeType == "text/plain; charset=utf-8" {
+		head := data
+		if len(head) > 1024 {
+			head = head[:1024]
+		}
+		if bytes.Contains(bytes.ToLower(head), []byte("<svg")) {
+			return "image/svg+xml"
+		}
+	}
+	return mimeType
+}
+
+var errNoThumbnail = errors.New("no thumbnail for this media type")
+
+// encodeThumbnail returns the PNG thumbnail of the image, scaled down to fit in a square of size pixels
+func encodeThumbnail(data []byte, size int) ([]byte, error) {
+	imageConfig, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || imageConfig.Width*imageConfig.Height > maxThumbnailPixels {
+		return nil, errNoThumbnail
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errNoThumbnail
+	}
+
+	buffer := &bytes.Buffer{}
+	if err := png.Encode(buffer, thumbnail(decoded, size)); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// thumbnail scales the image down to fit in a square of size pixels, every pixel of the thumbnail is the average of the pixels it covers.
+// Smaller images are kept as they are.
+func thumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+	thumbnailWidth, thumbnailHeight := size, size
+	if width > height {
+		thumbnailHeight = max(1, height*size/width)
+	} else {
+		thumbnailWidth = max(1, width*size/height)
+	}
+
+	scaled := image.NewNRGBA(image.Rect(0, 0, thumbnailWidth, thumbnailHeight))
+	for y := 0; y < thumbnailHeight; y++ {
+		fromY, toY := bounds.Min.Y+y*height/thumbnailHeight, bounds.Min.Y+(y+1)*height/thumbnailHeight
+		for x := 0; x < thumbnailWidth; x++ {
+			fromX, toX := bounds.Min.X+x*width/thumbnailWidth, bounds.Min.X+(x+1)*width/thumbnailWidth
+			var r, g, b, a, count uint64
+			for sourceY := fromY; sourceY < toY; sourceY++ {
+				for sourceX := fromX; sourceX < toX; sourceX++ {
+					pixelR, pixelG, pixelB, pixelA := img.At(sourceX, sourceY).RGBA()
+					r, g, b, a = r+uint64(pixelR), g+uint64(pixelG), b+uint64(pixelB), a+uint64(pixelA)
+					count++
+				}
+			}
+			scaled.Set(x, y, color.RGBA64{R: uint16(r / count), G: uint16(g / count), B: uint16(b / count), A: uint16(a / count)})
+		}
+	}
+	return scaled
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
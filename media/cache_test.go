@@ -0,0 +1,75 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func encodePng(t *testing.T, width int, height int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	buffer := &bytes.Buffer{}
+	if err := png.Encode(buffer, img); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestCacheSave(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewCache(NewLocalStore(dir), 1<<20, 64)
+
+	data := encodePng(t, 200, 100)
+	object, err := cache.Save(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object.MimeType != "image/png" || filepath.Ext(object.Path) != ".png" || object.ThumbnailPath == "" {
+		t.Fatalf("unexpected cached object %+v", object)
+	}
+	stored, err := os.ReadFile(filepath.Join(dir, object.Path))
+	if err != nil || !bytes.Equal(stored, data) {
+		t.Fatalf("cached file differs from the image (err: %v)", err)
+	}
+	thumbnailFile, err := os.Open(filepath.Join(dir, object.ThumbnailPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer thumbnailFile.Close()
+	thumbnail, err := png.DecodeConfig(thumbnailFile)
+	if err != nil || thumbnail.Width != 64 || thumbnail.Height != 32 {
+		t.Fatalf("thumbnail is %dx%d, expected 64x32 (err: %v)", thumbnail.Width, thumbnail.Height, err)
+	}
+
+	again, err := cache.Save(context.Background(), data)
+	if err != nil || *again != *object {
+		t.Fatalf("image cached again as %+v (err: %v)", again, err)
+	}
+}
+
+func TestCacheSaveRejected(t *testing.T) {
+	cache := NewCache(NewLocalStore(t.TempDir()), 1024, 64)
+	if _, err := cache.Save(context.Background(), []byte("<html><body>not an image</body></html>")); !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("html saved with %v, expected ErrUnsupportedType", err)
+	}
+	// an SVG image can run scripts
+	svg := []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`)
+	if _, err := cache.Save(context.Background(), svg); !errors.Is(err, ErrUnsupportedType) || !strings.Contains(err.Error(), "image/svg+xml") {
+		t.Fatalf("svg saved with %v, expected ErrUnsupportedType", err)
+	}
+	if _, err := cache.Save(context.Background(), encodePng(t, 300, 300)); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("large image saved with %v, expected ErrTooLarge", err)
+	}
+}
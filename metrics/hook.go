@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+type QueryHook struct{}
+
+var _ bun.QueryHook = (*QueryHook)(nil)
+
+func (QueryHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+// AfterQuery records the query latency by operation and table.
+func (QueryHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	table := ""
+	if query, ok := event.IQuery.(interface{ GetTableName() string }); ok {
+		table = query.GetTableName()
+	}
+	DbQueryDuration.WithLabelValues(event.Operation(), table).Observe(Since(event.StartTime))
+}
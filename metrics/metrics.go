@@ -0,0 +1,245 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "explorer"
+
+// NFT metadata fetch outcomes
+const (
+	MetadataSuccess     = "success"
+	MetadataNoUri       = "no_uri"
+	MetadataUnsupported = "unsupported_uri"
+	MetadataRejected    = "rejected"
+	MetadataFetchError  = "fetch_error"
+)
+
+// NFT metadata job outcomes
+const (
+	MetadataJobDone   = "done"
+	MetadataJobRetry  = "retry"
+	MetadataJobFailed = "failed"
+)
+
+// NFT media cache outcomes
+const (
+	MediaCached   = "cached"
+	MediaReused   = "reused"
+	MediaRejected = "rejected"
+	MediaError    = "error"
+)
+
+// IPFS request outcomes
+const (
+	IpfsSuccess  = "success"
+	IpfsNotFound = "not_found"
+	IpfsInvalid  = "invalid"
+	IpfsError    = "error"
+)
+
+var (
+	ChainHead = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "chain_head_block",
+		Help:      "Number of the latest block on the blockchain.",
+	})
+	IndexedHead = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "indexed_head_block",
+		Help:      "Number of the highest block in the database.",
+	})
+	ContiguousHead = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "contiguous_head_block",
+		Help:      "Number of the block up to which every block from the checkpoint is in the database, maintained in ordered commit mode.",
+	})
+	HeadLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "head_lag_blocks",
+		Help:      "Difference between the latest block on the blockchain and the highest block in the database.",
+	})
+
+	IndexedBlocks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "indexed_blocks_total",
+		Help:      "Number of blocks inserted into the database.",
+	})
+	IndexedTransactions = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "indexed_transactions_total",
+		Help:      "Number of transactions inserted into the database.",
+	})
+	IndexedLogs = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "indexed_logs_total",
+		Help:      "Number of logs inserted into the database.",
+	})
+	IndexedNftTransfers = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "indexed_nft_transfers_total",
+		Help:      "Number of NFT transfers inserted into the database.",
+	})
+
+	SyncDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sync_duration_seconds",
+		Help:      "Duration of a synchronization run.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 16),
+	})
+	JobDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Duration of a worker pool job.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 14),
+	})
+	FailedJobs = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "failed_jobs_total",
+		Help:      "Number of sync jobs which failed after their retries, or whose result could not be committed.",
+	})
+	PendingJobs = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "worker_pool_pending_jobs",
+		Help:      "Number of jobs waiting for a worker.",
+	})
+	StageBuffered = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pipeline_buffered_batches",
+		Help:      "Number of batches done by a pipeline stage and waiting for the next one, by stage.",
+	}, []string{"stage"})
+
+	RpcDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rpc_request_duration_seconds",
+		Help:      "Latency of requests sent to the blockchain node, by method, the batches are labeled batch.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"method"})
+	RpcErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_errors_total",
+		Help:      "Number of failed requests sent to the blockchain node, by method.",
+	}, []string{"method"})
+	RpcBatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rpc_batch_size",
+		Help:      "Number of calls in one batch sent to the blockchain node.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	})
+
+	DbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Latency of database queries, by operation and table.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 16),
+	}, []string{"operation", "table"})
+	DbCommitDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_commit_duration_seconds",
+		Help:      "Duration of the transaction inserting the result of one sync job.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	})
+
+	Reorgs = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reorgs_total",
+		Help:      "Number of validations which found blocks that are no longer on the blockchain.",
+	})
+	ReorgedBlocks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reorged_blocks_total",
+		Help:      "Number of blocks deleted from the database because they are no longer on the blockchain.",
+	})
+
+	NftSkippedRanges = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "nft_consecutive_ranges_skipped_total",
+		Help:      "Number of ERC-2309 ConsecutiveTransfer events not stored as one transfer per token, because their range of tokens is too large or invalid.",
+	})
+	NftMetadataFetches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "nft_metadata_fetches_total",
+		Help:      "Number of NFT metadata fetches, by outcome.",
+	}, []string{"outcome"})
+	NftMetadataJobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "nft_metadata_jobs_total",
+		Help:      "Number of finished attempts of the NFT metadata jobs, by outcome: done, retry or failed permanently.",
+	}, []string{"outcome"})
+	NftCollectionJobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "nft_collection_jobs_total",
+		Help:      "Number of finished attempts to fetch the metadata of the NFT collections, by outcome: done, retry or failed permanently.",
+	}, []string{"outcome"})
+	IpfsRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ipfs_requests_total",
+		Help:      "Number of requests sent to the IPFS gateways and nodes, by backend and outcome: success, not_found, invalid (content not matching its CID) or error.",
+	}, []string{"backend", "outcome"})
+	IpfsBackendHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ipfs_backend_healthy",
+		Help:      "Whether the IPFS gateway or node is used (1) or skipped after consecutive failures (0).",
+	}, []string{"backend"})
+	NftMedia = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "nft_media_total",
+		Help:      "Number of NFT images cached, by outcome: cached, reused from the previous metadata, rejected or error.",
+	}, []string{"outcome"})
+)
+
+var headLock = &sync.Mutex{}
+var chainHead, indexedHead uint64
+
+// SetChainHead records the latest block on the blockchain and updates the head lag.
+func SetChainHead(number uint64) {
+	headLock.Lock()
+	defer headLock.Unlock()
+	chainHead = number
+	ChainHead.Set(float64(number))
+	updateHeadLag()
+}
+
+// SetIndexedHead records the highest block in the database and updates the head lag.
+func SetIndexedHead(number uint64) {
+	headLock.Lock()
+	defer headLock.Unlock()
+	indexedHead = number
+	IndexedHead.Set(float64(number))
+	updateHeadLag()
+}
+
+// ObserveIndexedHead raises the highest block in the database if the number is above it.
+func ObserveIndexedHead(number uint64) {
+	headLock.Lock()
+	defer headLock.Unlock()
+	if number > indexedHead {
+		indexedHead = number
+		IndexedHead.Set(float64(number))
+		updateHeadLag()
+	}
+}
+
+// Heads returns the latest block on the blockchain and the highest block in the database, as last recorded.
+func Heads() (uint64, uint64) {
+	headLock.Lock()
+	defer headLock.Unlock()
+	return chainHead, indexedHead
+}
+
+func updateHeadLag() {
+	if chainHead > indexedHead {
+		HeadLag.Set(float64(chainHead - indexedHead))
+	} else {
+		HeadLag.Set(0)
+	}
+}
+
+// Since returns the seconds elapsed from start, for observing histograms.
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// BatchMethod labels the latency of the batches, which contain calls of several methods
+const BatchMethod = "batch"
+
+// ObserveRpcCall records the latency and the outcome of a single call.
+func ObserveRpcCall(method string, start time.Time, err error) {
+	RpcDuration.WithLabelValues(method).Observe(Since(start))
+	if err != nil {
+		RpcErrors.WithLabelValues(method).Inc()
+	}
+}
+
+// ObserveRpcBatch records the latency and the size of a batch, and the errors of its calls.
+// The latency is labeled with the batch method, so that the latency of every method is the one of its single calls,
+// while the errors are counted for the method of every failed call.
+func ObserveRpcBatch(elems []rpc.BatchElem, start time.Time, err error) {
+	RpcDuration.WithLabelValues(BatchMethod).Observe(Since(start))
+	RpcBatchSize.Observe(float64(len(elems)))
+
+	for _, e := range elems {
+		// a failed batch fails all its calls
+		if err != nil || e.Error != nil {
+			RpcErrors.WithLabelValues(e.Method).Inc()
+		}
+	}
+}
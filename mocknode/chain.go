@@ -0,0 +1,470 @@
+package mocknode
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ZeroAddress is the sender of minted NFTs.
+const ZeroAddress = "0x0000000000000000000000000000000000000000"
+
+// Block is a block of the scripted chain, in the JSON format of eth_getBlockByNumber without full transactions.
+type Block struct {
+	Hash            string         `json:"hash"`
+	Number          hexutil.Uint64 `json:"number"`
+	ParentHash      string         `json:"parentHash"`
+	Nonce           string         `json:"nonce"`
+	Miner           string         `json:"miner"`
+	Difficulty      hexutil.Uint64 `json:"difficulty"`
+	TotalDifficulty hexutil.Uint64 `json:"totalDifficulty"`
+	ExtraData       string         `json:"extraData"`
+	Size            hexutil.Uint64 `json:"size"`
+	GasLimit        hexutil.Uint64 `json:"gasLimit"`
+	GasUsed         hexutil.Uint64 `json:"gasUsed"`
+	Timestamp       hexutil.Uint64 `json:"timestamp"`
+	Transactions    []string       `json:"transactions"`
+}
+
+// Header is the notification sent to the newHeads subscribers.
+type Header struct {
+	Hash       string         `json:"hash"`
+	Number     hexutil.Uint64 `json:"number"`
+	ParentHash string         `json:"parentHash"`
+	Timestamp  hexutil.Uint64 `json:"timestamp"`
+}
+
+type Transaction struct {
+	Hash             string         `json:"hash"`
+	BlockHash        string         `json:"blockHash"`
+	BlockNumber      hexutil.Uint64 `json:"blockNumber"`
+	From             string         `json:"from"`
+	To               *string        `json:"to"`
+	Gas              hexutil.Uint64 `json:"gas"`
+	GasPrice         hexutil.Uint64 `json:"gasPrice"`
+	Input            string         `json:"input"`
+	Nonce            hexutil.Uint64 `json:"nonce"`
+	TransactionIndex hexutil.Uint64 `json:"transactionIndex"`
+	Value            *hexutil.Big   `json:"value"`
+}
+
+type Receipt struct {
+	TransactionHash   string         `json:"transactionHash"`
+	TransactionIndex  hexutil.Uint64 `json:"transactionIndex"`
+	BlockHash         string         `json:"blockHash"`
+	BlockNumber       hexutil.Uint64 `json:"blockNumber"`
+	CumulativeGasUsed hexutil.Uint64 `json:"cumulativeGasUsed"`
+	GasUsed           hexutil.Uint64 `json:"gasUsed"`
+	ContractAddress   *string        `json:"contractAddress"`
+	Logs              []*Log         `json:"logs"`
+	Status            hexutil.Uint64 `json:"status"`
+}
+
+type Log struct {
+	Address          string         `json:"address"`
+	Topics           []string       `json:"topics"`
+	Data             string         `json:"data"`
+	BlockNumber      hexutil.Uint64 `json:"blockNumber"`
+	TransactionHash  string         `json:"transactionHash"`
+	TransactionIndex hexutil.Uint64 `json:"transactionIndex"`
+	BlockHash        string         `json:"blockHash"`
+	LogIndex         hexutil.Uint64 `json:"logIndex"`
+}
+
+// Tx describes a transaction to include in a mined block.
+type Tx struct {
+	From  string
+	To    string
+	Value *big.Int
+	Input string
+	// ContractAddress is the address of the created contract, if To is empty
+	ContractAddress string
+	Logs            []LogSpec
+}
+
+// LogSpec describes a log emitted by a transaction.
+type LogSpec struct {
+	Address string
+	Topics  []string
+	Data    string
+}
+
+// Chain is a scripted blockchain. Blocks are mined on demand and the last blocks can be replaced to simulate reorgs.
+type Chain struct {
+	lock         sync.RWMutex
+	blocks       []*Block
+	transactions map[string]*Transaction
+	receipts     map[string]*Receipt
+	calls        map[string]string
+	// failing are the numbers of the blocks whose requests fail
+	failing map[uint64]bool
+	// fork makes the hashes of the blocks mined after a reorg differ from the replaced ones
+	fork        int
+	subscribers map[chan *Header]struct{}
+}
+
+// NewChain creates a chain with the genesis block.
+func NewChain() *Chain {
+	chain := &Chain{
+		transactions: map[string]*Transaction{},
+		receipts:     map[string]*Receipt{},
+		calls:        map[string]string{},
+		failing:      map[uint64]bool{},
+		subscribers:  map[chan *Header]struct{}{},
+	}
+	chain.mine()
+	return chain
+}
+
+// Mine appends count empty blocks and returns the number of the last one.
+func (c *Chain) Mine(count int) uint64 {
+	var number uint64
+	for i := 0; i < count; i++ {
+		number = c.MineBlock()
+	}
+	return number
+}
+
+// MineBlock appends a block with the transactions, notifies the subscribers and returns the block number.
+func (c *Chain) MineBlock(txs ...Tx) uint64 {
+	block := c.mine(txs...)
+	c.notify(block)
+	return uint64(block.Number)
+}
+
+// Reorg replaces the last depth blocks with as many new blocks, which have different hashes, and notifies the subscribers of the new head.
+func (c *Chain) Reorg(depth int) {
+	c.lock.Lock()
+	removed := c.blocks[len(c.blocks)-depth:]
+	c.blocks = c.blocks[:len(c.blocks)-depth]
+	for _, block := range removed {
+		for _, hash := range block.Transactions {
+			delete(c.transactions, hash)
+			delete(c.receipts, hash)
+		}
+	}
+	c.fork++
+	c.lock.Unlock()
+
+	var block *Block
+	for i := 0; i < depth; i++ {
+		block = c.mine()
+	}
+	c.notify(block)
+}
+
+// Head returns the latest block.
+func (c *Chain) Head() *Block {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.blocks[len(c.blocks)-1]
+}
+
+// BlockByNumber returns the canonical block with the number, nil if it is not mined yet.
+func (c *Chain) BlockByNumber(number uint64) *Block {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if number >= uint64(len(c.blocks)) {
+		return nil
+	}
+	return c.blocks[number]
+}
+
+// FailBlock makes the requests of the block fail, e.g. to simulate a node losing a block, until it is called again with failing set to false.
+func (c *Chain) FailBlock(number uint64, failing bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.failing[number] = failing
+}
+
+func (c *Chain) isFailing(number uint64) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.failing[number]
+}
+
+// SetCall sets the result returned by eth_call for the data sent to the address.
+func (c *Chain) SetCall(to string, data string, result string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.calls[callKey(to, data)] = result
+}
+
+// SetTokenURI sets the metadata URI returned by tokenURI(tokenId) and uri(tokenId) of the NFT contract.
+func (c *Chain) SetTokenURI(contract string, tokenId int64, uri string) {
+	stringType, _ := abi.NewType("string", "", nil)
+	result, _ := abi.Arguments{{Type: stringType}}.Pack(uri)
+	id := common.LeftPadBytes(big.NewInt(tokenId).Bytes(), 32)
+	// tokenURI(uint256) of ERC-721 and uri(uint256) of ERC-1155
+	for _, selector := range []string{"c87b56dd", "0e89341c"} {
+		c.SetCall(contract, "0x"+selector+common.Bytes2Hex(id), hexutil.Encode(result))
+	}
+}
+
+// SetCollection sets the values returned by name(), symbol() and contractURI() of the NFT contract.
+func (c *Chain) SetCollection(contract string, name string, symbol string, contractUri string) {
+	stringType, _ := abi.NewType("string", "", nil)
+	for selector, value := range map[string]string{"06fdde03": name, "95d89b41": symbol, "e8a3d485": contractUri} {
+		result, _ := abi.Arguments{{Type: stringType}}.Pack(value)
+		c.SetCall(contract, "0x"+selector, hexutil.Encode(result))
+	}
+}
+
+func (c *Chain) call(to string, data string) string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if result, ok := c.calls[callKey(to, data)]; ok {
+		return result
+	}
+	return "0x"
+}
+
+func (c *Chain) transaction(hash string) *Transaction {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.transactions[hash]
+}
+
+func (c *Chain) receipt(hash string) *Receipt {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.receipts[hash]
+}
+
+func (c *Chain) mine(txs ...Tx) *Block {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	number := uint64(len(c.blocks))
+	block := &Block{
+		Hash:         hash("block", number, c.fork),
+		Number:       hexutil.Uint64(number),
+		ParentHash:   common.Hash{}.Hex(),
+		Nonce:        "0x0000000000000000",
+		Miner:        ZeroAddress,
+		ExtraData:    "0x",
+		Size:         hexutil.Uint64(500),
+		GasLimit:     hexutil.Uint64(30000000),
+		Timestamp:    hexutil.Uint64(1700000000 + number*12),
+		Transactions: []string{},
+	}
+	if number > 0 {
+		block.ParentHash = c.blocks[number-1].Hash
+	}
+
+	var logIndex uint64
+	for i, tx := range txs {
+		transaction := &Transaction{
+			Hash:             hash("transaction", number, c.fork, i),
+			BlockHash:        block.Hash,
+			BlockNumber:      block.Number,
+			From:             strings.ToLower(tx.From),
+			Gas:              hexutil.Uint64(21000),
+			GasPrice:         hexutil.Uint64(1000000000),
+			Input:            "0x",
+			TransactionIndex: hexutil.Uint64(i),
+			Value:            (*hexutil.Big)(big.NewInt(0)),
+		}
+		if tx.To != "" {
+			to := strings.ToLower(tx.To)
+			transaction.To = &to
+		}
+		if tx.Input != "" {
+			transaction.Input = tx.Input
+		}
+		if tx.Value != nil {
+			transaction.Value = (*hexutil.Big)(tx.Value)
+		}
+
+		receipt := &Receipt{
+			TransactionHash:   transaction.Hash,
+			TransactionIndex:  transaction.TransactionIndex,
+			BlockHash:         block.Hash,
+			BlockNumber:       block.Number,
+			CumulativeGasUsed: hexutil.Uint64(21000 * (i + 1)),
+			GasUsed:           hexutil.Uint64(21000),
+			Logs:              []*Log{},
+			Status:            hexutil.Uint64(1),
+		}
+		if tx.ContractAddress != "" {
+			contractAddress := strings.ToLower(tx.ContractAddress)
+			receipt.ContractAddress = &contractAddress
+		}
+		for _, spec := range tx.Logs {
+			receipt.Logs = append(receipt.Logs, &Log{
+				Address:          strings.ToLower(spec.Address),
+				Topics:           spec.Topics,
+				Data:             spec.Data,
+				BlockNumber:      block.Number,
+				TransactionHash:  transaction.Hash,
+				TransactionIndex: transaction.TransactionIndex,
+				BlockHash:        block.Hash,
+				LogIndex:         hexutil.Uint64(logIndex),
+			})
+			logIndex++
+		}
+
+		c.transactions[transaction.Hash] = transaction
+		c.receipts[transaction.Hash] = receipt
+		block.Transactions = append(block.Transactions, transaction.Hash)
+		block.GasUsed += receipt.GasUsed
+	}
+
+	c.blocks = append(c.blocks, block)
+	return block
+}
+
+func (c *Chain) subscribe() chan *Header {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	heads := make(chan *Header, 16)
+	c.subscribers[heads] = struct{}{}
+	return heads
+}
+
+func (c *Chain) unsubscribe(heads chan *Header) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.subscribers, heads)
+}
+
+func (c *Chain) notify(block *Block) {
+	header := &Header{
+		Hash:       block.Hash,
+		Number:     block.Number,
+		ParentHash: block.ParentHash,
+		Timestamp:  block.Timestamp,
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for heads := range c.subscribers {
+		select {
+		case heads <- header:
+		default:
+		}
+	}
+}
+
+// Erc721Transfer returns the Transfer log of an ERC-721 token.
+func Erc721Transfer(contract string, from string, to string, tokenId int64) LogSpec {
+	return LogSpec{
+		Address: contract,
+		Topics: []string{
+			"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef",
+			addressTopic(from),
+			addressTopic(to),
+			common.BigToHash(big.NewInt(tokenId)).Hex(),
+		},
+		Data: "0x",
+	}
+}
+
+// Erc1155TransferSingle returns the TransferSingle log of an ERC-1155 token.
+func Erc1155TransferSingle(contract string, operator string, from string, to string, id int64, value int64) LogSpec {
+	return LogSpec{
+		Address: contract,
+		Topics: []string{
+			"0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62",
+			addressTopic(operator),
+			addressTopic(from),
+			addressTopic(to),
+		},
+		Data: hexutil.Encode(append(common.BigToHash(big.NewInt(id)).Bytes(), common.BigToHash(big.NewInt(value)).Bytes()...)),
+	}
+}
+
+// MetadataUpdate returns the ERC-4906 MetadataUpdate log of a token.
+func MetadataUpdate(contract string, tokenId int64) LogSpec {
+	return LogSpec{
+		Address: contract,
+		Topics:  []string{"0xf8e1a15aba9398e019f0b49df1a4fde98ee17ae345cb5f6b5e2c27f5033e8ce7"},
+		Data:    common.BigToHash(big.NewInt(tokenId)).Hex(),
+	}
+}
+
+// BatchMetadataUpdate returns the ERC-4906 BatchMetadataUpdate log of a range of tokens.
+func BatchMetadataUpdate(contract string, fromTokenId int64, toTokenId int64) LogSpec {
+	return LogSpec{
+		Address: contract,
+		Topics:  []string{"0x6bd5c950a8d8df17f772f5af37cb3655737899cbf903264b9795592da439661c"},
+		Data:    hexutil.Encode(append(common.BigToHash(big.NewInt(fromTokenId)).Bytes(), common.BigToHash(big.NewInt(toTokenId)).Bytes()...)),
+	}
+}
+
+// Erc1155Uri returns the URI log of an ERC-1155 token.
+func Erc1155Uri(contract string, uri string, id int64) LogSpec {
+	data := common.BigToHash(big.NewInt(32)).Bytes()
+	data = append(data, common.BigToHash(big.NewInt(int64(len(uri)))).Bytes()...)
+	data = append(data, common.RightPadBytes([]byte(uri), (len(uri)+31)/32*32)...)
+	return LogSpec{
+		Address: contract,
+		Topics: []string{
+			"0x6bb7ff708619ba0610cba295a58592e0451dee2622938c8755667688daf3529b",
+			common.BigToHash(big.NewInt(id)).Hex(),
+		},
+		Data: hexutil.Encode(data),
+	}
+}
+
+// ConsecutiveTransfer returns the ERC-2309 ConsecutiveTransfer log of a range of ERC-721 tokens.
+func ConsecutiveTransfer(contract string, from string, to string, fromTokenId int64, toTokenId int64) LogSpec {
+	return LogSpec{
+		Address: contract,
+		Topics: []string{
+			"0xdeaa91b6123d068f5821d0fb0678463d1a8a6079fe8af5de3ce5e896dcf9133d",
+			common.BigToHash(big.NewInt(fromTokenId)).Hex(),
+			addressTopic(from),
+			addressTopic(to),
+		},
+		Data: common.BigToHash(big.NewInt(toTokenId)).Hex(),
+	}
+}
+
+// Locked returns the ERC-5192 Locked log of a token, or its Unlocked log if locked is false.
+func Locked(contract string, tokenId int64, locked bool) LogSpec {
+	signature := "0x032bc66be43dbccb7487781d168eb7bda224628a3b2c3388bdf69b532a3a1611"
+	if !locked {
+		signature = "0xf27b6ce5b2f5e68ddb2fd95a8a909d4ecf1daaac270935fff052feacb24f1842"
+	}
+	return LogSpec{
+		Address: contract,
+		Topics:  []string{signature},
+		Data:    common.BigToHash(big.NewInt(tokenId)).Hex(),
+	}
+}
+
+// AccountCreated returns the ERC6551AccountCreated log of the account created by an ERC-6551 registry for a token.
+func AccountCreated(registry string, account string, implementation string, salt int64, chainId int64, tokenContract string, tokenId int64) LogSpec {
+	data := common.LeftPadBytes(common.HexToAddress(account).Bytes(), 32)
+	data = append(data, common.BigToHash(big.NewInt(salt)).Bytes()...)
+	data = append(data, common.BigToHash(big.NewInt(chainId)).Bytes()...)
+	return LogSpec{
+		Address: registry,
+		Topics: []string{
+			"0x79f19b3655ee38b1ce526556b7731a20c8f218fbda4a3990b6cc4172fdf88722",
+			addressTopic(implementation),
+			addressTopic(tokenContract),
+			common.BigToHash(big.NewInt(tokenId)).Hex(),
+		},
+		Data: hexutil.Encode(data),
+	}
+}
+
+func addressTopic(address string) string {
+	return common.BytesToHash(common.HexToAddress(address).Bytes()).Hex()
+}
+
+func hash(parts ...interface{}) string {
+	return crypto.Keccak256Hash([]byte(fmt.Sprint(parts...))).Hex()
+}
+
+func callKey(to string, data string) string {
+	return strings.ToLower(to) + "|" + strings.ToLower(data)
+}
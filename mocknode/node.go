@@ -0,0 +1,156 @@
+// Package mocknode serves a scripted chain over JSON-RPC, on HTTP and WebSocket, for the tests of the syncer and the listener.
+package mocknode
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Node is an in-process Ethereum node serving the chain. NFT metadata documents are served on the same address.
+type Node struct {
+	Chain *Chain
+
+	server    *httptest.Server
+	rpc       *rpc.Server
+	lock      sync.RWMutex
+	documents map[string]string
+}
+
+// New starts a node serving the chain.
+func New(chain *Chain) *Node {
+	node := &Node{
+		Chain:     chain,
+		rpc:       rpc.NewServer(),
+		documents: map[string]string{},
+	}
+	if err := node.rpc.RegisterName("eth", &ethService{chain: chain}); err != nil {
+		panic(err)
+	}
+
+	websocket := node.rpc.WebsocketHandler([]string{"*"})
+	node.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/metadata/"):
+			node.serveDocument(w, r)
+		case strings.EqualFold(r.Header.Get("Upgrade"), "websocket"):
+			websocket.ServeHTTP(w, r)
+		default:
+			node.rpc.ServeHTTP(w, r)
+		}
+	}))
+	return node
+}
+
+// HTTPUrl returns the JSON-RPC address of the node.
+func (n *Node) HTTPUrl() string {
+	return n.server.URL
+}
+
+// WebSocketUrl returns the JSON-RPC address of the node for subscriptions.
+func (n *Node) WebSocketUrl() string {
+	return "ws" + strings.TrimPrefix(n.server.URL, "http")
+}
+
+// ServeMetadata serves the JSON document on /metadata/<name> and returns its URL.
+func (n *Node) ServeMetadata(name string, document string) string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.documents[name] = document
+	return n.server.URL + "/metadata/" + name
+}
+
+// Close stops the node and drops the open subscriptions.
+func (n *Node) Close() {
+	n.rpc.Stop()
+	n.server.CloseClientConnections()
+	n.server.Close()
+}
+
+func (n *Node) serveDocument(w http.ResponseWriter, r *http.Request) {
+	n.lock.RLock()
+	document, ok := n.documents[strings.TrimPrefix(r.URL.Path, "/metadata/")]
+	n.lock.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(document))
+}
+
+// ethService implements the eth namespace methods used by the explorer
+type ethService struct {
+	chain *Chain
+}
+
+type callArgs struct {
+	To   string `json:"to"`
+	Data string `json:"data"`
+}
+
+func (s *ethService) BlockNumber() hexutil.Uint64 {
+	return s.chain.Head().Number
+}
+
+func (s *ethService) GetBlockByNumber(number string, fullTransactions bool) (*Block, error) {
+	if fullTransactions {
+		return nil, errors.New("full transactions are not supported")
+	}
+
+	switch number {
+	case "latest", "pending", "safe", "finalized":
+		return s.chain.Head(), nil
+	case "earliest":
+		return s.chain.BlockByNumber(0), nil
+	}
+	parsed, err := hexutil.DecodeUint64(number)
+	if err != nil {
+		return nil, err
+	}
+	if s.chain.isFailing(parsed) {
+		return nil, errors.New("block not available")
+	}
+	return s.chain.BlockByNumber(parsed), nil
+}
+
+func (s *ethService) GetTransactionByHash(hash string) *Transaction {
+	return s.chain.transaction(hash)
+}
+
+func (s *ethService) GetTransactionReceipt(hash string) *Receipt {
+	return s.chain.receipt(hash)
+}
+
+func (s *ethService) Call(args callArgs, block string) string {
+	return s.chain.call(args.To, args.Data)
+}
+
+// NewHeads implements eth_subscribe("newHeads")
+func (s *ethService) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+
+	subscription := notifier.CreateSubscription()
+	heads := s.chain.subscribe()
+	go func() {
+		defer s.chain.unsubscribe(heads)
+		for {
+			select {
+			case header := <-heads:
+				notifier.Notify(subscription.ID, header)
+			case <-subscription.Err():
+				return
+			}
+		}
+	}()
+	return subscription, nil
+}
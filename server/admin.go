@@ -0,0 +1,69 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"ethernal/explorer/loger"
+	"net/http"
+	"strings"
+)
+
+type logLevelRequest struct {
+	Component string `json:"component"`
+	Level     string `json:"level"`
+}
+
+type logLevelResponse struct {
+	Levels map[string]string `json:"levels"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// requireToken serves the requests carrying the token as a bearer token in the Authorization header, and refuses the other ones
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		given := strings.TrimPrefix(authorization, "Bearer ")
+		if given == authorization || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// logLevel returns the log level of every component on GET and changes the level of one component on PUT or POST,
+// e.g. {"component": "syncer", "level": "debug"}.
+func logLevel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		request := logLevelRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeLogLevels(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := loger.SetLevel(request.Component, request.Level); err != nil {
+			writeLogLevels(w, http.StatusBadRequest, err)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeLogLevels(w, http.StatusOK, nil)
+}
+
+func writeLogLevels(w http.ResponseWriter, status int, err error) {
+	response := logLevelResponse{Levels: loger.Levels()}
+	if err != nil {
+		response.Error = err.Error()
+	}
+
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"ethernal/explorer/loger"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func adminRequest(t *testing.T, authorization string, method string, body string) (int, *logLevelResponse) {
+	t.Helper()
+	request := httptest.NewRequest(method, "/admin/log-level", strings.NewReader(body))
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+	recorder := httptest.NewRecorder()
+	requireToken("s3cret", http.HandlerFunc(logLevel)).ServeHTTP(recorder, request)
+
+	if recorder.Code == http.StatusUnauthorized {
+		return recorder.Code, nil
+	}
+	response := &logLevelResponse{}
+	if err := json.NewDecoder(recorder.Body).Decode(response); err != nil {
+		t.Fatal(err)
+	}
+	return recorder.Code, response
+}
+
+func TestLogLevelRequiresToken(t *testing.T) {
+	levels := loger.Levels()
+	tests := []struct {
+		name          string
+		authorization string
+	}{
+		{"missing token", ""},
+		{"wrong token", "Bearer other"},
+		{"token without scheme", "s3cret"},
+		{"basic scheme", "Basic s3cret"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, _ := adminRequest(t, test.authorization, http.MethodPut, `{"component": "syncer", "level": "trace"}`)
+			if code != http.StatusUnauthorized {
+				t.Fatalf("status %d, expected %d", code, http.StatusUnauthorized)
+			}
+			if loger.Levels()[loger.Syncer] != levels[loger.Syncer] {
+				t.Fatalf("syncer level changed to %s by an unauthorized request", loger.Levels()[loger.Syncer])
+			}
+		})
+	}
+}
+
+func TestLogLevelChangesComponent(t *testing.T) {
+	levels := loger.Levels()
+	t.Cleanup(func() {
+		for component, level := range levels {
+			_ = loger.SetLevel(component, level)
+		}
+	})
+
+	code, response := adminRequest(t, "Bearer s3cret", http.MethodPut, `{"component": "syncer", "level": "trace"}`)
+	if code != http.StatusOK {
+		t.Fatalf("status %d, error %s", code, response.Error)
+	}
+	for component, level := range response.Levels {
+		expected := levels[component]
+		if component == loger.Syncer {
+			expected = "trace"
+		}
+		if level != expected {
+			t.Errorf("%s level is %s, expected %s", component, level, expected)
+		}
+	}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"unknown component", `{"component": "indexer", "level": "debug"}`},
+		{"unknown level", `{"component": "eth", "level": "verbose"}`},
+		{"invalid body", `debug`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, response := adminRequest(t, "Bearer s3cret", http.MethodPost, test.body)
+			if code != http.StatusBadRequest || response.Error == "" {
+				t.Fatalf("status %d, error %q, expected a bad request", code, response.Error)
+			}
+			if response.Levels[loger.Eth] != levels[loger.Eth] {
+				t.Fatalf("eth level changed to %s", response.Levels[loger.Eth])
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"context"
+	"ethernal/explorer/config"
+	"ethernal/explorer/eth"
+	"ethernal/explorer/health"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+	"github.com/uptrace/bun"
+)
+
+// Start serves the monitoring and admin endpoints on the configured address, until ctx is cancelled.
+func Start(ctx context.Context, config *config.Config, bunDb *bun.DB, connection *eth.BlockchainNodeConnection) {
+	checker := health.NewChecker(bunDb, connection.HTTP, config)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", checker.Liveness)
+	mux.HandleFunc("/readyz", checker.Readiness)
+	// the admin endpoints change the behaviour of the process, they are not served without a token
+	if config.AdminToken != "" {
+		mux.Handle("/admin/log-level", requireToken(config.AdminToken, http.HandlerFunc(logLevel)))
+	}
+
+	server := &http.Server{Addr: config.ServerAddr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+
+	logrus.Info("Monitoring server listening on ", config.ServerAddr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logrus.Error("Monitoring server stopped, err: ", err)
+	}
+}
@@ -0,0 +1,135 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	bundb "github.com/uptrace/bun"
+)
+
+// BlockRange is a range of block numbers, From and To included
+type BlockRange struct {
+	From uint64 `bun:"from"`
+	To   uint64 `bun:"to"`
+}
+
+func (r BlockRange) Len() uint64 {
+	return r.To - r.From + 1
+}
+
+// Numbers returns the block numbers of the range
+func (r BlockRange) Numbers() []uint64 {
+	numbers := make([]uint64, 0, r.Len())
+	for n := r.From; n <= r.To; n++ {
+		numbers = append(numbers, n)
+	}
+	return numbers
+}
+
+func (r BlockRange) String() string {
+	if r.From == r.To {
+		return fmt.Sprint(r.From)
+	}
+	return fmt.Sprintf("%d-%d", r.From, r.To)
+}
+
+// maxReportedRanges is how many ranges are named by the error of the blocks which could not be synchronized
+const maxReportedRanges = 10
+
+// notSynchronizedError returns the error naming the ranges of the blocks which could not be synchronized
+func notSynchronizedError(ranges []BlockRange) error {
+	merged := mergeRanges(ranges)
+	names := []string{}
+	for i, r := range merged {
+		if i == maxReportedRanges {
+			names = append(names, fmt.Sprintf("and %d more ranges", len(merged)-i))
+			break
+		}
+		names = append(names, r.String())
+	}
+	return fmt.Errorf("%d blocks not synchronized: %s", blocksCount(merged), strings.Join(names, ", "))
+}
+
+// blocksCount returns the number of blocks in the ranges
+func blocksCount(ranges []BlockRange) uint64 {
+	var count uint64
+	for _, r := range ranges {
+		count += r.Len()
+	}
+	return count
+}
+
+// findGaps returns the ranges of blocks between from and to (inclusive) which are missing in the database, in ascending order.
+// The gaps are computed by the database from the neighbouring stored blocks, so the memory used does not depend on the number of stored blocks.
+func findGaps(ctx context.Context, db *bundb.DB, from uint64, to uint64) ([]BlockRange, error) {
+	gaps := []BlockRange{}
+	if to < from {
+		return gaps, nil
+	}
+	// the blocks just outside the range bound the gaps at its start and at its end
+	err := db.NewRaw(`
+		SELECT number + 1 AS "from", next_number - 1 AS "to"
+		FROM (
+			SELECT number, LEAD(number) OVER (ORDER BY number) AS next_number
+			FROM (
+				SELECT ?::bigint - 1 AS number
+				UNION ALL
+				SELECT number FROM blocks WHERE number BETWEEN ? AND ?
+				UNION ALL
+				SELECT ?::bigint + 1
+			) AS numbers
+		) AS neighbours
+		WHERE next_number > number + 1
+		ORDER BY number`,
+		from, from, to, to).Scan(ctx, &gaps)
+	return gaps, err
+}
+
+// mergeRanges sorts the ranges and merges the overlapping and adjacent ones
+func mergeRanges(ranges []BlockRange) []BlockRange {
+	sorted := append([]BlockRange{}, ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].From < sorted[j].From })
+
+	merged := []BlockRange{}
+	for _, r := range sorted {
+		if last := len(merged) - 1; last >= 0 && r.From <= merged[last].To+1 {
+			if r.To > merged[last].To {
+				merged[last].To = r.To
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// splitRanges calls fn with the consecutive parts of the ranges of at most step blocks, in block order, until fn returns false.
+// The parts are produced one at a time, so the ranges can cover any number of blocks.
+func splitRanges(ranges []BlockRange, step uint, fn func(BlockRange) bool) {
+	for _, r := range ranges {
+		for from := r.From; from <= r.To; {
+			to := r.To
+			if r.To-from >= uint64(step) {
+				to = from + uint64(step) - 1
+			}
+			if !fn(BlockRange{From: from, To: to}) {
+				return
+			}
+			if to == r.To {
+				break
+			}
+			from = to + 1
+		}
+	}
+}
+
+// batchesCount returns the number of parts splitRanges produces
+func batchesCount(ranges []BlockRange, step uint) uint64 {
+	var count uint64
+	for _, r := range ranges {
+		count += (r.Len() + uint64(step) - 1) / uint64(step)
+	}
+	return count
+}
@@ -0,0 +1,128 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"ethernal/explorer/config"
+	"ethernal/explorer/workers"
+)
+
+// errOutOfOrder is the error of a commit whose first block is above the contiguous watermark, i.e. an earlier batch has not been committed
+var errOutOfOrder = errors.New("batch is above the contiguous watermark")
+
+// reorderBuffer passes the decoded batches on in block order. A batch waits in the buffer until every batch before it has been passed on.
+// The feeding acquires a slot for every batch, which is released once the batch leaves the buffer or fails, so the number of waiting batches is bounded.
+// After a failed batch no later batch is passed on, their blocks are rescheduled instead.
+type reorderBuffer struct {
+	slots       chan struct{}
+	failures    chan int
+	stopFeeding context.CancelFunc
+	reschedule  func(*batch)
+}
+
+// orderedWindow is the number of batches which can be in the pipeline before the commit, enough to keep every stage busy
+func orderedWindow(config *config.Config) uint {
+	return 2*config.WorkersCount + config.DecodeWorkersCount + 3*config.PipelineBuffer + 1
+}
+
+func newReorderBuffer(window uint, stopFeeding context.CancelFunc, reschedule func(*batch)) *reorderBuffer {
+	return &reorderBuffer{
+		slots: make(chan struct{}, window),
+		// every batch fails at most once and a slot is held until its failure is received, so sending never blocks
+		failures:    make(chan int, window),
+		stopFeeding: stopFeeding,
+		reschedule:  reschedule,
+	}
+}
+
+// acquire waits for a free slot, it returns false if ctx is cancelled first
+func (r *reorderBuffer) acquire(ctx context.Context) bool {
+	select {
+	case r.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (r *reorderBuffer) release() {
+	<-r.slots
+}
+
+// notifyFailure wraps the failure callback of the stages, so that the buffer learns which batches will never arrive
+func (r *reorderBuffer) notifyFailure(onFailure func(workers.Result[*batch, *batch])) func(workers.Result[*batch, *batch]) {
+	return func(result workers.Result[*batch, *batch]) {
+		onFailure(result)
+		r.failures <- result.Args.index
+	}
+}
+
+// run passes the batches from in on in block order, the returned channel is closed once in is closed or ctx is cancelled.
+func (r *reorderBuffer) run(ctx context.Context, in <-chan *batch) <-chan *batch {
+	out := make(chan *batch)
+	go func() {
+		defer close(out)
+		pending := map[int]*batch{}
+		failed := map[int]bool{}
+		next := 0
+		stopped := false
+		stop := func() {
+			if !stopped {
+				stopped = true
+				r.stopFeeding()
+				logger.WithField("batch", next).Warn("Stopped ordered commits after a failed batch")
+			}
+		}
+		skip := func(b *batch) {
+			r.reschedule(b)
+			r.release()
+		}
+
+		for {
+			select {
+			case b, ok := <-in:
+				if !ok {
+					// the batches after a missing one cannot be committed
+					for _, b := range pending {
+						skip(b)
+					}
+					return
+				}
+				if stopped {
+					skip(b)
+					continue
+				}
+				pending[b.index] = b
+			case index := <-r.failures:
+				if index < next {
+					// the commit of a batch passed on has failed, the later ones would fail with errOutOfOrder
+					stop()
+					continue
+				}
+				r.release()
+				failed[index] = true
+			}
+
+			for !stopped {
+				if failed[next] {
+					stop()
+					break
+				}
+				b, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				next++
+				select {
+				case out <- b:
+					r.release()
+				case <-ctx.Done():
+					skip(b)
+					stop()
+				}
+			}
+		}
+	}()
+	return out
+}
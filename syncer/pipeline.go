@@ -0,0 +1,250 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"ethernal/explorer/config"
+	"ethernal/explorer/db"
+	"ethernal/explorer/eth"
+	"ethernal/explorer/metrics"
+	"ethernal/explorer/tracing"
+	"ethernal/explorer/workers"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// batch is a range of blocks flowing through the pipeline, with the data collected by the stages
+type batch struct {
+	// blocks is the range of the batch, the numbers of its blocks are in args
+	blocks       BlockRange
+	args         JobArgs
+	fetched      []*eth.Block
+	transactions []*eth.Transaction
+	receipts     []*eth.TransactionReceipt
+	result       JobResult
+	// index is the position of the batch in block order
+	index int
+	// watermark is the block the contiguous watermark moves to when the batch is committed, -1 if it is not maintained
+	watermark int64
+}
+
+// rpcRetryPolicy retries the stages failing on RPC errors, e.g. timeouts or rate limits of the node
+var rpcRetryPolicy = workers.RetryPolicy{
+	MaxAttempts: 3,
+	Backoff:     time.Second,
+	MaxBackoff:  10 * time.Second,
+	Retryable: func(err error) bool {
+		return !errors.Is(err, context.Canceled)
+	},
+}
+
+// commitRetryPolicy retries a failed commit once, e.g. after a lost database connection
+var commitRetryPolicy = workers.RetryPolicy{
+	MaxAttempts: 2,
+	Backoff:     time.Second,
+	Retryable: func(err error) bool {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, errOutOfOrder)
+	},
+}
+
+// rescheduleRounds is how many times the blocks of failed batches are synchronized again in the same run
+const rescheduleRounds = 2
+
+// runPipeline synchronizes the ranges in batches of step blocks through the block fetch, transaction fetch, decode and persist stages
+// and returns the ranges of the failed batches in ascending order. The batches are created as the pipeline takes them,
+// and the stages are connected by bounded channels, so slow commits throttle the fetching and the memory used does not depend on the size of the ranges.
+// If orderedEnd is set the batches are committed one by one in block order and move the contiguous watermark up to orderedEnd,
+// and the batches after a failed one are not committed.
+// No new batches are started after ctx is cancelled, while workCtx bounds the batches in progress.
+func runPipeline(ctx context.Context, workCtx context.Context, config *config.Config, ranges []BlockRange, step uint, args JobArgs, orderedEnd uint64) []BlockRange {
+	ordered := orderedEnd != 0
+	var lock sync.Mutex
+	failed := []BlockRange{}
+	reschedule := func(b *batch) {
+		lock.Lock()
+		failed = append(failed, b.blocks)
+		lock.Unlock()
+	}
+	onFailure := func(result workers.Result[*batch, *batch]) {
+		metrics.FailedJobs.Inc()
+		logger.WithField("job", result.JobId).WithField("attempts", result.Attempts).WithFields(blockRangeFields(result.Args.args.BlockNumbers)).WithError(result.Err).Error("Batch failed")
+		reschedule(result.Args)
+	}
+
+	feedCtx, stopFeeding := context.WithCancel(ctx)
+	defer stopFeeding()
+	var reorder *reorderBuffer
+	if ordered {
+		reorder = newReorderBuffer(orderedWindow(config), stopFeeding, reschedule)
+		onFailure = reorder.notifyFailure(onFailure)
+	}
+
+	logger.WithField("batches", batchesCount(ranges, step)).Info("Batches created")
+	input := make(chan *batch)
+	go func() {
+		defer close(input)
+		send := func(b *batch) bool {
+			if reorder != nil && !reorder.acquire(feedCtx) {
+				return false
+			}
+			select {
+			case input <- b:
+				return true
+			case <-feedCtx.Done():
+				logger.WithField("batch", b.index).Info("Stopped generating batches")
+				return false
+			}
+		}
+
+		// a batch is sent once the next one is known, which is where its watermark ends
+		var previous *batch
+		index := 0
+		splitRanges(ranges, step, func(blocks BlockRange) bool {
+			b := newBatch(blocks, index, args)
+			index++
+			if previous != nil {
+				if ordered {
+					previous.watermark = int64(blocks.From) - 1
+				}
+				if !send(previous) {
+					return false
+				}
+			}
+			previous = b
+			return true
+		})
+		if previous != nil && feedCtx.Err() == nil {
+			if ordered {
+				previous.watermark = int64(orderedEnd)
+			}
+			send(previous)
+		}
+	}()
+
+	stages := []workers.Stage[*batch]{
+		{Name: "fetch_blocks", Workers: config.WorkersCount, Buffer: config.PipelineBuffer, Fn: fetchBlocks, Retry: rpcRetryPolicy},
+		{Name: "fetch_transactions", Workers: config.WorkersCount, Buffer: config.PipelineBuffer, Fn: fetchTransactions, Retry: rpcRetryPolicy},
+		{Name: "decode", Workers: config.DecodeWorkersCount, Buffer: config.PipelineBuffer, Fn: decode},
+	}
+	persistStage := workers.Stage[*batch]{Name: "persist", Workers: config.PersistWorkersCount, Fn: persist, Retry: commitRetryPolicy}
+	if ordered {
+		// a single worker commits the batches in the order of the reorder buffer
+		persistStage.Workers = 1
+	}
+
+	var output <-chan *batch = input
+	for _, stage := range stages {
+		output = stage.Run(workCtx, output, onFailure)
+	}
+	if reorder != nil {
+		output = reorder.run(workCtx, output)
+	}
+	for range persistStage.Run(workCtx, output, onFailure) {
+	}
+
+	return mergeRanges(failed)
+}
+
+// newBatch creates the batch of the blocks, with the settings of args
+func newBatch(blocks BlockRange, index int, args JobArgs) *batch {
+	args.BlockNumbers = blocks.Numbers()
+	return &batch{blocks: blocks, args: args, index: index, watermark: -1}
+}
+
+func fetchBlocks(ctx context.Context, b *batch) (*batch, error) {
+	blocks, err := GetBlocks(b.args, ctx)
+	if err != nil {
+		return nil, err
+	}
+	b.fetched = blocks
+	return b, nil
+}
+
+func fetchTransactions(ctx context.Context, b *batch) (*batch, error) {
+	transactions, receipts, err := GetTransactions(b.fetched, b.args, ctx)
+	if err != nil {
+		return nil, err
+	}
+	b.transactions = transactions
+	b.receipts = receipts
+	return b, nil
+}
+
+// decode converts the fetched blocks, transactions and receipts into the rows of the database
+func decode(ctx context.Context, b *batch) (_ *batch, err error) {
+	_, span := tracing.Start(ctx, "sync.decode", tracing.BlockRange(b.args.BlockNumbers)...)
+	defer func() { tracing.End(span, err) }()
+
+	dbBlocks := make([]*db.Block, len(b.fetched))
+	for i, block := range b.fetched {
+		dbBlocks[i] = eth.CreateDbBlock(block)
+	}
+
+	dbTransactions := make([]*db.Transaction, len(b.transactions))
+	dbLogs := []*db.Log{}
+	dbContracts := []db.Contract{}
+	dbNftTransfers := []*db.NftTransfer{}
+	dbNftTransferRanges := []*db.NftTransferRange{}
+	nftMetadataUpdates := []*eth.NftMetadataUpdate{}
+	dbNftLocks := []*db.NftLock{}
+	dbTokenBoundAccounts := []*db.TokenBoundAccount{}
+
+	for i, t := range b.transactions {
+		receipt := b.receipts[i]
+		dbTransactions[i] = eth.CreateDbTransaction(t, receipt)
+		if receipt.ContractAddress != "" {
+			dbContracts = append(dbContracts, eth.CreateDbContract(receipt))
+		}
+		if b.args.EthLogs {
+			dbLogs = append(dbLogs, eth.CreateDbLog(t, receipt)...)
+			if b.args.NFTs {
+				nftTransfers, err := eth.CreateDbNftTransfers(receipt, b.args.NftConsecutiveMaxTokens)
+				if err != nil {
+					return nil, fmt.Errorf("cannot parse logs of transaction %s: %w", t.Hash, err)
+				}
+				dbNftTransfers = append(dbNftTransfers, nftTransfers...)
+				nftTransferRanges, err := eth.CreateDbNftTransferRanges(receipt, b.args.NftConsecutiveMaxTokens)
+				if err != nil {
+					return nil, fmt.Errorf("cannot parse logs of transaction %s: %w", t.Hash, err)
+				}
+				dbNftTransferRanges = append(dbNftTransferRanges, nftTransferRanges...)
+				nftMetadataUpdates = append(nftMetadataUpdates, eth.CreateNftMetadataUpdates(receipt)...)
+				dbNftLocks = append(dbNftLocks, eth.CreateDbNftLocks(receipt)...)
+				dbTokenBoundAccounts = append(dbTokenBoundAccounts, eth.CreateDbTokenBoundAccounts(receipt)...)
+			}
+		}
+	}
+
+	span.SetAttributes(
+		attribute.Int("transactions.count", len(dbTransactions)),
+		attribute.Int("logs.count", len(dbLogs)),
+		attribute.Int("nft_transfers.count", len(dbNftTransfers)),
+		attribute.Int("contracts.count", len(dbContracts)),
+	)
+
+	b.result = JobResult{
+		Blocks:             dbBlocks,
+		Transactions:       dbTransactions,
+		Logs:               dbLogs,
+		NftTransfers:       dbNftTransfers,
+		NftTransferRanges:  dbNftTransferRanges,
+		NftMetadataUpdates: nftMetadataUpdates,
+		NftLocks:           dbNftLocks,
+		TokenBoundAccounts: dbTokenBoundAccounts,
+		Contracts:          dbContracts,
+	}
+	// the fetched data is not needed anymore
+	b.fetched, b.transactions, b.receipts = nil, nil, nil
+	return b, nil
+}
+
+// persist commits the rows of the batch, with the metadata jobs of the minted and updated NFTs
+func persist(ctx context.Context, b *batch) (*batch, error) {
+	if err := commitJobResult(ctx, b.args.Db, b.result, b.watermark, b.args.NftConsecutiveMaxTokens); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"ethernal/explorer/db"
 	"ethernal/explorer/eth"
+	"ethernal/explorer/metrics"
+	"ethernal/explorer/tracing"
+	"fmt"
 	"math"
 	"math/big"
 	"time"
@@ -12,83 +15,36 @@ import (
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/sirupsen/logrus"
 	"github.com/uptrace/bun"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type JobArgs struct {
-	BlockNumbers         []uint64
-	Client               *rpc.Client
-	Db                   *bun.DB
-	Step                 uint
-	CallTimeoutInSeconds uint
-	EthLogs              bool
-	NFTs                 bool
-	IPFSGateway          string
+	BlockNumbers            []uint64
+	Client                  *rpc.Client
+	Db                      *bun.DB
+	Step                    uint
+	CallTimeoutInSeconds    uint
+	EthLogs                 bool
+	NFTs                    bool
+	NftConsecutiveMaxTokens uint64
 }
 
 type JobResult struct {
-	Blocks       []*db.Block
-	Transactions []*db.Transaction
-	Logs         []*db.Log
-	NftTransfers []*db.NftTransfer
-	Contracts    []db.Contract
+	Blocks             []*db.Block
+	Transactions       []*db.Transaction
+	Logs               []*db.Log
+	NftTransfers       []*db.NftTransfer
+	NftTransferRanges  []*db.NftTransferRange
+	NftMetadataUpdates []*eth.NftMetadataUpdate
+	NftLocks           []*db.NftLock
+	TokenBoundAccounts []*db.TokenBoundAccount
+	Contracts          []db.Contract
 }
 
-var (
-	execFn = func(ctx context.Context, args interface{}) interface{} {
-		jobArgs, ok := args.(JobArgs)
-		if !ok {
-			logrus.Panic("Wrong type for args parameter")
-		}
-
-		blocks := GetBlocks(jobArgs, ctx)
-		if blocks == nil {
-			return nil
-		}
-		transactions, receipts := GetTransactions(blocks, jobArgs, ctx)
-		if transactions == nil || receipts == nil {
-			return nil
-		}
-
-		dbBlocks := make([]*db.Block, len(blocks))
-		for i, b := range blocks {
-			dbBlocks[i] = eth.CreateDbBlock(b)
-		}
-
-		dbTransactions := make([]*db.Transaction, len(transactions))
-		dbLogs := []*db.Log{}
-		dbContracts := []db.Contract{}
-		dbNftTransfers := []*db.NftTransfer{}
+func GetTransactions(blocks []*eth.Block, jobArgs JobArgs, ctx context.Context) ([]*eth.Transaction, []*eth.TransactionReceipt, error) {
+	ctx, span := tracing.Start(ctx, "sync.get_transactions", tracing.BlockRange(jobArgs.BlockNumbers)...)
+	defer span.End()
 
-		for i, t := range transactions {
-			dbTransactions[i] = eth.CreateDbTransaction(t, receipts[i])
-			if receipts[i].ContractAddress != "" {
-				dbContracts = append(dbContracts, eth.CreateDbContract(receipts[i]))
-			}
-			if jobArgs.EthLogs {
-				dbLogs = append(dbLogs, eth.CreateDbLog(t, receipts[i])...)
-				if jobArgs.NFTs {
-					nftTransfers, err := eth.CreateDbNftTransfers(receipts[i])
-					if err != nil {
-						logrus.Error("Error while parsing logs for transaction ", t.Hash, " , err: ", err)
-						return nil
-					}
-					dbNftTransfers = append(dbNftTransfers, nftTransfers...)
-				}
-			}
-		}
-		eth.CreateDbNftMetadata(dbNftTransfers, *jobArgs.Client, jobArgs.CallTimeoutInSeconds, jobArgs.IPFSGateway, jobArgs.Step, jobArgs.Db, ctx)
-
-		return JobResult{
-			Blocks:       dbBlocks,
-			Transactions: dbTransactions,
-			Logs:         dbLogs,
-			NftTransfers: dbNftTransfers,
-			Contracts:    dbContracts,
-		}
-	}
-)
-
-func GetTransactions(blocks []*eth.Block, jobArgs JobArgs, ctx context.Context) ([]*eth.Transaction, []*eth.TransactionReceipt) {
 	transactions := []*eth.Transaction{}
 	receipts := []*eth.TransactionReceipt{}
 	var elems []rpc.BatchElem
@@ -120,6 +76,8 @@ func GetTransactions(blocks []*eth.Block, jobArgs JobArgs, ctx context.Context)
 		}
 	}
 
+	span.SetAttributes(attribute.Int("transactions.count", len(transactions)))
+
 	step := jobArgs.Step
 	if len(elems) != 0 {
 		totalCounter := uint(math.Ceil(float64(len(elems)) / float64(step)))
@@ -130,25 +88,26 @@ func GetTransactions(blocks []*eth.Block, jobArgs JobArgs, ctx context.Context)
 			to := int(math.Min(float64(len(elems)), float64((i+1)*step)))
 
 			elemSlice := elems[from:to]
-			ioErr := batchCallWithTimeout(&elemSlice, *jobArgs.Client, jobArgs.CallTimeoutInSeconds, ctx)
+			ioErr := batchCallWithTimeout(&elemSlice, jobArgs.Client, jobArgs.CallTimeoutInSeconds, ctx)
 			if ioErr != nil {
-				logrus.Error("Cannot get transactions from blockchain, err: ", ioErr)
-				return nil, nil
+				return nil, nil, fmt.Errorf("cannot get transactions from blockchain: %w", ioErr)
 			}
 
 			for _, e := range elemSlice {
 				if e.Error != nil {
-					logrus.Error("Error during batch call, err: ", e.Error.Error())
-					return nil, nil
+					return nil, nil, fmt.Errorf("error during batch call %s: %w", e.Method, e.Error)
 				}
 			}
 		}
 	}
 
-	return transactions, receipts
+	return transactions, receipts, nil
 }
 
-func GetBlocks(jobArgs JobArgs, ctx context.Context) []*eth.Block {
+func GetBlocks(jobArgs JobArgs, ctx context.Context) ([]*eth.Block, error) {
+	ctx, span := tracing.Start(ctx, "sync.get_blocks", tracing.BlockRange(jobArgs.BlockNumbers)...)
+	defer span.End()
+
 	blocks := []*eth.Block{}
 	elems := make([]rpc.BatchElem, 0, len(jobArgs.BlockNumbers))
 
@@ -164,24 +123,51 @@ func GetBlocks(jobArgs JobArgs, ctx context.Context) []*eth.Block {
 		blocks = append(blocks, block)
 	}
 
-	ioErr := batchCallWithTimeout(&elems, *jobArgs.Client, jobArgs.CallTimeoutInSeconds, ctx)
+	ioErr := batchCallWithTimeout(&elems, jobArgs.Client, jobArgs.CallTimeoutInSeconds, ctx)
 	if ioErr != nil {
-		logrus.Error("Cannot get blocks from blockchain, err: ", ioErr)
-		return nil
+		return nil, fmt.Errorf("cannot get blocks from blockchain: %w", ioErr)
 	}
 
 	for _, e := range elems {
 		if e.Error != nil {
-			logrus.Error("Error during batch call, err: ", e.Error.Error())
-			return nil
+			return nil, fmt.Errorf("error during batch call %s: %w", e.Method, e.Error)
 		}
 	}
 
-	return blocks
+	return blocks, nil
 }
 
-func batchCallWithTimeout(elems *[]rpc.BatchElem, client rpc.Client, callTimeoutInSeconds uint, ctx context.Context) error {
+func batchCallWithTimeout(elems *[]rpc.BatchElem, client *rpc.Client, callTimeoutInSeconds uint, ctx context.Context) error {
 	ctxWithTimeout, cancel := context.WithTimeout(ctx, time.Duration(callTimeoutInSeconds)*time.Second)
 	defer cancel()
-	return client.BatchCallContext(ctxWithTimeout, *elems)
+	ctxWithTimeout, span := tracing.Start(ctxWithTimeout, "rpc.batch", tracing.RpcBatch(*elems)...)
+	start := time.Now()
+	err := client.BatchCallContext(ctxWithTimeout, *elems)
+	metrics.ObserveRpcBatch(*elems, start, err)
+	tracing.End(span, tracing.BatchError(*elems, err))
+	return err
+}
+
+// blockRangeFields returns the log fields describing the range of block numbers.
+func blockRangeFields(blockNumbers []uint64) logrus.Fields {
+	if len(blockNumbers) == 0 {
+		return logrus.Fields{"block_count": 0}
+	}
+	return logrus.Fields{
+		"block_from":  blockNumbers[0],
+		"block_to":    blockNumbers[len(blockNumbers)-1],
+		"block_count": len(blockNumbers),
+	}
+}
+
+// rangesFields returns the log fields describing the ranges of block numbers.
+func rangesFields(ranges []BlockRange) logrus.Fields {
+	if len(ranges) == 0 {
+		return logrus.Fields{"block_ranges": 0}
+	}
+	return logrus.Fields{
+		"block_from":   ranges[0].From,
+		"block_to":     ranges[len(ranges)-1].To,
+		"block_ranges": len(ranges),
+	}
 }
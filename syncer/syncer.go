@@ -7,21 +7,36 @@ import (
 	"ethernal/explorer/config"
 	"ethernal/explorer/db"
 	"ethernal/explorer/eth"
+	"ethernal/explorer/health"
+	"ethernal/explorer/loger"
+	"ethernal/explorer/metrics"
+	"ethernal/explorer/tracing"
 	"ethernal/explorer/utils"
-	"ethernal/explorer/workers"
+	"ethernal/explorer/webhooks"
+	"fmt"
 	"math"
-	"sync"
+	"sort"
 	"time"
 
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/sirupsen/logrus"
 	bundb "github.com/uptrace/bun"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var logger = loger.Get(loger.Syncer)
+
 // SyncMissingBlocks keeps the database in sync with the blockchain.
-func SyncMissingBlocks(client *rpc.Client, db *bundb.DB, config *config.Config) {
+// When ctx is cancelled no new jobs are started, while the jobs in progress have the shutdown timeout to be executed and inserted.
+func SyncMissingBlocks(ctx context.Context, client *rpc.Client, db *bundb.DB, config *config.Config) {
 	startingAt := time.Now().UTC()
-	logrus.Info("Synchronization started")
+	logger.Info("Synchronization started")
+	// the settings reloaded since the previous run are applied before any job is created
+	config.ApplyReloaded()
+	eth.ConfigureNftMetadata(config)
+	ctx, span := tracing.Start(ctx, "sync.run")
+	defer span.End()
 	// only for automatic mode - when synch is finished send a signal in channel Done
 	if config.Mode == common.Automatic {
 		defer func() {
@@ -30,158 +45,334 @@ func SyncMissingBlocks(client *rpc.Client, db *bundb.DB, config *config.Config)
 		}()
 	}
 
-	ctx, cancel := context.WithCancel(context.TODO())
+	// jobs and inserts in progress get the shutdown timeout to finish after ctx is cancelled
+	workCtx, cancel := utils.WithDrainTimeout(ctx, time.Duration(config.ShutdownTimeout)*time.Second)
 	defer cancel()
+	workCtx = trace.ContextWithSpan(workCtx, span)
+
+	// in ordered commit mode every block up to the contiguous watermark is stored, the gaps are searched only above it
+	from := config.Checkpoint
+	ordered := config.OrderedCommits
+	if ordered {
+		if watermark, err := initWatermark(ctx, db, config.Checkpoint); err != nil {
+			// without a watermark every ordered commit would fail, the blocks of this run are committed as they are fetched
+			logger.WithError(err).Error("Cannot read the contiguous watermark, committing the blocks out of order")
+			ordered = false
+		} else {
+			from = uint64(watermark + 1)
+		}
+	}
 
-	wp := workers.New(config.WorkersCount)
+	missingRanges, latestBlock, err := getMissingBlocks(ctx, client, db, config.CallTimeoutInSeconds, from)
+	if ctx.Err() != nil {
+		logger.Info("Synchronization stopped")
+		return
+	}
+	if err != nil {
+		logger.WithError(err).Error("Cannot find the missing blocks in DB")
+		return
+	}
+	missingBlocks := blocksCount(missingRanges)
+	logger.WithField("missing_blocks", missingBlocks).WithField("missing_ranges", len(missingRanges)).Info("Missing blocks found")
+	span.SetAttributes(attribute.Int64("missing_blocks.count", int64(missingBlocks)), attribute.Int64("block.latest", int64(latestBlock)))
+	if missingBlocks == 0 {
+		// the blocks above the watermark are already stored
+		if ordered && latestBlock > from {
+			if advanced, err := advanceWatermark(ctx, db, from, latestBlock-1); err != nil {
+				logger.WithError(err).Error("Cannot move the contiguous watermark")
+			} else if advanced {
+				metrics.ContiguousHead.Set(float64(latestBlock - 1))
+			}
+		}
+		return
+	}
+
+	orderedEnd := uint64(0)
+	if ordered {
+		orderedEnd = latestBlock - 1
+	}
+	syncBlocks(ctx, workCtx, client, db, config, missingRanges, orderedEnd)
 
-	missingBlocks, latestBlock := getMissingBlocks(ctx, client, db, config.CallTimeoutInSeconds, config.Checkpoint)
-	logrus.Info("Number of missing blocks: ", len(missingBlocks))
-	if len(missingBlocks) == 0 {
+	if ctx.Err() != nil {
+		logger.WithField("took", time.Now().UTC().Sub(startingAt).String()).Info("Synchronization stopped")
 		return
 	}
 
-	totalCounter := int(math.Ceil(float64(len(missingBlocks)) / float64(config.Step)))
-	counter := 0
+	// set a new checkpoint, if there are enough new blocks since the last checkpoint
+	if config.Mode == common.Automatic {
+		if (latestBlock - config.Checkpoint) > (uint64)(config.CheckpointWindow) {
+			findNewCheckPoint(client, db, workCtx, config, latestBlock)
+		}
+	}
+	logger.WithField("took", time.Now().UTC().Sub(startingAt).String()).Info("Synchronization DONE")
+	metrics.SyncDuration.Observe(metrics.Since(startingAt))
+}
+
+// syncBlocks fetches the blocks of the ranges in batches of step blocks through the pipeline, which commits them.
+// The blocks of failed batches are rescheduled in smaller batches, the ranges which could not be synchronized are returned.
+// If orderedEnd is set, the batches are committed in block order and move the contiguous watermark up to orderedEnd,
+// every block between the ranges and up to orderedEnd has to be stored already.
+// No new jobs are started after ctx is cancelled, while workCtx bounds the jobs and inserts in progress.
+func syncBlocks(ctx context.Context, workCtx context.Context, client *rpc.Client, db *bundb.DB, config *config.Config, ranges []BlockRange, orderedEnd uint64) []BlockRange {
+	args := JobArgs{
+		Client:                  client,
+		Db:                      db,
+		Step:                    config.Step,
+		CallTimeoutInSeconds:    config.CallTimeoutInSeconds,
+		EthLogs:                 config.EthLogs,
+		NFTs:                    config.NFTs,
+		NftConsecutiveMaxTokens: config.NftConsecutiveMaxTokens,
+	}
+	step := config.Step
+	for round := 0; ; round++ {
+		failed := runPipeline(ctx, workCtx, config, ranges, step, args, orderedEnd)
+		if len(failed) == 0 || ctx.Err() != nil || round == rescheduleRounds {
+			if len(failed) != 0 {
+				logger.WithField("failed_blocks", blocksCount(failed)).WithFields(rangesFields(failed)).Error("Blocks not synchronized")
+			}
+			return failed
+		}
+
+		// smaller batches isolate the blocks which keep failing
+		step = uint(math.Max(float64(step/2), 1))
+		logger.WithFields(logrus.Fields{
+			"failed_blocks": blocksCount(failed),
+			"round":         round + 1,
+			"step":          step,
+		}).Warn("Rescheduling the blocks of failed batches")
+		ranges = failed
+	}
+}
 
-	var wg sync.WaitGroup
+// commitJobResult inserts the rows of the job result, with their webhook deliveries, in one transaction and notifies the observers.
+// If watermark is not negative, the contiguous watermark is moved to it in the same transaction. The transaction fails with errOutOfOrder
+// if the watermark has not reached the first block of the result. maxRangeTokens bounds the tokens of the ConsecutiveTransfer ranges
+// queued by the metadata updates.
+func commitJobResult(ctx context.Context, db *bundb.DB, val JobResult, watermark int64, maxRangeTokens uint64) error {
+	advanced := false
+	// inserting blocks and transactions in one transaction scope
+	commitStartingAt := time.Now()
+	commitCtx, commitSpan := tracing.Start(ctx, "sync.commit", commitAttributes(val)...)
+	err := db.RunInTx(commitCtx, &sql.TxOptions{}, func(ctx context.Context, tx bundb.Tx) error {
+		_, blockError := tx.NewInsert().Model(&val.Blocks).Exec(ctx)
+		if blockError != nil {
+			var numbers []uint64
+			for _, b := range val.Blocks {
+				numbers = append(numbers, b.Number)
+			}
 
-	go wp.GenerateFrom(createJobs(missingBlocks, client, db, config))
-	go wp.Run(ctx, &wg)
+			logger.WithField("blocks", numbers).WithError(blockError).Error("Error during inserting blocks in DB")
+			return blockError
+		}
 
-	for {
-		select {
-		case result, ok := <-wp.Results():
-			if !ok {
-				logrus.Error("err: ", result.Err)
-				continue
+		if len(val.Transactions) != 0 {
+			_, transError := tx.NewInsert().Model(&val.Transactions).Exec(ctx)
+			if transError != nil {
+				logger.WithError(transError).Error("Error during inserting transactions in DB")
+				return transError
 			}
+		}
 
-			counter++
-			val, isOk := result.Value.(JobResult)
-			if !isOk {
-				if counter == totalCounter {
-					wg.Done()
-				}
-				continue
+		if len(val.Contracts) != 0 {
+			_, contractsError := tx.NewInsert().Model(&val.Contracts).Exec(ctx)
+			if contractsError != nil {
+				logger.WithError(contractsError).Error("Error during inserting contracts in DB")
+				return contractsError
 			}
+		}
 
-			// inserting blocks and transactions in one transaction scope
-			_ = db.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bundb.Tx) error {
-				_, blockError := tx.NewInsert().Model(&val.Blocks).Exec(ctx)
-				if blockError != nil {
-					var numbers []uint64
-					for _, b := range val.Blocks {
-						numbers = append(numbers, b.Number)
-					}
-
-					logrus.Error("Error during inserting blocks with numbers ", numbers, " in DB, err: ", blockError)
-					return blockError
-				}
-
-				if len(val.Transactions) != 0 {
-					_, transError := tx.NewInsert().Model(&val.Transactions).Exec(ctx)
-					if transError != nil {
-						logrus.Error("Error during inserting transactions in DB, err: ", transError)
-						return transError
-					}
-				}
-
-				if len(val.Contracts) != 0 {
-					_, contractsError := tx.NewInsert().Model(&val.Contracts).Exec(ctx)
-					if contractsError != nil {
-						logrus.Error("Error during inserting contracts in DB, err: ", contractsError)
-						return contractsError
-					}
-				}
-
-				if len(val.Logs) != 0 {
-					_, logsError := tx.NewInsert().Model(&val.Logs).Exec(ctx)
-					if logsError != nil {
-						logrus.Error("Error during inserting logs in DB, err: ", logsError)
-						return logsError
-					}
-				}
-
-				if len(val.NftTransfers) != 0 {
-					_, nftTransfersError := tx.NewInsert().Model(&val.NftTransfers).Exec(ctx)
-					if nftTransfersError != nil {
-						logrus.Error("Error during inserting nft transfers in DB, err: ", nftTransfersError)
-						return nftTransfersError
-					}
-				}
-
-				return nil
-			})
-
-			if counter == totalCounter {
-				wg.Done()
+		if len(val.Logs) != 0 {
+			_, logsError := tx.NewInsert().Model(&val.Logs).Exec(ctx)
+			if logsError != nil {
+				logger.WithError(logsError).Error("Error during inserting logs in DB")
+				return logsError
 			}
-		case <-wp.Done:
-			// set a new checkpoint, if there are enough new blocks since the last checkpoint
-			if config.Mode == common.Automatic {
-				if (latestBlock - config.Checkpoint) > (uint64)(config.CheckpointWindow) {
-					findNewCheckPoint(client, db, ctx, config, latestBlock)
-				}
+		}
+
+		if len(val.NftTransfers) != 0 {
+			_, nftTransfersError := tx.NewInsert().Model(&val.NftTransfers).Exec(ctx)
+			if nftTransfersError != nil {
+				logger.WithError(nftTransfersError).Error("Error during inserting nft transfers in DB")
+				return nftTransfersError
+			}
+			if nftMetadataJobsError := eth.EnqueueNftMetadata(ctx, tx, val.NftTransfers); nftMetadataJobsError != nil {
+				logger.WithError(nftMetadataJobsError).Error("Error during inserting nft metadata jobs in DB")
+				return nftMetadataJobsError
 			}
-			logrus.Info("Synchronization DONE")
-			logrus.Info("Took: ", time.Now().UTC().Sub(startingAt))
-			return
+		}
+
+		if len(val.NftTransferRanges) != 0 {
+			_, nftTransferRangesError := tx.NewInsert().Model(&val.NftTransferRanges).Exec(ctx)
+			if nftTransferRangesError != nil {
+				logger.WithError(nftTransferRangesError).Error("Error during inserting nft transfer ranges in DB")
+				return nftTransferRangesError
+			}
+		}
+
+		if nftCollectionsError := eth.UpdateNftCollections(ctx, tx, val.NftTransfers, val.NftTransferRanges); nftCollectionsError != nil {
+			logger.WithError(nftCollectionsError).Error("Error during updating nft collections in DB")
+			return nftCollectionsError
+		}
+
+		if len(val.NftLocks) != 0 {
+			_, nftLocksError := tx.NewInsert().Model(&val.NftLocks).Exec(ctx)
+			if nftLocksError != nil {
+				logger.WithError(nftLocksError).Error("Error during inserting nft locks in DB")
+				return nftLocksError
+			}
+		}
+
+		if len(val.TokenBoundAccounts) != 0 {
+			_, accountsError := tx.NewInsert().Model(&val.TokenBoundAccounts).Exec(ctx)
+			if accountsError != nil {
+				logger.WithError(accountsError).Error("Error during inserting token bound accounts in DB")
+				return accountsError
+			}
+		}
+
+		if len(val.NftMetadataUpdates) != 0 {
+			if nftMetadataUpdatesError := eth.RefreshNftMetadataUpdates(ctx, tx, val.NftMetadataUpdates, maxRangeTokens); nftMetadataUpdatesError != nil {
+				logger.WithError(nftMetadataUpdatesError).Error("Error during queueing updated nft metadata in DB")
+				return nftMetadataUpdatesError
+			}
+		}
+
+		if watermark >= 0 && len(val.Blocks) != 0 {
+			var watermarkError error
+			if advanced, watermarkError = advanceWatermark(ctx, tx, val.Blocks[0].Number, uint64(watermark)); watermarkError != nil {
+				logger.WithError(watermarkError).Error("Error during moving the contiguous watermark in DB")
+				return watermarkError
+			}
+			// committing blocks above a gap would break the contiguous prefix
+			if !advanced {
+				return errOutOfOrder
+			}
+		}
+
+		if webhooksError := webhooks.EnqueueCommitted(ctx, tx, val.Transactions, val.Logs, val.NftTransfers); webhooksError != nil {
+			logger.WithError(webhooksError).Error("Error during queueing webhook deliveries in DB")
+			return webhooksError
+		}
+
+		return nil
+	})
+	tracing.End(commitSpan, err)
+	if err == nil {
+		metrics.DbCommitDuration.Observe(metrics.Since(commitStartingAt))
+		observeCommittedResult(val)
+		if advanced {
+			metrics.ContiguousHead.Set(float64(watermark))
 		}
 	}
+	return err
 }
 
-func createJobs(missingBlocks []uint64, client *rpc.Client, db *bundb.DB, config *config.Config) []workers.Job {
-	step := config.Step
-	jobsCount := uint(math.Ceil(float64(len(missingBlocks)) / float64(step)))
-	jobs := make([]workers.Job, jobsCount)
-	var i uint
-
-	for i = 0; i < jobsCount; i++ {
-
-		end := int(math.Min(float64(len(missingBlocks)), float64((i+1)*step)))
-
-		jobs[i] = workers.Job{
-			ExecFn: execFn,
-			Args: JobArgs{
-				BlockNumbers:         missingBlocks[i*step : end],
-				Client:               client,
-				Db:                   db,
-				Step:                 config.Step,
-				CallTimeoutInSeconds: config.CallTimeoutInSeconds,
-				EthLogs:              config.EthLogs,
-				NFTs:                 config.NFTs,
-				IPFSGateway:          config.IPFSGatewayUrl,
-			},
-		}
+// SyncBlockRange fetches and inserts the blocks between from and to (inclusive) which are missing in the database.
+// It returns an error naming the ranges of the blocks which could not be synchronized.
+func SyncBlockRange(ctx context.Context, client *rpc.Client, db *bundb.DB, config *config.Config, from uint64, to uint64) error {
+	startingAt := time.Now().UTC()
+	ctx, span := tracing.Start(ctx, "sync.range", tracing.BlockRange([]uint64{from, to})...)
+	defer span.End()
+
+	workCtx, cancel := utils.WithDrainTimeout(ctx, time.Duration(config.ShutdownTimeout)*time.Second)
+	defer cancel()
+	workCtx = trace.ContextWithSpan(workCtx, span)
+
+	missingRanges, err := findGaps(ctx, db, from, to)
+	if err != nil {
+		logger.WithError(err).Error("Cannot find the missing blocks in DB")
+		return fmt.Errorf("cannot find the missing blocks: %w", err)
+	}
+	missingBlocks := blocksCount(missingRanges)
+	logger.WithFields(logrus.Fields{
+		"block_from":     from,
+		"block_to":       to,
+		"missing_blocks": missingBlocks,
+		"missing_ranges": len(missingRanges),
+	}).Info("Missing blocks found")
+	if missingBlocks == 0 {
+		return nil
 	}
 
-	logrus.Info("The number of created jobs is ", len(jobs))
+	// the range can be above a gap, its blocks are committed as they are fetched
+	if failed := syncBlocks(ctx, workCtx, client, db, config, missingRanges, 0); len(failed) != 0 {
+		return notSynchronizedError(failed)
+	}
+	if ctx.Err() != nil {
+		// the batches which were not started are not reported as failed
+		return ctx.Err()
+	}
+	logger.WithField("took", time.Now().UTC().Sub(startingAt).String()).Info("Synchronization of the range DONE")
+	return nil
+}
 
-	return jobs
+// commitAttributes returns the span attributes describing the rows of the job result.
+func commitAttributes(val JobResult) []attribute.KeyValue {
+	numbers := make([]uint64, len(val.Blocks))
+	for i, b := range val.Blocks {
+		numbers[i] = b.Number
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+	return append(tracing.BlockRange(numbers),
+		attribute.Int("transactions.count", len(val.Transactions)),
+		attribute.Int("logs.count", len(val.Logs)),
+		attribute.Int("nft_transfers.count", len(val.NftTransfers)),
+		attribute.Int("contracts.count", len(val.Contracts)),
+	)
 }
 
-// getMissingBlock returns the numbers of the missing blocks in the database and the number of the latest block on the blockchain.
-func getMissingBlocks(ctx context.Context, client *rpc.Client, db *bundb.DB, callTimeoutInSeconds uint, checkpoint uint64) ([]uint64, uint64) {
-	blockNumberFromChain := getLastBlockFromChain(ctx, client, callTimeoutInSeconds)
-	blockNumbersFromDb := []uint64{}
-	db.NewSelect().Table("blocks").Column("number").Order("number ASC").Where("number >= ?", checkpoint).Scan(ctx, &blockNumbersFromDb)
-	mb := findMissingBlocks(blockNumberFromChain, &blockNumbersFromDb, checkpoint)
+// observeCommittedResult updates the indexing counters and the health state after the result of a job is committed.
+func observeCommittedResult(val JobResult) {
+	metrics.IndexedBlocks.Add(float64(len(val.Blocks)))
+	metrics.IndexedTransactions.Add(float64(len(val.Transactions)))
+	metrics.IndexedLogs.Add(float64(len(val.Logs)))
+	metrics.IndexedNftTransfers.Add(float64(len(val.NftTransfers)))
+	var highestBlock uint64
+	for _, b := range val.Blocks {
+		if b.Number > highestBlock {
+			highestBlock = b.Number
+		}
+	}
+	metrics.ObserveIndexedHead(highestBlock)
+	health.BlocksCommitted(highestBlock)
+}
 
-	return mb, blockNumberFromChain
+// getMissingBlocks returns the ranges of the blocks missing in the database from the given block up to the one before the latest block on the blockchain,
+// and the number of the latest block.
+func getMissingBlocks(ctx context.Context, client *rpc.Client, db *bundb.DB, callTimeoutInSeconds uint, from uint64) ([]BlockRange, uint64, error) {
+	blockNumberFromChain := LatestBlockFromChain(ctx, client, callTimeoutInSeconds)
+	if ctx.Err() != nil || blockNumberFromChain == 0 {
+		return []BlockRange{}, blockNumberFromChain, nil
+	}
+	var highestBlock uint64
+	if err := db.NewSelect().Table("blocks").ColumnExpr("COALESCE(MAX(number), 0)").Scan(ctx, &highestBlock); err != nil {
+		return nil, blockNumberFromChain, err
+	}
+	if highestBlock != 0 {
+		metrics.SetIndexedHead(highestBlock)
+	}
+	gaps, err := findGaps(ctx, db, from, blockNumberFromChain-1)
+	return gaps, blockNumberFromChain, err
 }
 
-func getLastBlockFromChain(ctx context.Context, client *rpc.Client, callTimeoutInSeconds uint) uint64 {
+// LatestBlockFromChain returns the number of the latest block on the blockchain, retrying until it succeeds or ctx is cancelled.
+func LatestBlockFromChain(ctx context.Context, client *rpc.Client, callTimeoutInSeconds uint) uint64 {
 	var latestBlock uint64 = 0
-	for {
+	for ctx.Err() == nil {
 		block, err := getLatestBlockFromChainWithTimeout(ctx, client, callTimeoutInSeconds)
 		if err != nil {
-			logrus.Error("Cannot get the latest block, err: ", err)
+			logger.WithField("rpc_method", "eth_getBlockByNumber").WithError(err).Error("Cannot get the latest block")
+			select {
+			case <-time.After(2 * time.Second):
+			case <-ctx.Done():
+			}
 			continue
 		}
 		if block.Number != "" {
 			latestBlock = utils.ToUint64(block.Number)
-			logrus.Info("The number of latest block on node is ", latestBlock)
+			logger.WithField("block", latestBlock).Info("Latest block on node")
+			metrics.SetChainHead(latestBlock)
 			break
 		}
 	}
@@ -192,42 +383,17 @@ func getLatestBlockFromChainWithTimeout(ctx context.Context, client *rpc.Client,
 	block := eth.Block{}
 	ctxWithTimeout, cancel := context.WithTimeout(ctx, time.Duration(callTimeoutInSeconds)*time.Second)
 	defer cancel()
+	start := time.Now()
 	err := client.CallContext(ctxWithTimeout, &block, "eth_getBlockByNumber", "latest", false)
+	metrics.ObserveRpcCall("eth_getBlockByNumber", start, err)
 	return block, err
 }
 
-// findMissingBlock determines the missing blocks in the database and returns their numbers.
-func findMissingBlocks(blockNumberFromChain uint64, blockNumbersFromDb *[]uint64, checkpoint uint64) []uint64 {
-	missingBlocks := []uint64{}
-
-	var i uint64
-	if len(*blockNumbersFromDb) == 0 {
-		for i = checkpoint; i <= blockNumberFromChain-1; i++ {
-			missingBlocks = append(missingBlocks, i)
-		}
-		return missingBlocks
-	}
-
-	// check if any block is missing until the last block in the database
-	counter := 0
-	for i = checkpoint; i <= (*blockNumbersFromDb)[len(*blockNumbersFromDb)-1]; i++ {
-		if i < (*blockNumbersFromDb)[counter] {
-			missingBlocks = append(missingBlocks, i)
-		} else {
-			counter++
-		}
-	}
-
-	for i = (*blockNumbersFromDb)[len(*blockNumbersFromDb)-1] + 1; i <= blockNumberFromChain-1; i++ {
-		missingBlocks = append(missingBlocks, i)
-	}
-
-	return missingBlocks
-}
-
 // findNewCheckPoint determines the new checkpoint - starting block for the next synch.
 func findNewCheckPoint(client *rpc.Client, database *bundb.DB, ctx context.Context, config *config.Config, latestBlock uint64) {
 	startingAt := time.Now().UTC()
+	ctx, span := tracing.Start(ctx, "sync.find_checkpoint", attribute.Int64("checkpoint", int64(config.Checkpoint)))
+	defer span.End()
 	maxBlock := latestBlock - uint64(config.CheckpointDistance)
 	blocksFromDb := []db.Block{}
 	// fetch numbers and hashes of the specified number of blocks
@@ -250,8 +416,9 @@ func findNewCheckPoint(client *rpc.Client, database *bundb.DB, ctx context.Conte
 		CallTimeoutInSeconds: config.CallTimeoutInSeconds,
 	}
 	// fetch specified blocks from the blockchain
-	blocksFromBlockchain := GetBlocks(jobArgs, ctx)
-	if blocksFromBlockchain == nil {
+	blocksFromBlockchain, err := GetBlocks(jobArgs, ctx)
+	if err != nil {
+		logger.WithFields(blockRangeFields(blockNumbers)).WithError(err).Error("Cannot validate the blocks after the checkpoint")
 		return
 	}
 
@@ -265,55 +432,15 @@ func findNewCheckPoint(client *rpc.Client, database *bundb.DB, ctx context.Conte
 	}
 
 	if len(blocksToDelete) != 0 {
-		logrus.Info("Deleting blocks: ", blocksToDelete)
 		startDeletingAt := time.Now().UTC()
-		addressesToDelete := []string{}
-		database.NewSelect().Table("transactions").ColumnExpr("contract_address").Where("block_hash IN (?)", bundb.In(blocksToDelete)).Where("contract_address != ''").Scan(ctx, &addressesToDelete)
-
-		// deleting from database in one transaction scope
-		_ = database.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bundb.Tx) error {
-			if len(addressesToDelete) != 0 {
-				_, abiError := tx.NewDelete().Table("abis").Where("address IN (?)", bundb.In(addressesToDelete)).Exec(ctx)
-				if abiError != nil {
-					logrus.Error("Error during deleting abis from DB, err: ", abiError)
-					return abiError
-				}
-
-				_, contractError := tx.NewDelete().Table("contracts").Where("address IN (?)", bundb.In(addressesToDelete)).Exec(ctx)
-				if contractError != nil {
-					logrus.Error("Error during deleting contracts from DB, err: ", contractError)
-					return contractError
-				}
-
-			}
-			_, nftError := tx.NewDelete().Table("nfts").Where("block_hash IN (?)", bundb.In(blocksToDelete)).Exec(ctx)
-			if nftError != nil {
-				logrus.Error("Error during deleting nfts from DB, err: ", nftError)
-				return nftError
-			}
-
-			_, logError := tx.NewDelete().Table("logs").Where("block_hash IN (?)", bundb.In(blocksToDelete)).Exec(ctx)
-			if logError != nil {
-				logrus.Error("Error during deleting logs from DB, err: ", logError)
-				return logError
-			}
-
-			_, transError := tx.NewDelete().Table("transactions").Where("block_hash IN (?)", bundb.In(blocksToDelete)).Exec(ctx)
-			if transError != nil {
-				logrus.Error("Error during deleting transactions from DB, err: ", transError)
-				return transError
-			}
-
-			_, blockError := tx.NewDelete().Table("blocks").Where("hash IN (?)", bundb.In(blocksToDelete)).Exec(ctx)
-			if blockError != nil {
-				logrus.Error("Error during deleting blocks from DB, err: ", blockError)
-				return blockError
-			}
-
-			return nil
-		})
-		logrus.Info("Deleting took: ", time.Now().UTC().Sub(startDeletingAt))
-		logrus.Info("Validation took: ", time.Now().UTC().Sub(startingAt))
+		if err := DeleteBlocks(ctx, database, blocksToDelete); err == nil {
+			metrics.Reorgs.Inc()
+			metrics.ReorgedBlocks.Add(float64(len(blocksToDelete)))
+		}
+		logger.WithFields(logrus.Fields{
+			"deleting_took":   time.Now().UTC().Sub(startDeletingAt).String(),
+			"validation_took": time.Now().UTC().Sub(startingAt).String(),
+		}).Info("Blocks deleted")
 		return
 	}
 
@@ -322,8 +449,10 @@ func findNewCheckPoint(client *rpc.Client, database *bundb.DB, ctx context.Conte
 	for i = config.Checkpoint; i <= (blockNumbers)[len(blockNumbers)-1]; i++ {
 		if i < (blockNumbers)[counter] {
 			config.Checkpoint = i
-			logrus.Info("Checkpoint: ", config.Checkpoint)
-			logrus.Info("Validation took: ", time.Now().UTC().Sub(startingAt))
+			logger.WithFields(logrus.Fields{
+				"checkpoint":      config.Checkpoint,
+				"validation_took": time.Now().UTC().Sub(startingAt).String(),
+			}).Info("Checkpoint moved")
 			return
 		} else {
 			counter++
@@ -331,6 +460,94 @@ func findNewCheckPoint(client *rpc.Client, database *bundb.DB, ctx context.Conte
 	}
 
 	config.Checkpoint = (blockNumbers)[len(blockNumbers)-1]
-	logrus.Info("Checkpoint: ", config.Checkpoint)
-	logrus.Info("Validation took: ", time.Now().UTC().Sub(startingAt))
+	logger.WithFields(logrus.Fields{
+		"checkpoint":      config.Checkpoint,
+		"validation_took": time.Now().UTC().Sub(startingAt).String(),
+	}).Info("Checkpoint moved")
+}
+
+// DeleteBlocks deletes the blocks with the given hashes together with their transactions, logs, NFT transfers and transfer ranges, NFT locks, token bound accounts and contracts.
+// The deleted NFT transfers and transfer ranges are removed from the counters of their collections, and the deleted rows are queued to the watches they match.
+func DeleteBlocks(ctx context.Context, bunDb *bundb.DB, blockHashes []string) error {
+	logger.WithField("blocks", blockHashes).Info("Deleting blocks")
+	addressesToDelete := []string{}
+	bunDb.NewSelect().Table("transactions").ColumnExpr("contract_address").Where("block_hash IN (?)", bundb.In(blockHashes)).Where("contract_address != ''").Scan(ctx, &addressesToDelete)
+
+	// deleting from database in one transaction scope
+	err := bunDb.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bundb.Tx) error {
+		if err := lowerWatermark(ctx, tx, blockHashes); err != nil {
+			logger.WithError(err).Error("Error during lowering the contiguous watermark in DB")
+			return err
+		}
+
+		// the deleted rows are reported to the watches after the deliveries of their commit
+		if err := webhooks.EnqueueRemoved(ctx, tx, blockHashes); err != nil {
+			logger.WithError(err).Error("Error during queueing webhook deliveries in DB")
+			return err
+		}
+
+		if len(addressesToDelete) != 0 {
+			_, abiError := tx.NewDelete().Table("abis").Where("address IN (?)", bundb.In(addressesToDelete)).Exec(ctx)
+			if abiError != nil {
+				logger.WithError(abiError).Error("Error during deleting abis from DB")
+				return abiError
+			}
+
+			_, contractError := tx.NewDelete().Table("contracts").Where("address IN (?)", bundb.In(addressesToDelete)).Exec(ctx)
+			if contractError != nil {
+				logger.WithError(contractError).Error("Error during deleting contracts from DB")
+				return contractError
+			}
+
+		}
+		deletedNfts := []*db.NftTransfer{}
+		_, nftError := tx.NewDelete().Table("nft_transfers").Where("block_hash IN (?)", bundb.In(blockHashes)).Returning("*").Exec(ctx, &deletedNfts)
+		if nftError != nil {
+			logger.WithError(nftError).Error("Error during deleting nfts from DB")
+			return nftError
+		}
+		deletedRanges := []*db.NftTransferRange{}
+		_, nftRangeError := tx.NewDelete().Table("nft_transfer_ranges").Where("block_hash IN (?)", bundb.In(blockHashes)).Returning("*").Exec(ctx, &deletedRanges)
+		if nftRangeError != nil {
+			logger.WithError(nftRangeError).Error("Error during deleting nft transfer ranges from DB")
+			return nftRangeError
+		}
+		if nftCollectionsError := eth.RevertNftCollections(ctx, tx, deletedNfts, deletedRanges); nftCollectionsError != nil {
+			logger.WithError(nftCollectionsError).Error("Error during reverting nft collections in DB")
+			return nftCollectionsError
+		}
+
+		_, nftLockError := tx.NewDelete().Table("nft_locks").Where("block_hash IN (?)", bundb.In(blockHashes)).Exec(ctx)
+		if nftLockError != nil {
+			logger.WithError(nftLockError).Error("Error during deleting nft locks from DB")
+			return nftLockError
+		}
+
+		_, accountError := tx.NewDelete().Table("token_bound_accounts").Where("block_hash IN (?)", bundb.In(blockHashes)).Exec(ctx)
+		if accountError != nil {
+			logger.WithError(accountError).Error("Error during deleting token bound accounts from DB")
+			return accountError
+		}
+
+		_, logError := tx.NewDelete().Table("logs").Where("block_hash IN (?)", bundb.In(blockHashes)).Exec(ctx)
+		if logError != nil {
+			logger.WithError(logError).Error("Error during deleting logs from DB")
+			return logError
+		}
+
+		_, transError := tx.NewDelete().Table("transactions").Where("block_hash IN (?)", bundb.In(blockHashes)).Exec(ctx)
+		if transError != nil {
+			logger.WithError(transError).Error("Error during deleting transactions from DB")
+			return transError
+		}
+
+		_, blockError := tx.NewDelete().Table("blocks").Where("hash IN (?)", bundb.In(blockHashes)).Exec(ctx)
+		if blockError != nil {
+			logger.WithError(blockError).Error("Error during deleting blocks from DB")
+			return blockError
+		}
+
+		return nil
+	})
+	return err
 }
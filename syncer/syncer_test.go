@@ -0,0 +1,660 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"ethernal/explorer/common"
+	"ethernal/explorer/config"
+	"ethernal/explorer/db"
+	"ethernal/explorer/db/dbtest"
+	"ethernal/explorer/eth"
+	"ethernal/explorer/mocknode"
+	"ethernal/explorer/workers"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	bundb "github.com/uptrace/bun"
+)
+
+const (
+	nftContract = "0x1000000000000000000000000000000000000001"
+	alice       = "0x2000000000000000000000000000000000000002"
+	bob         = "0x3000000000000000000000000000000000000003"
+)
+
+func newTestConfig() *config.Config {
+	return &config.Config{
+		Mode:                    common.Manual,
+		WorkersCount:            4,
+		Step:                    5,
+		CallTimeoutInSeconds:    5,
+		Checkpoint:              1,
+		CheckpointWindow:        250,
+		CheckpointDistance:      2,
+		ShutdownTimeout:         5,
+		NftMetadataWorkersCount: 2,
+		NftMetadataMaxAttempts:  3,
+		NftMetadataMaxSizeInKB:  64,
+		NftMetadataRedirects:    5,
+		NftMetadataHostRequests: 4,
+		// the metadata is served by the mock node on the loopback address
+		NftMetadataAllowPrivate: true,
+		NftConsecutiveMaxTokens: 100,
+	}
+}
+
+// newNftTestConfig returns the test configuration indexing the logs and the NFTs
+func newNftTestConfig() *config.Config {
+	cfg := newTestConfig()
+	cfg.EthLogs = true
+	cfg.NFTs = true
+	return cfg
+}
+
+func startNode(t *testing.T, chain *mocknode.Chain) (*mocknode.Node, *rpc.Client) {
+	t.Helper()
+	node := mocknode.New(chain)
+	client, err := rpc.Dial(node.HTTPUrl())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		node.Close()
+	})
+	return node, client
+}
+
+// startNftMetadataQueue runs the NFT metadata queue until the end of the test
+func startNftMetadataQueue(t *testing.T, database *bundb.DB, client *rpc.Client, cfg *config.Config) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	queue := eth.NewNftMetadataQueue(database, client, cfg)
+	go func() {
+		queue.Run(ctx, 5*time.Second)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// storedHashes returns the block hashes in the database by block number
+func storedHashes(t *testing.T, database *bundb.DB) map[uint64]string {
+	t.Helper()
+	blocks := []db.Block{}
+	if err := database.NewSelect().Model(&blocks).Column("number", "hash").Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	hashes := map[uint64]string{}
+	for _, block := range blocks {
+		hashes[block.Number] = block.Hash
+	}
+	return hashes
+}
+
+func TestSplitRanges(t *testing.T) {
+	parts := []BlockRange{}
+	splitRanges([]BlockRange{{From: 1, To: 2}, {From: 5, To: 11}}, 3, func(r BlockRange) bool {
+		parts = append(parts, r)
+		return true
+	})
+	expected := []BlockRange{{1, 2}, {5, 7}, {8, 10}, {11, 11}}
+	if len(parts) != len(expected) {
+		t.Fatalf("parts %v, expected %v", parts, expected)
+	}
+	for i := range expected {
+		if parts[i] != expected[i] {
+			t.Fatalf("parts %v, expected %v", parts, expected)
+		}
+	}
+	if count := batchesCount([]BlockRange{{From: 1, To: 2}, {From: 5, To: 11}}, 3); count != uint64(len(expected)) {
+		t.Fatalf("%d batches counted, expected %d", count, len(expected))
+	}
+}
+
+func TestMergeRanges(t *testing.T) {
+	merged := mergeRanges([]BlockRange{{8, 9}, {1, 3}, {4, 5}, {2, 2}, {11, 12}})
+	expected := []BlockRange{{1, 5}, {8, 9}, {11, 12}}
+	if len(merged) != len(expected) {
+		t.Fatalf("merged ranges %v, expected %v", merged, expected)
+	}
+	for i := range expected {
+		if merged[i] != expected[i] {
+			t.Fatalf("merged ranges %v, expected %v", merged, expected)
+		}
+	}
+	if count := blocksCount(merged); count != 9 {
+		t.Fatalf("%d blocks counted, expected 9", count)
+	}
+}
+
+func TestNotSynchronizedError(t *testing.T) {
+	err := notSynchronizedError([]BlockRange{{12, 12}, {4, 5}, {6, 7}})
+	if expected := "5 blocks not synchronized: 4-7, 12"; err.Error() != expected {
+		t.Fatalf("error %q, expected %q", err, expected)
+	}
+}
+
+func TestGetBlocksAndTransactions(t *testing.T) {
+	chain := mocknode.NewChain()
+	chain.Mine(2)
+	chain.MineBlock(
+		mocknode.Tx{From: alice, To: bob, Value: big.NewInt(1000)},
+		mocknode.Tx{From: alice, ContractAddress: nftContract},
+	)
+	_, client := startNode(t, chain)
+
+	jobArgs := JobArgs{
+		BlockNumbers:         []uint64{1, 2, 3},
+		Client:               client,
+		Step:                 2,
+		CallTimeoutInSeconds: 5,
+	}
+	blocks, err := GetBlocks(jobArgs, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 3 {
+		t.Fatalf("got %d blocks, expected 3", len(blocks))
+	}
+	for i, block := range blocks {
+		if block.Hash != chain.BlockByNumber(uint64(i+1)).Hash {
+			t.Fatalf("block %d has hash %s, expected %s", i+1, block.Hash, chain.BlockByNumber(uint64(i+1)).Hash)
+		}
+	}
+
+	transactions, receipts, err := GetTransactions(blocks, jobArgs, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions) != 2 || len(receipts) != 2 {
+		t.Fatalf("got %d transactions and %d receipts, expected 2", len(transactions), len(receipts))
+	}
+	transaction := eth.CreateDbTransaction(transactions[0], receipts[0])
+	if transaction.To != bob || transaction.Value != "0x3e8" || transaction.BlockNumber != 3 {
+		t.Fatalf("unexpected transaction %+v", transaction)
+	}
+	if receipts[1].ContractAddress != nftContract {
+		t.Fatalf("contract address %s, expected %s", receipts[1].ContractAddress, nftContract)
+	}
+}
+
+func TestSyncMissingBlocks(t *testing.T) {
+	cfg := newTestConfig()
+	database := dbtest.New(t, cfg)
+
+	chain := mocknode.NewChain()
+	chain.Mine(10)
+	chain.MineBlock(mocknode.Tx{From: alice, To: bob, Value: big.NewInt(1)})
+	latest := chain.Mine(10)
+	_, client := startNode(t, chain)
+
+	SyncMissingBlocks(context.Background(), client, database, cfg)
+
+	// the latest block is left for the next synchronization
+	hashes := storedHashes(t, database)
+	if len(hashes) != int(latest-1) {
+		t.Fatalf("%d blocks stored, expected %d", len(hashes), latest-1)
+	}
+	for number := uint64(1); number < latest; number++ {
+		if hashes[number] != chain.BlockByNumber(number).Hash {
+			t.Fatalf("block %d has hash %s, expected %s", number, hashes[number], chain.BlockByNumber(number).Hash)
+		}
+	}
+
+	count, err := database.NewSelect().Table("transactions").Count(context.Background())
+	if err != nil || count != 1 {
+		t.Fatalf("%d transactions stored, expected 1 (err: %v)", count, err)
+	}
+
+	// a second run has nothing to insert
+	SyncMissingBlocks(context.Background(), client, database, cfg)
+	if len(storedHashes(t, database)) != int(latest-1) {
+		t.Fatal("the second synchronization inserted blocks")
+	}
+}
+
+func TestSyncOrderedCommits(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.OrderedCommits = true
+	// indexing from the genesis block
+	cfg.Checkpoint = 0
+	database := dbtest.New(t, cfg)
+
+	chain := mocknode.NewChain()
+	latest := chain.Mine(20)
+	_, client := startNode(t, chain)
+	watermark := func() int64 {
+		t.Helper()
+		state := &db.SyncState{}
+		if err := database.NewSelect().Model(state).Where("name = ?", db.ContiguousWatermark).Scan(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return state.BlockNumber
+	}
+
+	// the blocks above a failed block are not committed, the watermark stays below it
+	failing := uint64(12)
+	chain.FailBlock(failing, true)
+	SyncMissingBlocks(context.Background(), client, database, cfg)
+	hashes := storedHashes(t, database)
+	contiguous := watermark()
+	if contiguous < 9 || contiguous >= int64(failing) {
+		t.Fatalf("watermark %d after block %d failed, expected between 9 and %d", contiguous, failing, failing-1)
+	}
+	if len(hashes) != int(contiguous+1) {
+		t.Fatalf("%d blocks stored with the watermark at %d, expected %d", len(hashes), contiguous, contiguous+1)
+	}
+	for number := uint64(0); number <= uint64(contiguous); number++ {
+		if _, ok := hashes[number]; !ok {
+			t.Fatalf("block %d below the watermark is not stored", number)
+		}
+	}
+
+	// the next run continues from the watermark
+	chain.FailBlock(failing, false)
+	SyncMissingBlocks(context.Background(), client, database, cfg)
+	if contiguous := watermark(); contiguous != int64(latest-1) {
+		t.Fatalf("watermark %d, expected %d", contiguous, latest-1)
+	}
+	if hashes := storedHashes(t, database); len(hashes) != int(latest) {
+		t.Fatalf("%d blocks stored, expected %d", len(hashes), latest)
+	}
+}
+
+func TestSyncBlockRangeFailure(t *testing.T) {
+	cfg := newTestConfig()
+	database := dbtest.New(t, cfg)
+
+	chain := mocknode.NewChain()
+	chain.Mine(10)
+	_, client := startNode(t, chain)
+
+	chain.FailBlock(6, true)
+	err := SyncBlockRange(context.Background(), client, database, cfg, 1, 10)
+	if err == nil || !strings.Contains(err.Error(), "6") {
+		t.Fatalf("synchronized the range with %v, expected the failed block", err)
+	}
+	if _, ok := storedHashes(t, database)[6]; ok {
+		t.Fatal("the failed block is stored")
+	}
+
+	chain.FailBlock(6, false)
+	if err := SyncBlockRange(context.Background(), client, database, cfg, 1, 10); err != nil {
+		t.Fatal(err)
+	}
+	if hashes := storedHashes(t, database); len(hashes) != 10 {
+		t.Fatalf("%d blocks stored, expected 10", len(hashes))
+	}
+}
+
+func TestFindNewCheckPoint(t *testing.T) {
+	cfg := newTestConfig()
+	database := dbtest.New(t, cfg)
+
+	chain := mocknode.NewChain()
+	latest := chain.Mine(30)
+	_, client := startNode(t, chain)
+	SyncMissingBlocks(context.Background(), client, database, cfg)
+
+	t.Run("moves the checkpoint", func(t *testing.T) {
+		findNewCheckPoint(client, database, context.Background(), cfg, latest)
+		if expected := latest - uint64(cfg.CheckpointDistance); cfg.Checkpoint != expected {
+			t.Fatalf("checkpoint %d, expected %d", cfg.Checkpoint, expected)
+		}
+	})
+
+	t.Run("deletes reorged blocks", func(t *testing.T) {
+		cfg.Checkpoint = 1
+		chain.Reorg(5)
+		reorged := storedHashes(t, database)
+
+		findNewCheckPoint(client, database, context.Background(), cfg, latest)
+		if cfg.Checkpoint != 1 {
+			t.Fatalf("checkpoint moved to %d during a reorg", cfg.Checkpoint)
+		}
+		hashes := storedHashes(t, database)
+		for number := latest - 4; number <= latest-uint64(cfg.CheckpointDistance); number++ {
+			if _, ok := hashes[number]; ok {
+				t.Fatalf("reorged block %d was not deleted", number)
+			}
+		}
+		if hashes[latest-5] != reorged[latest-5] {
+			t.Fatal("a block before the reorg was deleted")
+		}
+
+		SyncMissingBlocks(context.Background(), client, database, cfg)
+		hashes = storedHashes(t, database)
+		for number := latest - 4; number <= latest-uint64(cfg.CheckpointDistance); number++ {
+			if hashes[number] != chain.BlockByNumber(number).Hash {
+				t.Fatalf("block %d has hash %s after the reorg, expected %s", number, hashes[number], chain.BlockByNumber(number).Hash)
+			}
+		}
+	})
+}
+
+func TestSyncNftMetadata(t *testing.T) {
+	cfg := newNftTestConfig()
+	database := dbtest.New(t, cfg)
+
+	chain := mocknode.NewChain()
+	node, client := startNode(t, chain)
+	uri := node.ServeMetadata("token1", `{"name":"Token 1","image":"ipfs://image","description":"first","attributes":[{"trait_type":"color","value":"red"},{"trait_type":"level","value":5}]}`)
+	chain.SetTokenURI(nftContract, 1, uri)
+	chain.MineBlock(mocknode.Tx{
+		From: alice,
+		To:   nftContract,
+		Logs: []mocknode.LogSpec{mocknode.Erc721Transfer(nftContract, mocknode.ZeroAddress, alice, 1)},
+	})
+	chain.MineBlock(mocknode.Tx{
+		From: alice,
+		To:   nftContract,
+		Logs: []mocknode.LogSpec{mocknode.Erc721Transfer(nftContract, alice, bob, 1)},
+	})
+	chain.Mine(1)
+
+	startNftMetadataQueue(t, database, client, cfg)
+	SyncMissingBlocks(context.Background(), client, database, cfg)
+	waitCtx, cancelWait := context.WithTimeout(context.Background(), 30*time.Second)
+	statuses, err := eth.WaitNftMetadataJobs(waitCtx, database, nftContract, "")
+	cancelWait()
+	if err != nil || statuses[db.NftMetadataJobDone] != 1 {
+		t.Fatalf("nft metadata jobs %v, expected 1 done (err: %v)", statuses, err)
+	}
+
+	transfers := []db.NftTransfer{}
+	if err := database.NewSelect().Model(&transfers).Order("block_number").Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(transfers) != 2 || transfers[0].TokenId != "1" || transfers[1].To != "0x3000000000000000000000000000000000000003" {
+		t.Fatalf("unexpected nft transfers %+v", transfers)
+	}
+
+	metadata := []db.NftMetadata{}
+	if err := database.NewSelect().Model(&metadata).Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata) != 1 || metadata[0].Name != "Token 1" || metadata[0].Description != "first" || metadata[0].SourceUri != uri || metadata[0].Raw == "" {
+		t.Fatalf("unexpected nft metadata %+v", metadata)
+	}
+	attributes := []db.NftMetadataAttribute{}
+	if err := database.NewSelect().Model(&attributes).Where("nft_metadata_id = ?", metadata[0].Id).Order("id").Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(attributes) != 2 || attributes[1].ValueType != eth.AttributeNumber || attributes[1].NumericValue == nil || *attributes[1].NumericValue != 5 {
+		t.Fatalf("unexpected nft metadata attributes %+v", attributes)
+	}
+}
+
+func TestNftMetadataUpdate(t *testing.T) {
+	cfg := newNftTestConfig()
+	database := dbtest.New(t, cfg)
+
+	chain := mocknode.NewChain()
+	node, client := startNode(t, chain)
+	uri := node.ServeMetadata("token1", `{"name":"Hidden"}`)
+	chain.SetTokenURI(nftContract, 1, uri)
+	chain.MineBlock(mocknode.Tx{
+		From: alice,
+		To:   nftContract,
+		Logs: []mocknode.LogSpec{mocknode.Erc721Transfer(nftContract, mocknode.ZeroAddress, alice, 1)},
+	})
+	chain.Mine(1)
+
+	startNftMetadataQueue(t, database, client, cfg)
+	waitDone := func() {
+		t.Helper()
+		waitCtx, cancelWait := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancelWait()
+		statuses, err := eth.WaitNftMetadataJobs(waitCtx, database, nftContract, "")
+		if err != nil || statuses[db.NftMetadataJobDone] != 1 {
+			t.Fatalf("nft metadata jobs %v, expected 1 done (err: %v)", statuses, err)
+		}
+	}
+	SyncMissingBlocks(context.Background(), client, database, cfg)
+	waitDone()
+
+	// the collection is revealed
+	node.ServeMetadata("token1", `{"name":"Token 1"}`)
+	chain.MineBlock(mocknode.Tx{
+		From: alice,
+		To:   nftContract,
+		Logs: []mocknode.LogSpec{mocknode.BatchMetadataUpdate(nftContract, 0, 10)},
+	})
+	chain.Mine(1)
+	SyncMissingBlocks(context.Background(), client, database, cfg)
+	waitDone()
+
+	metadata := []db.NftMetadata{}
+	if err := database.NewSelect().Model(&metadata).Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata) != 1 || metadata[0].Name != "Token 1" {
+		t.Fatalf("unexpected nft metadata %+v", metadata)
+	}
+	versions := []db.NftMetadataVersion{}
+	if err := database.NewSelect().Model(&versions).Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0].Name != "Hidden" || versions[0].TokenId != "1" {
+		t.Fatalf("unexpected nft metadata versions %+v", versions)
+	}
+}
+
+func TestSyncNftCollections(t *testing.T) {
+	cfg := newNftTestConfig()
+	database := dbtest.New(t, cfg)
+
+	chain := mocknode.NewChain()
+	node, client := startNode(t, chain)
+	chain.SetCollection(nftContract, "Collection", "COL", node.ServeMetadata("collection", `{"name":"Collection","description":"tokens","external_link":"https://example.com"}`))
+	chain.MineBlock(mocknode.Tx{
+		From: alice,
+		To:   nftContract,
+		Logs: []mocknode.LogSpec{
+			mocknode.Erc721Transfer(nftContract, mocknode.ZeroAddress, alice, 1),
+			mocknode.Erc721Transfer(nftContract, mocknode.ZeroAddress, alice, 2),
+		},
+	})
+	chain.MineBlock(mocknode.Tx{
+		From: alice,
+		To:   nftContract,
+		Logs: []mocknode.LogSpec{mocknode.Erc721Transfer(nftContract, alice, bob, 1)},
+	})
+	burn := chain.MineBlock(mocknode.Tx{
+		From: alice,
+		To:   nftContract,
+		Logs: []mocknode.LogSpec{mocknode.Erc721Transfer(nftContract, alice, mocknode.ZeroAddress, 2)},
+	})
+	chain.Mine(1)
+
+	startNftMetadataQueue(t, database, client, cfg)
+	SyncMissingBlocks(context.Background(), client, database, cfg)
+
+	collection := &db.NftCollection{}
+	for deadline := time.Now().Add(30 * time.Second); ; time.Sleep(100 * time.Millisecond) {
+		if err := database.NewSelect().Model(collection).Where("address = ?", nftContract).Scan(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if collection.MetadataStatus != db.NftMetadataJobPending || time.Now().After(deadline) {
+			break
+		}
+	}
+	if collection.MetadataStatus != db.NftMetadataJobDone || collection.Name != "Collection" || collection.Symbol != "COL" ||
+		collection.Description != "tokens" || collection.ExternalLink != "https://example.com" || collection.Raw == "" {
+		t.Fatalf("unexpected collection metadata %+v", collection)
+	}
+	if collection.Minted != "2" || collection.Burned != "1" || collection.HolderCount != 1 || collection.TransferCount != 4 || collection.LastBlockNumber != burn {
+		t.Fatalf("unexpected collection counters %+v", collection)
+	}
+
+	// the burn is reverted with its block
+	if err := DeleteBlocks(context.Background(), database, []string{storedHashes(t, database)[burn]}); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.NewSelect().Model(collection).Where("address = ?", nftContract).Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if collection.Minted != "2" || collection.Burned != "0" || collection.HolderCount != 2 || collection.TransferCount != 3 || collection.LastBlockNumber != burn-1 {
+		t.Fatalf("unexpected collection counters after the reorg %+v", collection)
+	}
+}
+
+func TestSyncNftTransferRanges(t *testing.T) {
+	cfg := newNftTestConfig()
+	cfg.NftConsecutiveMaxTokens = 10
+	database := dbtest.New(t, cfg)
+	ctx := context.Background()
+
+	chain := mocknode.NewChain()
+	_, client := startNode(t, chain)
+	mint := chain.MineBlock(mocknode.Tx{
+		From: alice,
+		To:   nftContract,
+		Logs: []mocknode.LogSpec{mocknode.ConsecutiveTransfer(nftContract, mocknode.ZeroAddress, alice, 0, 99)},
+	})
+	chain.Mine(1)
+	SyncMissingBlocks(ctx, client, database, cfg)
+
+	// the range is too large for a transfer per token, it is still counted in the collection
+	if count, err := database.NewSelect().Model((*db.NftTransfer)(nil)).Count(ctx); err != nil || count != 0 {
+		t.Fatalf("%d transfers stored (err: %v), expected none", count, err)
+	}
+	if count, err := database.NewSelect().Model((*db.NftTransferRange)(nil)).Count(ctx); err != nil || count != 1 {
+		t.Fatalf("%d transfer ranges stored (err: %v), expected 1", count, err)
+	}
+	collection := &db.NftCollection{}
+	if err := database.NewSelect().Model(collection).Where("address = ?", nftContract).Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if collection.Minted != "100" || collection.HolderCount != 1 || collection.TransferCount != 1 || collection.FirstBlockNumber != mint {
+		t.Fatalf("unexpected collection counters %+v", collection)
+	}
+	holder := &db.NftHolder{}
+	if err := database.NewSelect().Model(holder).Where("address = ?", nftContract).Where("owner = ?", alice).Scan(ctx); err != nil || holder.Balance != "100" {
+		t.Fatalf("unexpected holder %+v (err: %v)", holder, err)
+	}
+
+	// the range is reverted with its block
+	if err := DeleteBlocks(ctx, database, []string{storedHashes(t, database)[mint]}); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := database.NewSelect().Model((*db.NftCollection)(nil)).Count(ctx); err != nil || count != 0 {
+		t.Fatalf("%d collections left after the reorg (err: %v)", count, err)
+	}
+	if count, err := database.NewSelect().Model((*db.NftHolder)(nil)).Count(ctx); err != nil || count != 0 {
+		t.Fatalf("%d holders left after the reorg (err: %v)", count, err)
+	}
+}
+
+func TestRefreshNftRangeMetadata(t *testing.T) {
+	cfg := newNftTestConfig()
+	cfg.NftConsecutiveMaxTokens = 10
+	database := dbtest.New(t, cfg)
+	ctx := context.Background()
+
+	chain := mocknode.NewChain()
+	_, client := startNode(t, chain)
+	chain.MineBlock(mocknode.Tx{
+		From: alice,
+		To:   nftContract,
+		Logs: []mocknode.LogSpec{mocknode.ConsecutiveTransfer(nftContract, mocknode.ZeroAddress, alice, 0, 99)},
+	})
+	chain.Mine(1)
+	SyncMissingBlocks(ctx, client, database, cfg)
+	jobs := func() []string {
+		t.Helper()
+		tokenIds := []string{}
+		if err := database.NewSelect().Model((*db.NftMetadataJob)(nil)).Column("token_id").Where("status = ?", db.NftMetadataJobPending).Order("token_id").Scan(ctx, &tokenIds); err != nil {
+			t.Fatal(err)
+		}
+		return tokenIds
+	}
+
+	// a token of the range is refreshed, the whole range is too large
+	if count, err := eth.RefreshNftMetadata(ctx, database, nftContract, "42", cfg.NftConsecutiveMaxTokens); err != nil || count != 1 {
+		t.Fatalf("refreshed %d tokens (err: %v), expected 1", count, err)
+	}
+	if _, err := eth.RefreshNftMetadata(ctx, database, nftContract, "", cfg.NftConsecutiveMaxTokens); !errors.Is(err, eth.ErrTooManyRangeTokens) {
+		t.Fatalf("refreshed the contract with %v, expected ErrTooManyRangeTokens", err)
+	}
+	if tokenIds := jobs(); len(tokenIds) != 1 || tokenIds[0] != "42" {
+		t.Fatalf("unexpected queued tokens %v", tokenIds)
+	}
+
+	// the updated tokens of the range are queued
+	chain.MineBlock(mocknode.Tx{
+		From: alice,
+		To:   nftContract,
+		Logs: []mocknode.LogSpec{mocknode.BatchMetadataUpdate(nftContract, 95, 120)},
+	})
+	chain.Mine(1)
+	SyncMissingBlocks(ctx, client, database, cfg)
+	if tokenIds := jobs(); len(tokenIds) != 6 || tokenIds[0] != "42" || tokenIds[1] != "95" || tokenIds[5] != "99" {
+		t.Fatalf("unexpected queued tokens %v", tokenIds)
+	}
+}
+
+func TestReorderBuffer(t *testing.T) {
+	newBatches := func(count int) []*batch {
+		batches := make([]*batch, count)
+		for i := range batches {
+			batches[i] = &batch{index: i, args: JobArgs{BlockNumbers: []uint64{uint64(i + 1)}}}
+		}
+		return batches
+	}
+	collect := func(out <-chan *batch) []int {
+		indices := []int{}
+		for b := range out {
+			indices = append(indices, b.index)
+		}
+		return indices
+	}
+
+	t.Run("passes the batches on in order", func(t *testing.T) {
+		batches := newBatches(5)
+		reorder := newReorderBuffer(5, func() {}, func(*batch) { t.Error("a batch was rescheduled") })
+		in := make(chan *batch, 5)
+		for _, i := range []int{3, 1, 0, 4, 2} {
+			reorder.acquire(context.Background())
+			in <- batches[i]
+		}
+		close(in)
+		if indices := collect(reorder.run(context.Background(), in)); len(indices) != 5 || indices[0] != 0 || indices[2] != 2 || indices[4] != 4 {
+			t.Fatalf("batches passed on in order %v", indices)
+		}
+	})
+
+	t.Run("stops after a failed batch", func(t *testing.T) {
+		batches := newBatches(4)
+		stopped := false
+		rescheduled := []int{}
+		reorder := newReorderBuffer(4, func() { stopped = true }, func(b *batch) { rescheduled = append(rescheduled, b.index) })
+		onFailure := reorder.notifyFailure(func(workers.Result[*batch, *batch]) {})
+		in := make(chan *batch, 4)
+		for i := 0; i < 4; i++ {
+			reorder.acquire(context.Background())
+		}
+		in <- batches[3]
+		in <- batches[0]
+		onFailure(workers.Result[*batch, *batch]{Args: batches[1]})
+		out := reorder.run(context.Background(), in)
+		if b := <-out; b.index != 0 {
+			t.Fatalf("batch %d passed on first", b.index)
+		}
+		in <- batches[2]
+		close(in)
+		if indices := collect(out); len(indices) != 0 {
+			t.Fatalf("batches %v passed on after the failure", indices)
+		}
+		if !stopped || len(rescheduled) != 2 {
+			t.Fatalf("stopped %v, rescheduled %v", stopped, rescheduled)
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package syncer
+
+import (
+	"context"
+	"ethernal/explorer/config"
+	"ethernal/explorer/db"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/sirupsen/logrus"
+	bundb "github.com/uptrace/bun"
+)
+
+// VerifyBlocks compares the hashes of the blocks stored between from and to (inclusive) with the blockchain
+// and returns the stored blocks which do not match. Blocks missing in the database are not reported.
+func VerifyBlocks(ctx context.Context, client *rpc.Client, database *bundb.DB, config *config.Config, from uint64, to uint64) ([]db.Block, error) {
+	mismatched := []db.Block{}
+	for start := from; start <= to; start += uint64(config.Step) {
+		end := start + uint64(config.Step) - 1
+		if end > to {
+			end = to
+		}
+
+		blocksFromDb := []db.Block{}
+		err := database.NewSelect().Model(&blocksFromDb).Column("number", "hash").Where("number BETWEEN ? AND ?", start, end).Order("number ASC").Scan(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(blocksFromDb) == 0 {
+			continue
+		}
+
+		blockNumbers := make([]uint64, len(blocksFromDb))
+		for i, block := range blocksFromDb {
+			blockNumbers[i] = block.Number
+		}
+		jobArgs := JobArgs{
+			BlockNumbers:         blockNumbers,
+			Client:               client,
+			Db:                   database,
+			Step:                 config.Step,
+			CallTimeoutInSeconds: config.CallTimeoutInSeconds,
+		}
+		blocksFromBlockchain, err := GetBlocks(jobArgs, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get blocks %d-%d from blockchain: %w", start, end, err)
+		}
+
+		for i := range blocksFromDb {
+			if blocksFromDb[i].Hash != blocksFromBlockchain[i].Hash {
+				mismatched = append(mismatched, blocksFromDb[i])
+			}
+		}
+		logger.WithFields(logrus.Fields{
+			"block_from": start,
+			"block_to":   end,
+			"mismatched": len(mismatched),
+		}).Info("Blocks verified")
+
+		// the last chunk can end at the maximum block number
+		if end == to {
+			break
+		}
+	}
+	return mismatched, nil
+}
+
+// ReindexBlocks deletes the blocks stored between from and to (inclusive) and fetches them again from the blockchain.
+// It returns an error naming the ranges of the deleted blocks which could not be fetched again.
+func ReindexBlocks(ctx context.Context, client *rpc.Client, database *bundb.DB, config *config.Config, from uint64, to uint64) error {
+	blockHashes := []string{}
+	err := database.NewSelect().Table("blocks").Column("hash").Where("number BETWEEN ? AND ?", from, to).Scan(ctx, &blockHashes)
+	if err != nil {
+		return err
+	}
+
+	if len(blockHashes) != 0 {
+		if err := DeleteBlocks(ctx, database, blockHashes); err != nil {
+			return err
+		}
+	}
+
+	return SyncBlockRange(ctx, client, database, config, from, to)
+}
@@ -0,0 +1,57 @@
+package syncer
+
+import (
+	"context"
+	"ethernal/explorer/db"
+	"ethernal/explorer/metrics"
+
+	bundb "github.com/uptrace/bun"
+)
+
+// initWatermark creates the contiguous watermark just below the checkpoint if it does not exist, raises it to the checkpoint if the checkpoint has moved past it,
+// and returns it. Every block between the checkpoint and the watermark is stored, so only the blocks above it have to be checked.
+// The watermark is signed, so that it is -1 before the genesis block is stored.
+func initWatermark(ctx context.Context, database *bundb.DB, checkpoint uint64) (int64, error) {
+	floor := int64(checkpoint) - 1
+	state := &db.SyncState{Name: db.ContiguousWatermark, BlockNumber: floor}
+	if _, err := database.NewInsert().Model(state).On("CONFLICT (name) DO NOTHING").Exec(ctx); err != nil {
+		return 0, err
+	}
+	if _, err := database.NewUpdate().Model(state).Set("block_number = ?", floor).Set("updated_at = current_timestamp").Where("name = ?", db.ContiguousWatermark).Where("block_number < ?", floor).Exec(ctx); err != nil {
+		return 0, err
+	}
+	if err := database.NewSelect().Model(state).Where("name = ?", db.ContiguousWatermark).Scan(ctx); err != nil {
+		return 0, err
+	}
+	metrics.ContiguousHead.Set(float64(state.BlockNumber))
+	return state.BlockNumber, nil
+}
+
+// advanceWatermark moves the watermark to last, if it has reached the block before first. It is called in the transaction inserting the blocks first to last,
+// after which every block up to last is stored.
+func advanceWatermark(ctx context.Context, idb bundb.IDB, first uint64, last uint64) (bool, error) {
+	// the watermark is -1 when first is the genesis block
+	previous := int64(first) - 1
+	result, err := idb.NewUpdate().Model((*db.SyncState)(nil)).
+		Set("block_number = ?", last).
+		Set("updated_at = current_timestamp").
+		Where("name = ?", db.ContiguousWatermark).
+		Where("block_number >= ? AND block_number < ?", previous, last).
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// lowerWatermark moves the watermark below the deleted blocks, so that they are synchronized again.
+func lowerWatermark(ctx context.Context, idb bundb.IDB, blockHashes []string) error {
+	_, err := idb.NewUpdate().Model((*db.SyncState)(nil)).
+		Set("block_number = (SELECT MIN(number) - 1 FROM blocks WHERE hash IN (?))", bundb.In(blockHashes)).
+		Set("updated_at = current_timestamp").
+		Where("name = ?", db.ContiguousWatermark).
+		Where("block_number >= (SELECT MIN(number) FROM blocks WHERE hash IN (?))", bundb.In(blockHashes)).
+		Exec(ctx)
+	return err
+}
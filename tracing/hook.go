@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maximum length of the statement recorded on a span, inserts of whole jobs are huge
+const maxStatementLength = 1000
+
+type QueryHook struct{}
+
+var _ bun.QueryHook = (*QueryHook)(nil)
+
+func (QueryHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	// queries outside of a traced operation are not recorded
+	if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		return ctx
+	}
+
+	attributes := []attribute.KeyValue{
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation", event.Operation()),
+	}
+	if query, ok := event.IQuery.(interface{ GetTableName() string }); ok {
+		attributes = append(attributes, attribute.String("db.sql.table", query.GetTableName()))
+	}
+
+	ctx, _ = Start(ctx, "db."+event.Operation(), attributes...)
+	return ctx
+}
+
+// AfterQuery records the statement and the number of affected rows and ends the span.
+func (QueryHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+
+	statement := event.Query
+	if len(statement) > maxStatementLength {
+		statement = statement[:maxStatementLength]
+	}
+	span.SetAttributes(attribute.String("db.statement", statement))
+	if event.Result != nil {
+		if rows, err := event.Result.RowsAffected(); err == nil {
+			span.SetAttributes(attribute.Int64("db.rows_affected", rows))
+		}
+	}
+	End(span, event.Err)
+}
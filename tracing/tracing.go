@@ -0,0 +1,152 @@
+package tracing
+
+import (
+	"context"
+	"ethernal/explorer/config"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOtlp   = "otlp"
+
+	serviceName = "blockchain-explorer"
+)
+
+// Setup registers the global tracer provider for the configured exporter.
+// The returned function flushes the spans which have not been exported yet.
+func Setup(ctx context.Context, config *config.Config) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch config.TracingExporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		// the standard output carries the logs
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr))
+	case ExporterOtlp:
+		var options []otlptracehttp.Option
+		options, err = endpointOptions(config.TracingEndpoint)
+		if err == nil {
+			exporter, err = otlptracehttp.New(ctx, options...)
+		}
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %s", config.TracingExporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// endpointOptions returns the options of the OTLP exporter sending the spans to the endpoint, a host:port or an http:// or https:// URL.
+// Only an http:// endpoint is reached without TLS. Without endpoint, the exporter reads its settings from the OTEL_EXPORTER_OTLP_* variables.
+func endpointOptions(endpoint string) ([]otlptracehttp.Option, error) {
+	if endpoint == "" {
+		return nil, nil
+	}
+	if !strings.Contains(endpoint, "://") {
+		return []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}, nil
+	}
+
+	endpointUrl, err := url.Parse(endpoint)
+	if err != nil || endpointUrl.Host == "" || (endpointUrl.Scheme != "http" && endpointUrl.Scheme != "https") {
+		return nil, fmt.Errorf("invalid tracing endpoint %s", endpoint)
+	}
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpointUrl.Host)}
+	if endpointUrl.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	if endpointUrl.Path != "" && endpointUrl.Path != "/" {
+		options = append(options, otlptracehttp.WithURLPath(endpointUrl.Path))
+	}
+	return options, nil
+}
+
+// Start starts a span with the explorer tracer.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer("ethernal/explorer").Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End records the error, if any, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Detach returns a context carrying the span of ctx, which is not cancelled together with ctx.
+func Detach(ctx context.Context) context.Context {
+	return trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
+}
+
+// BlockRange returns the attributes describing the range of block numbers.
+func BlockRange(blockNumbers []uint64) []attribute.KeyValue {
+	if len(blockNumbers) == 0 {
+		return []attribute.KeyValue{attribute.Int("block.count", 0)}
+	}
+	return []attribute.KeyValue{
+		attribute.Int64("block.from", int64(blockNumbers[0])),
+		attribute.Int64("block.to", int64(blockNumbers[len(blockNumbers)-1])),
+		attribute.Int("block.count", len(blockNumbers)),
+	}
+}
+
+// RpcBatch returns the attributes describing a batch of calls.
+func RpcBatch(elems []rpc.BatchElem) []attribute.KeyValue {
+	methods := []string{}
+	for _, e := range elems {
+		found := false
+		for _, m := range methods {
+			if m == e.Method {
+				found = true
+				break
+			}
+		}
+		if !found {
+			methods = append(methods, e.Method)
+		}
+	}
+	return []attribute.KeyValue{
+		attribute.Int("rpc.batch_size", len(elems)),
+		attribute.StringSlice("rpc.methods", methods),
+	}
+}
+
+// BatchError returns the error of the batch call or, if it succeeded, the first error of its calls.
+func BatchError(elems []rpc.BatchElem, err error) error {
+	if err != nil {
+		return err
+	}
+	for _, e := range elems {
+		if e.Error != nil {
+			return e.Error
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"context"
+	"time"
+)
+
+// WithDrainTimeout returns a context which is cancelled when the timeout elapses after the parent is done,
+// giving work in progress a chance to finish after the application is stopped.
+func WithDrainTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-parent.Done():
+		case <-ctx.Done():
+			return
+		}
+
+		select {
+		case <-time.After(timeout):
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
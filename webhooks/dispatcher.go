@@ -0,0 +1,325 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"ethernal/explorer/config"
+	"ethernal/explorer/db"
+	"ethernal/explorer/loger"
+	"ethernal/explorer/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/uptrace/bun"
+)
+
+var logger = loger.Get(loger.Webhooks)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+
+	// pollInterval is how often the dispatcher looks for due deliveries
+	pollInterval       = time.Second
+	retryBackoff       = time.Second
+	maxBackoff         = 5 * time.Minute
+	concurrentDelivery = 16
+)
+
+// Dispatcher posts the deliveries queued in the webhook_deliveries table. The deliveries of a watch are posted one at a time,
+// in the order they were queued, so that the removal of a block never overtakes its commit. A failed delivery is attempted again
+// with exponential backoff, holding back the next deliveries of its watch, until it is moved to the dead letter table.
+type Dispatcher struct {
+	db          *bun.DB
+	client      http.Client
+	maxAttempts int
+	// backoff is the delay before the second attempt of a delivery, it doubles with every next attempt up to maxBackoff
+	backoff time.Duration
+}
+
+var dispatcherInstance *Dispatcher
+
+// NewDispatcher creates the dispatcher delivering the webhooks queued by the syncer. It has to be called before the synchronization starts.
+func NewDispatcher(bunDb *bun.DB, config *config.Config) *Dispatcher {
+	dispatcherInstance = &Dispatcher{
+		db: bunDb,
+		client: http.Client{
+			Timeout: time.Duration(config.WebhookTimeout) * time.Second,
+		},
+		maxAttempts: int(config.WebhookMaxAttempts),
+		backoff:     retryBackoff,
+	}
+	return dispatcherInstance
+}
+
+// Enabled reports whether webhooks are delivered.
+func Enabled() bool {
+	return dispatcherInstance != nil
+}
+
+// EnqueueCommitted queues the deliveries of the rows inserted by a sync job to the watches they match. It is called in the transaction
+// inserting the rows, so that no delivery is lost and a slow watch never holds back the synchronization.
+func EnqueueCommitted(ctx context.Context, idb bun.IDB, transactions []*db.Transaction, logs []*db.Log, nftTransfers []*db.NftTransfer) error {
+	if !Enabled() {
+		return nil
+	}
+	return enqueue(ctx, idb, &batch{
+		transactions: transactions,
+		logs:         logs,
+		nftTransfers: nftTransfers,
+	})
+}
+
+// EnqueueRemoved queues the reorg deliveries of the rows of the blocks. It is called in the transaction deleting the blocks, before their rows are deleted.
+func EnqueueRemoved(ctx context.Context, idb bun.IDB, blockHashes []string) error {
+	if !Enabled() {
+		return nil
+	}
+
+	b := &batch{removed: true}
+	if err := idb.NewSelect().Model(&b.transactions).Where("block_hash IN (?)", bun.In(blockHashes)).Scan(ctx); err != nil {
+		return err
+	}
+	if err := idb.NewSelect().Model(&b.logs).Where("block_hash IN (?)", bun.In(blockHashes)).Scan(ctx); err != nil {
+		return err
+	}
+	if err := idb.NewSelect().Model(&b.nftTransfers).Where("block_hash IN (?)", bun.In(blockHashes)).Scan(ctx); err != nil {
+		return err
+	}
+	return enqueue(ctx, idb, b)
+}
+
+// enqueue matches the batch against the active watches and inserts a delivery for every watch with events
+func enqueue(ctx context.Context, idb bun.IDB, b *batch) error {
+	if len(b.transactions) == 0 && len(b.logs) == 0 && len(b.nftTransfers) == 0 {
+		return nil
+	}
+	watches := []*db.Watch{}
+	if err := idb.NewSelect().Model(&watches).Where("active").Order("id").Scan(ctx); err != nil {
+		return err
+	}
+
+	deliveries := []*db.WebhookDelivery{}
+	for _, watch := range watches {
+		events := match(watch, b)
+		if len(events) == 0 {
+			continue
+		}
+
+		body, err := json.Marshal(Payload{WatchId: watch.Id, Removed: b.removed, Events: events})
+		if err != nil {
+			return fmt.Errorf("cannot encode the payload of watch %d: %w", watch.Id, err)
+		}
+		deliveries = append(deliveries, &db.WebhookDelivery{WatchId: watch.Id, Payload: string(body)})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	_, err := idb.NewInsert().Model(&deliveries).Exec(ctx)
+	return err
+}
+
+// Run posts the due deliveries until ctx is cancelled. The deliveries in progress then have the shutdown timeout to finish,
+// the ones which do not finish are posted again by the next run.
+func (d *Dispatcher) Run(ctx context.Context, shutdownTimeout time.Duration) {
+	workCtx, cancel := utils.WithDrainTimeout(ctx, shutdownTimeout)
+	defer cancel()
+
+	var inProgress sync.WaitGroup
+	slots := make(chan struct{}, concurrentDelivery)
+	for ctx.Err() == nil {
+		// only this loop takes the slots, so the free ones stay free until the claimed deliveries are started
+		if free := cap(slots) - len(slots); free > 0 {
+			deliveries, err := d.claim(ctx, free)
+			if err != nil && ctx.Err() == nil {
+				logger.WithError(err).Error("Cannot claim webhook deliveries")
+			}
+			for _, delivery := range deliveries {
+				slots <- struct{}{}
+				inProgress.Add(1)
+				go func(delivery *db.WebhookDelivery) {
+					defer func() {
+						<-slots
+						inProgress.Done()
+					}()
+					d.deliver(workCtx, delivery)
+				}(delivery)
+			}
+		}
+
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+		}
+	}
+	inProgress.Wait()
+	logger.Info("Webhook dispatcher stopped")
+}
+
+// claim reserves up to limit due deliveries to this dispatcher and counts their attempt. Only the first delivery of every watch is claimed,
+// the next ones wait until it is posted or moved to the dead letter table.
+func (d *Dispatcher) claim(ctx context.Context, limit int) ([]*db.WebhookDelivery, error) {
+	due := d.db.NewSelect().Model((*db.WebhookDelivery)(nil)).
+		Where("next_attempt_at <= current_timestamp").
+		Where("NOT EXISTS (SELECT 1 FROM webhook_deliveries AS earlier WHERE earlier.watch_id = ?TableAlias.watch_id AND earlier.id < ?TableAlias.id)").
+		Order("id").
+		Limit(limit)
+
+	claimed := []*db.WebhookDelivery{}
+	err := d.lease().Claim(ctx, due, &claimed)
+	return claimed, err
+}
+
+// lease is the lease of the claimed deliveries. It outlasts the request timeout, the deliveries of a process which stopped
+// without releasing them are claimed again once it expires.
+func (d *Dispatcher) lease() *db.Lease {
+	return &db.Lease{Db: d.db, Model: (*db.WebhookDelivery)(nil), Key: "id", Duration: d.client.Timeout + time.Minute}
+}
+
+// deliver posts the claimed delivery to its watch and stores the outcome
+func (d *Dispatcher) deliver(ctx context.Context, delivery *db.WebhookDelivery) {
+	fields := logrus.Fields{"watch_id": delivery.WatchId, "delivery_id": delivery.Id, "attempt": delivery.Attempts}
+	watch := &db.Watch{}
+	if err := d.db.NewSelect().Model(watch).Where("id = ?", delivery.WatchId).Scan(ctx); err != nil {
+		logger.WithFields(fields).WithError(err).Error("Error while loading the watch of a webhook delivery")
+		d.release(delivery)
+		return
+	}
+	if !watch.Active {
+		logger.WithFields(fields).Debug("Webhook delivery dropped, its watch is not active")
+		d.finish(ctx, delivery)
+		return
+	}
+
+	err := d.post(ctx, watch, []byte(delivery.Payload))
+	if err == nil {
+		d.finish(ctx, delivery)
+		return
+	}
+	if ctx.Err() != nil {
+		// the interrupted delivery is posted again by the next run
+		d.release(delivery)
+		return
+	}
+
+	fields["url"] = watch.Url
+	logger.WithFields(fields).WithError(err).Warn("Webhook delivery failed")
+	d.fail(ctx, watch, delivery, err)
+}
+
+// finish deletes the delivery, unless its claim has been lost
+func (d *Dispatcher) finish(ctx context.Context, delivery *db.WebhookDelivery) {
+	_, err := d.db.NewDelete().Model((*db.WebhookDelivery)(nil)).
+		Where("id = ?", delivery.Id).
+		Where("claim_token = ?", delivery.ClaimToken).
+		Exec(ctx)
+	if err != nil {
+		logger.WithField("watch_id", delivery.WatchId).WithError(err).Error("Error during deleting webhook delivery from DB")
+	}
+}
+
+// fail schedules the next attempt of the delivery with exponential backoff, or moves it to the dead letter table after its last attempt
+func (d *Dispatcher) fail(ctx context.Context, watch *db.Watch, delivery *db.WebhookDelivery, deliveryErr error) {
+	if delivery.Attempts < d.maxAttempts {
+		_, err := d.db.NewUpdate().Model((*db.WebhookDelivery)(nil)).
+			Set("next_attempt_at = current_timestamp + ? * interval '1 millisecond'", d.delay(delivery.Attempts).Milliseconds()).
+			Set("last_error = ?", deliveryErr.Error()).
+			Set("claim_token = NULL").
+			Set("claimed_until = NULL").
+			Where("id = ?", delivery.Id).
+			Where("claim_token = ?", delivery.ClaimToken).
+			Exec(ctx)
+		if err != nil {
+			logger.WithField("watch_id", watch.Id).WithError(err).Error("Error during updating webhook delivery in DB")
+		}
+		return
+	}
+
+	err := d.db.RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		result, err := tx.NewDelete().Model((*db.WebhookDelivery)(nil)).
+			Where("id = ?", delivery.Id).
+			Where("claim_token = ?", delivery.ClaimToken).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		// the delivery has been claimed again after the lease expired
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			return err
+		}
+
+		deadLetter := &db.WebhookDeadLetter{
+			WatchId:   watch.Id,
+			Url:       watch.Url,
+			Payload:   delivery.Payload,
+			Attempts:  delivery.Attempts,
+			LastError: deliveryErr.Error(),
+		}
+		_, err = tx.NewInsert().Model(deadLetter).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		logger.WithField("watch_id", watch.Id).WithError(err).Error("Error during inserting webhook dead letter in DB")
+	}
+}
+
+// release gives up the claim of the delivery, so that it can be claimed again without waiting for its lease to expire
+func (d *Dispatcher) release(delivery *db.WebhookDelivery) {
+	if err := d.lease().Release([]uint64{delivery.Id}, delivery.ClaimToken); err != nil {
+		logger.WithField("watch_id", delivery.WatchId).WithError(err).Error("Cannot release webhook delivery")
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, watch *db.Watch, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, watch.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(TimestampHeader, timestamp)
+	request.Header.Set(SignatureHeader, "sha256="+Sign(watch.Secret, timestamp, body))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the timestamp and the body, separated by a dot.
+// Receivers recompute it with the watch secret to verify the X-Webhook-Signature header.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// delay returns the backoff after the attempt
+func (d *Dispatcher) delay(attempt int) time.Duration {
+	delay := d.backoff
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
+}
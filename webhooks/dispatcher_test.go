@@ -0,0 +1,209 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"ethernal/explorer/config"
+	"ethernal/explorer/db"
+	"ethernal/explorer/db/dbtest"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	blockHash = "0x1000000000000000000000000000000000000000000000000000000000000001"
+	txHash    = "0x2000000000000000000000000000000000000000000000000000000000000002"
+	alice     = "0x3000000000000000000000000000000000000003"
+	bob       = "0x4000000000000000000000000000000000000004"
+	secret    = "secret"
+)
+
+// receiver is a watch endpoint answering with the scripted statuses, then with 200
+type receiver struct {
+	lock     sync.Mutex
+	statuses []int
+	payloads []Payload
+	verified []bool
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	payload := Payload{}
+	json.Unmarshal(body, &payload)
+	signature := strings.TrimPrefix(req.Header.Get(SignatureHeader), "sha256=")
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.payloads = append(r.payloads, payload)
+	r.verified = append(r.verified, signature == Sign(secret, req.Header.Get(TimestampHeader), body))
+	status := http.StatusOK
+	if len(r.statuses) != 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+// newTestDispatcher creates a dispatcher retrying at once and a watch of alice's transactions posting to the receiver
+func newTestDispatcher(t *testing.T, r *receiver) (*Dispatcher, *bun.DB) {
+	t.Helper()
+	cfg := &config.Config{WebhookMaxAttempts: 3, WebhookTimeout: 5}
+	database := dbtest.New(t, cfg)
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { dispatcherInstance = nil })
+
+	watch := &db.Watch{Url: server.URL, Secret: secret, Address: alice, Active: true}
+	if _, err := database.NewInsert().Model(watch).Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDispatcher(database, cfg)
+	d.backoff = 0
+	return d, database
+}
+
+// deliverDue posts the due deliveries and returns how many were claimed
+func deliverDue(t *testing.T, d *Dispatcher) int {
+	t.Helper()
+	deliveries, err := d.claim(context.Background(), concurrentDelivery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, delivery := range deliveries {
+		d.deliver(context.Background(), delivery)
+	}
+	return len(deliveries)
+}
+
+func testTransaction() *db.Transaction {
+	return &db.Transaction{Hash: txHash, BlockHash: blockHash, BlockNumber: 7, From: alice, To: bob, Value: "0x64"}
+}
+
+func TestPostSigned(t *testing.T) {
+	r := &receiver{statuses: []int{http.StatusInternalServerError}}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	d := &Dispatcher{}
+	watch := &db.Watch{Url: server.URL, Secret: secret}
+
+	body := []byte(`{"watch_id":1,"removed":false,"events":[]}`)
+	if err := d.post(context.Background(), watch, body); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("posted with %v, expected the status error", err)
+	}
+	if err := d.post(context.Background(), watch, body); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.verified) != 2 || !r.verified[0] || !r.verified[1] {
+		t.Fatalf("signatures verified %v", r.verified)
+	}
+}
+
+func TestDeliverSignedPayload(t *testing.T) {
+	r := &receiver{}
+	d, database := newTestDispatcher(t, r)
+	ctx := context.Background()
+
+	// the transaction of another address is not delivered
+	other := &db.Transaction{Hash: txHash, BlockHash: blockHash, From: bob, To: bob}
+	if err := EnqueueCommitted(ctx, database, []*db.Transaction{testTransaction(), other}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if claimed := deliverDue(t, d); claimed != 1 {
+		t.Fatalf("%d deliveries claimed, expected 1", claimed)
+	}
+
+	if len(r.payloads) != 1 || !r.verified[0] {
+		t.Fatalf("received %d payloads, signature verified %v", len(r.payloads), r.verified)
+	}
+	payload := r.payloads[0]
+	if payload.Removed || len(payload.Events) != 1 || payload.Events[0].Type != TransactionEvent || payload.Events[0].From != alice || payload.Events[0].BlockNumber != 7 {
+		t.Fatalf("unexpected payload %+v", payload)
+	}
+	if count, err := database.NewSelect().Model((*db.WebhookDelivery)(nil)).Count(ctx); err != nil || count != 0 {
+		t.Fatalf("%d deliveries left after posting (err: %v)", count, err)
+	}
+}
+
+func TestDeliveryRetry(t *testing.T) {
+	r := &receiver{statuses: []int{http.StatusInternalServerError}}
+	d, database := newTestDispatcher(t, r)
+	ctx := context.Background()
+	if err := EnqueueCommitted(ctx, database, []*db.Transaction{testTransaction()}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	deliverDue(t, d)
+	delivery := &db.WebhookDelivery{}
+	if err := database.NewSelect().Model(delivery).Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Attempts != 1 || !strings.Contains(delivery.LastError, "500") || delivery.ClaimToken != "" {
+		t.Fatalf("unexpected delivery after a failed attempt %+v", delivery)
+	}
+
+	deliverDue(t, d)
+	if len(r.payloads) != 2 || !r.verified[1] {
+		t.Fatalf("received %d payloads, expected the retried one", len(r.payloads))
+	}
+	if count, err := database.NewSelect().Model((*db.WebhookDelivery)(nil)).Count(ctx); err != nil || count != 0 {
+		t.Fatalf("%d deliveries left after the retry (err: %v)", count, err)
+	}
+}
+
+func TestDeliveryDeadLetter(t *testing.T) {
+	r := &receiver{statuses: []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError}}
+	d, database := newTestDispatcher(t, r)
+	ctx := context.Background()
+	if err := EnqueueCommitted(ctx, database, []*db.Transaction{testTransaction()}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for attempt := 0; attempt < d.maxAttempts; attempt++ {
+		deliverDue(t, d)
+	}
+	if claimed := deliverDue(t, d); claimed != 0 || len(r.payloads) != d.maxAttempts {
+		t.Fatalf("%d payloads received and %d claimed after the last attempt", len(r.payloads), claimed)
+	}
+
+	deadLetters := []db.WebhookDeadLetter{}
+	if err := database.NewSelect().Model(&deadLetters).Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(deadLetters) != 1 || deadLetters[0].Attempts != d.maxAttempts || !strings.Contains(deadLetters[0].LastError, "500") || !strings.Contains(deadLetters[0].Payload, txHash) {
+		t.Fatalf("unexpected dead letters %+v", deadLetters)
+	}
+}
+
+func TestDeliverRemovedInOrder(t *testing.T) {
+	// the commit payload fails once, the reorg payload waits for it
+	r := &receiver{statuses: []int{http.StatusInternalServerError}}
+	d, database := newTestDispatcher(t, r)
+	ctx := context.Background()
+	if _, err := database.NewInsert().Model(&db.Block{Hash: blockHash, Number: 7}).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.NewInsert().Model(testTransaction()).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EnqueueCommitted(ctx, database, []*db.Transaction{testTransaction()}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnqueueRemoved(ctx, database, []string{blockHash}); err != nil {
+		t.Fatal(err)
+	}
+	for deliverDue(t, d) != 0 {
+	}
+
+	if len(r.payloads) != 3 || r.payloads[0].Removed || r.payloads[1].Removed || !r.payloads[2].Removed {
+		t.Fatalf("unexpected order of the payloads %+v", r.payloads)
+	}
+	if events := r.payloads[2].Events; len(events) != 1 || events[0].TransactionHash != txHash {
+		t.Fatalf("unexpected removed events %+v", events)
+	}
+}
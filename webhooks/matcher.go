@@ -0,0 +1,105 @@
+package webhooks
+
+import (
+	"ethernal/explorer/db"
+	"math/big"
+	"strings"
+)
+
+// match returns the events from the batch the watch is subscribed to.
+// A watch with Topic0 set receives only logs, other watches receive transactions and NFT transfers.
+func match(watch *db.Watch, b *batch) []Event {
+	events := []Event{}
+
+	if watch.Topic0 != "" {
+		for _, l := range b.logs {
+			if matchLog(watch, l) {
+				events = append(events, logEvent(l))
+			}
+		}
+		return events
+	}
+
+	for _, t := range b.transactions {
+		if matchTransaction(watch, t) {
+			events = append(events, transactionEvent(t))
+		}
+	}
+
+	for _, n := range b.nftTransfers {
+		if matchNftTransfer(watch, n) {
+			events = append(events, nftTransferEvent(n))
+		}
+	}
+
+	return events
+}
+
+func matchTransaction(watch *db.Watch, t *db.Transaction) bool {
+	if watch.Address != "" && !equalAddress(watch.Address, t.From) && !equalAddress(watch.Address, t.To) && !equalAddress(watch.Address, t.ContractAddress) {
+		return false
+	}
+	if watch.Contract != "" && !equalAddress(watch.Contract, t.To) {
+		return false
+	}
+	if watch.MinValue != "" && !valueAtLeast(t.Value, watch.MinValue) {
+		return false
+	}
+	return true
+}
+
+func matchLog(watch *db.Watch, l *db.Log) bool {
+	if !strings.EqualFold(watch.Topic0, l.Topic0) {
+		return false
+	}
+	if watch.Contract != "" && !equalAddress(watch.Contract, l.Address) {
+		return false
+	}
+	// indexed address parameters are left padded to 32 bytes
+	if watch.Address != "" {
+		topic := "0x000000000000000000000000" + strings.TrimPrefix(strings.ToLower(watch.Address), "0x")
+		if !strings.EqualFold(topic, l.Topic1) && !strings.EqualFold(topic, l.Topic2) && !strings.EqualFold(topic, l.Topic3) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchNftTransfer(watch *db.Watch, n *db.NftTransfer) bool {
+	if watch.Address != "" && !equalAddress(watch.Address, n.From) && !equalAddress(watch.Address, n.To) {
+		return false
+	}
+	if watch.Contract != "" && !equalAddress(watch.Contract, n.Address) {
+		return false
+	}
+	if watch.MinValue != "" && n.Value != "" && !valueAtLeast(n.Value, watch.MinValue) {
+		return false
+	}
+	return true
+}
+
+// equalAddress compares addresses regardless of the checksum casing
+func equalAddress(a string, b string) bool {
+	return b != "" && strings.EqualFold(a, b)
+}
+
+// valueAtLeast compares a hex or decimal value with the decimal minimum of the watch
+func valueAtLeast(value string, min string) bool {
+	minValue, ok := new(big.Int).SetString(min, 10)
+	if !ok {
+		logger.WithField("min_value", min).Warn("Invalid watch min value")
+		return false
+	}
+
+	var v *big.Int
+	if strings.HasPrefix(value, "0x") {
+		v, ok = new(big.Int).SetString(value[2:], 16)
+	} else {
+		v, ok = new(big.Int).SetString(value, 10)
+	}
+	if !ok {
+		return false
+	}
+
+	return v.Cmp(minValue) >= 0
+}
@@ -0,0 +1,58 @@
+package webhooks
+
+import (
+	"ethernal/explorer/db"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	const (
+		contract = "0x5000000000000000000000000000000000000005"
+		topic0   = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+	)
+	b := &batch{
+		transactions: []*db.Transaction{
+			{Hash: "0x01", From: alice, To: bob, Value: "0x64"},
+			{Hash: "0x02", From: bob, To: contract, Value: "10"},
+		},
+		logs: []*db.Log{
+			{TransactionHash: "0x01", Address: contract, Topic0: topic0, Topic1: "0x000000000000000000000000" + alice[2:]},
+			{TransactionHash: "0x02", Address: bob, Topic0: topic0},
+		},
+		nftTransfers: []*db.NftTransfer{
+			{TransactionHash: "0x03", Address: contract, From: bob, To: alice, TokenId: "1"},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		watch  *db.Watch
+		hashes []string
+	}{
+		{"address", &db.Watch{Address: alice}, []string{"0x01", "0x03"}},
+		{"recipient address", &db.Watch{Address: bob}, []string{"0x01", "0x02", "0x03"}},
+		{"contract", &db.Watch{Contract: contract}, []string{"0x02", "0x03"}},
+		{"min value", &db.Watch{MinValue: "100"}, []string{"0x01", "0x03"}},
+		{"min value above", &db.Watch{MinValue: "101"}, []string{"0x03"}},
+		{"topic0", &db.Watch{Topic0: topic0}, []string{"0x01", "0x02"}},
+		{"topic0 and contract", &db.Watch{Topic0: topic0, Contract: contract}, []string{"0x01"}},
+		{"topic0 and indexed address", &db.Watch{Topic0: topic0, Address: alice}, []string{"0x01"}},
+		{"other topic0", &db.Watch{Topic0: "0x01"}, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hashes := []string{}
+			for _, event := range match(test.watch, b) {
+				hashes = append(hashes, event.TransactionHash)
+			}
+			if len(hashes) != len(test.hashes) {
+				t.Fatalf("matched %v, expected %v", hashes, test.hashes)
+			}
+			for i := range hashes {
+				if hashes[i] != test.hashes[i] {
+					t.Fatalf("matched %v, expected %v", hashes, test.hashes)
+				}
+			}
+		})
+	}
+}
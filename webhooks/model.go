@@ -0,0 +1,91 @@
+package webhooks
+
+import "ethernal/explorer/db"
+
+// event types sent in the webhook payload
+const (
+	TransactionEvent = "transaction"
+	LogEvent         = "log"
+	NftTransferEvent = "nft_transfer"
+)
+
+// Payload is the JSON document posted to the watch URL.
+type Payload struct {
+	WatchId uint64 `json:"watch_id"`
+	// Removed is set when the events were deleted from the database because their blocks were reorganized
+	Removed bool    `json:"removed"`
+	Events  []Event `json:"events"`
+}
+
+type Event struct {
+	Type            string   `json:"type"`
+	BlockHash       string   `json:"block_hash"`
+	BlockNumber     uint64   `json:"block_number"`
+	TransactionHash string   `json:"transaction_hash"`
+	From            string   `json:"from,omitempty"`
+	To              string   `json:"to,omitempty"`
+	Value           string   `json:"value,omitempty"`
+	Address         string   `json:"address,omitempty"`
+	LogIndex        uint32   `json:"log_index,omitempty"`
+	Topics          []string `json:"topics,omitempty"`
+	Data            string   `json:"data,omitempty"`
+	TokenId         string   `json:"token_id,omitempty"`
+	TokenTypeId     int      `json:"token_type_id,omitempty"`
+}
+
+// batch holds the rows of one committed sync job or of the blocks removed during validation
+type batch struct {
+	removed      bool
+	transactions []*db.Transaction
+	logs         []*db.Log
+	nftTransfers []*db.NftTransfer
+}
+
+func transactionEvent(t *db.Transaction) Event {
+	return Event{
+		Type:            TransactionEvent,
+		BlockHash:       t.BlockHash,
+		BlockNumber:     t.BlockNumber,
+		TransactionHash: t.Hash,
+		From:            t.From,
+		To:              t.To,
+		Value:           t.Value,
+		Address:         t.ContractAddress,
+	}
+}
+
+func logEvent(l *db.Log) Event {
+	topics := []string{}
+	for _, topic := range []string{l.Topic0, l.Topic1, l.Topic2, l.Topic3} {
+		if topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+
+	return Event{
+		Type:            LogEvent,
+		BlockHash:       l.BlockHash,
+		BlockNumber:     l.BlockNumber,
+		TransactionHash: l.TransactionHash,
+		Address:         l.Address,
+		LogIndex:        l.Index,
+		Topics:          topics,
+		Data:            l.Data,
+	}
+}
+
+func nftTransferEvent(n *db.NftTransfer) Event {
+	return Event{
+		Type:            NftTransferEvent,
+		BlockHash:       n.BlockHash,
+		BlockNumber:     n.BlockNumber,
+		TransactionHash: n.TransactionHash,
+		From:            n.From,
+		To:              n.To,
+		Value:           n.Value,
+		Address:         n.Address,
+		LogIndex:        n.Index,
+		TokenId:         n.TokenId,
+		TokenTypeId:     n.TokenTypeId,
+	}
+}
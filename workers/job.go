@@ -2,24 +2,102 @@ package workers
 
 import (
 	"context"
+	"errors"
+	"ethernal/explorer/metrics"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
 )
 
-type ExecutionFn func(ctx context.Context, args interface{}) interface{}
+// ExecutionFn executes a job with its arguments and returns its result or why it failed.
+type ExecutionFn[A, R any] func(ctx context.Context, args A) (R, error)
 
-type Result struct {
+// RetryPolicy sets how many times a failed job is executed again, and how long it waits before each attempt.
+type RetryPolicy struct {
+	// MaxAttempts is the number of executions of the job, the job is executed once if it is 0 or 1
+	MaxAttempts uint
+	// Backoff is the delay before the second attempt, it doubles with every next attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable reports whether the job is executed again after the error, every error is retried if it is nil
+	Retryable func(err error) bool
+}
+
+// PanicError is the error of a job whose execution panicked. Panicked jobs are not retried.
+type PanicError struct {
 	Value interface{}
-	Err   error
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("job panicked: %v", e.Value)
 }
 
-type Job struct {
-	ExecFn ExecutionFn
-	Args   interface{}
+type Job[A, R any] struct {
+	// Id identifies the job in logs and results, it is assigned by GenerateFrom if it is 0
+	Id     uint64
+	ExecFn ExecutionFn[A, R]
+	Args   A
+	Retry  RetryPolicy
 }
 
-func (j Job) execute(ctx context.Context) Result {
-	value := j.ExecFn(ctx, j.Args)
+// Result of a job. Args are the arguments of the job, so that a failed job can be rescheduled.
+type Result[A, R any] struct {
+	JobId    uint64
+	Args     A
+	Value    R
+	Err      error
+	Attempts uint
+}
+
+// lastJobId makes the job ids unique within the process
+var lastJobId uint64
+
+func nextJobId() uint64 {
+	return atomic.AddUint64(&lastJobId, 1)
+}
+
+func (j Job[A, R]) execute(ctx context.Context) Result[A, R] {
+	start := time.Now()
+	defer func() { metrics.JobDuration.Observe(metrics.Since(start)) }()
+
+	result := Result[A, R]{JobId: j.Id, Args: j.Args}
+	backoff := j.Retry.Backoff
+	for {
+		result.Attempts++
+		result.Value, result.Err = j.attempt(ctx)
+		if result.Err == nil || !j.retryable(result.Attempts, result.Err) || ctx.Err() != nil {
+			return result
+		}
+
+		logger.WithField("job", j.Id).WithField("attempt", result.Attempts).WithError(result.Err).Warn("Job failed, retrying")
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return result
+		}
+		backoff *= 2
+		if j.Retry.MaxBackoff > 0 && backoff > j.Retry.MaxBackoff {
+			backoff = j.Retry.MaxBackoff
+		}
+	}
+}
+
+// attempt executes the job once, turning a panic into a PanicError
+func (j Job[A, R]) attempt(ctx context.Context) (value R, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = &PanicError{Value: recovered, Stack: debug.Stack()}
+		}
+	}()
+	return j.ExecFn(ctx, j.Args)
+}
 
-	return Result{
-		Value: value,
+func (j Job[A, R]) retryable(attempts uint, err error) bool {
+	var panicErr *PanicError
+	if attempts >= j.Retry.MaxAttempts || errors.As(err, &panicErr) {
+		return false
 	}
+	return j.Retry.Retryable == nil || j.Retry.Retryable(err)
 }
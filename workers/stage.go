@@ -0,0 +1,68 @@
+package workers
+
+import (
+	"context"
+	"ethernal/explorer/metrics"
+)
+
+// Stage is one step of a pipeline. Its workers execute Fn on the values received from the previous stage, with the retry policy,
+// and pass the values on to the next stage.
+type Stage[T any] struct {
+	Name    string
+	Workers uint
+	// Buffer is the number of values which wait for the next stage. When it is full the workers wait as well,
+	// so a slow stage throttles the stages before it instead of piling values in memory.
+	Buffer uint
+	Fn     ExecutionFn[T, T]
+	Retry  RetryPolicy
+}
+
+// Run starts the stage on the values received from in and returns the channel of its output, closed once in is closed and every value is processed.
+// The results of failed values are passed to failed, which may be called concurrently by the stages of a pipeline.
+// When ctx is cancelled the stage stops, the values which are not processed yet are dropped.
+func (s Stage[T]) Run(ctx context.Context, in <-chan T, failed func(Result[T, T])) <-chan T {
+	// unbuffered, so that the values held by the stage are bounded by its workers and Buffer
+	wp := WorkerPool[T, T]{
+		workersCount: s.Workers,
+		jobs:         make(chan Job[T, T]),
+		results:      make(chan Result[T, T]),
+		Done:         make(chan struct{}),
+	}
+	out := make(chan T, s.Buffer)
+
+	go func() {
+		defer close(wp.jobs)
+		for value := range in {
+			job := Job[T, T]{Id: nextJobId(), ExecFn: s.Fn, Args: value, Retry: s.Retry}
+			// counted before it is sent, the worker receiving it may take it off the count first
+			metrics.PendingJobs.Inc()
+			select {
+			case wp.jobs <- job:
+			case <-ctx.Done():
+				metrics.PendingJobs.Dec()
+				return
+			}
+		}
+	}()
+	go wp.Run(ctx)
+
+	go func() {
+		defer close(out)
+		buffered := metrics.StageBuffered.WithLabelValues(s.Name)
+		for result := range wp.Results() {
+			if result.Err != nil {
+				failed(result)
+				continue
+			}
+			select {
+			case out <- result.Value:
+				buffered.Set(float64(len(out)))
+			case <-ctx.Done():
+				result.Err = ctx.Err()
+				failed(result)
+			}
+		}
+		buffered.Set(0)
+	}()
+	return out
+}
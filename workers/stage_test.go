@@ -0,0 +1,60 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStageBackpressure(t *testing.T) {
+	var fetched, persisted int64
+	release := make(chan struct{})
+	fetch := Stage[int]{Name: "fetch", Workers: 2, Buffer: 1, Fn: func(ctx context.Context, value int) (int, error) {
+		atomic.AddInt64(&fetched, 1)
+		if value == 3 {
+			return 0, errors.New("broken")
+		}
+		return value, nil
+	}}
+	persist := Stage[int]{Name: "persist", Workers: 1, Fn: func(ctx context.Context, value int) (int, error) {
+		<-release
+		atomic.AddInt64(&persisted, 1)
+		return value, nil
+	}}
+
+	var lock sync.Mutex
+	failed := []int{}
+	onFailure := func(result Result[int, int]) {
+		lock.Lock()
+		failed = append(failed, result.Args)
+		lock.Unlock()
+	}
+
+	in := make(chan int)
+	go func() {
+		defer close(in)
+		for i := 1; i <= 20; i++ {
+			in <- i
+		}
+	}()
+	out := persist.Run(context.Background(), fetch.Run(context.Background(), in, onFailure), onFailure)
+
+	// the blocked persist stage stops the fetch stage after its workers and buffers are full
+	time.Sleep(50 * time.Millisecond)
+	// 7 values at most: the failed one, 2 in the fetch workers, 1 waiting for the buffer, 1 in the buffer, 1 waiting for the persist worker and 1 in it
+	if n := atomic.LoadInt64(&fetched); n > 7 {
+		t.Fatalf("%d values fetched while the persist stage is blocked", n)
+	}
+
+	close(release)
+	count := 0
+	for range out {
+		count++
+	}
+	if count != 19 || persisted != 19 || len(failed) != 1 || failed[0] != 3 {
+		t.Fatalf("%d values out, %d persisted, failed %v", count, persisted, failed)
+	}
+}
@@ -2,13 +2,16 @@ package workers
 
 import (
 	"context"
+	"errors"
+	"ethernal/explorer/loger"
+	"ethernal/explorer/metrics"
 	"sync"
-
-	"github.com/sirupsen/logrus"
 )
 
-func worker(ctx context.Context, wg *sync.WaitGroup, jobs <-chan Job, results chan<- Result) {
-	logrus.Debug("New worker is created")
+var logger = loger.Get(loger.Workers)
+
+func worker[A, R any](ctx context.Context, wg *sync.WaitGroup, jobs <-chan Job[A, R], results chan<- Result[A, R]) {
+	logger.Debug("New worker is created")
 
 	defer wg.Done()
 	for {
@@ -17,61 +20,80 @@ func worker(ctx context.Context, wg *sync.WaitGroup, jobs <-chan Job, results ch
 			if !ok {
 				return
 			}
+			metrics.PendingJobs.Dec()
 			// fan-in job execution multiplexing results into the results channel
-			results <- job.execute(ctx)
-		case <-ctx.Done():
-			logrus.Error("Cancelled worker, err: ", ctx.Err())
-			results <- Result{
-				Err: ctx.Err(),
+			result := job.execute(ctx)
+			var panicErr *PanicError
+			if errors.As(result.Err, &panicErr) {
+				logger.WithField("job", job.Id).WithField("stack", string(panicErr.Stack)).Error("Recovered from a panic in a job")
 			}
+			results <- result
+		case <-ctx.Done():
+			logger.WithError(ctx.Err()).Debug("Cancelled worker")
 			return
 		}
 	}
 }
 
-type WorkerPool struct {
+type WorkerPool[A, R any] struct {
 	workersCount uint
-	jobs         chan Job
-	results      chan Result
+	jobs         chan Job[A, R]
+	results      chan Result[A, R]
 	Done         chan struct{}
 }
 
-func New(wcount uint) WorkerPool {
-	return WorkerPool{
+func New[A, R any](wcount uint) WorkerPool[A, R] {
+	return WorkerPool[A, R]{
 		workersCount: wcount,
-		jobs:         make(chan Job, wcount),
-		results:      make(chan Result, wcount),
+		jobs:         make(chan Job[A, R], wcount),
+		results:      make(chan Result[A, R], wcount),
 		Done:         make(chan struct{}),
 	}
 }
 
 // Run starts worker goroutines for fetching data from blockchain. Workers read from jobs channel, execute Job function and Result write into results channel.
-func (wp WorkerPool) Run(ctx context.Context, wg *sync.WaitGroup) {
-	wg.Add(1)
+// A panic in a job is recovered and reported as the PanicError of its result, the worker continues with the next job.
+// The results channel is closed once all workers have finished, either because there are no more jobs or because the context is cancelled.
+func (wp WorkerPool[A, R]) Run(ctx context.Context) {
+	var wg sync.WaitGroup
 
 	var i uint
 	for i = 0; i < wp.workersCount; i++ {
 		wg.Add(1)
 		// fan out worker goroutines
 		// reading from jobs channel and pushing calcs into results channel
-		go worker(ctx, wg, wp.jobs, wp.results)
+		go worker(ctx, &wg, wp.jobs, wp.results)
 	}
 
-	//wait until the goroutines have finished and all data from result channel has been read
+	// wait until the goroutines have finished
 	wg.Wait()
+	// jobs left in the channel by cancelled workers will never be executed
+	metrics.PendingJobs.Sub(float64(len(wp.jobs)))
 	close(wp.Done)
 	close(wp.results)
 }
 
-// Results returns WorkerPool results channel.
-func (wp WorkerPool) Results() <-chan Result {
+// Results returns WorkerPool results channel. Every executed job has exactly one result, failed ones have Err set.
+func (wp WorkerPool[A, R]) Results() <-chan Result[A, R] {
 	return wp.results
 }
 
-// GenerateFrom adds Jobs to WorkerPool jobs channel and closes it after adding all of them.
-func (wp WorkerPool) GenerateFrom(jobsBulk []Job) {
+// GenerateFrom adds Jobs to WorkerPool jobs channel and closes it after adding all of them, or when the context is cancelled.
+// Jobs without an id get a new one.
+func (wp WorkerPool[A, R]) GenerateFrom(ctx context.Context, jobsBulk []Job[A, R]) {
+	defer close(wp.jobs)
 	for i := range jobsBulk {
-		wp.jobs <- jobsBulk[i]
+		if jobsBulk[i].Id == 0 {
+			jobsBulk[i].Id = nextJobId()
+		}
+		// counted before it is sent, the worker receiving it may take it off the count first
+		metrics.PendingJobs.Inc()
+		select {
+		case wp.jobs <- jobsBulk[i]:
+		case <-ctx.Done():
+			metrics.PendingJobs.Dec()
+			logger.WithField("skipped_jobs", len(jobsBulk)-i).Info("Stopped generating jobs")
+			return
+		}
 	}
-	close(wp.jobs)
 }
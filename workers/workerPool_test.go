@@ -0,0 +1,67 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWorkerPool(t *testing.T) {
+	errPermanent := errors.New("permanent")
+	attempts := map[int]int{}
+	execFn := func(ctx context.Context, args int) (int, error) {
+		switch args {
+		case 1:
+			panic("broken job")
+		case 2:
+			return 0, errPermanent
+		case 3:
+			// succeeds at the third attempt
+			attempts[args]++
+			if attempts[args] < 3 {
+				return 0, errors.New("temporary")
+			}
+		}
+		return args * 10, nil
+	}
+
+	retry := RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		Retryable:   func(err error) bool { return !errors.Is(err, errPermanent) },
+	}
+	jobs := []Job[int, int]{}
+	for i := 1; i <= 4; i++ {
+		jobs = append(jobs, Job[int, int]{ExecFn: execFn, Args: i, Retry: retry})
+	}
+
+	// a single worker runs the jobs in order, so that the attempts are not counted concurrently
+	wp := New[int, int](1)
+	go wp.GenerateFrom(context.Background(), jobs)
+	go wp.Run(context.Background())
+
+	results := map[int]Result[int, int]{}
+	ids := map[uint64]bool{}
+	for result := range wp.Results() {
+		results[result.Args] = result
+		ids[result.JobId] = true
+	}
+	if len(results) != 4 || len(ids) != 4 || ids[0] {
+		t.Fatalf("expected 4 results with distinct ids, got %+v", results)
+	}
+
+	var panicErr *PanicError
+	if !errors.As(results[1].Err, &panicErr) || results[1].Attempts != 1 {
+		t.Fatalf("the panicking job has error %v after %d attempts", results[1].Err, results[1].Attempts)
+	}
+	if !errors.Is(results[2].Err, errPermanent) || results[2].Attempts != 1 {
+		t.Fatalf("the failing job has error %v after %d attempts", results[2].Err, results[2].Attempts)
+	}
+	if results[3].Err != nil || results[3].Value != 30 || results[3].Attempts != 3 {
+		t.Fatalf("the retried job has value %d and error %v after %d attempts", results[3].Value, results[3].Err, results[3].Attempts)
+	}
+	if results[4].Err != nil || results[4].Value != 40 || results[4].Attempts != 1 {
+		t.Fatalf("the job has value %d and error %v after %d attempts", results[4].Value, results[4].Err, results[4].Attempts)
+	}
+}